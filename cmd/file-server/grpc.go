@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Tsapen/fss/internal/fspb"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/tracing"
+)
+
+const (
+	grpcChunkSize     = 64 << 10
+	grpcListBatchSize = 1000
+)
+
+// grpcServer serves fragments over gRPC streams.
+type grpcServer struct {
+	fspb.UnimplementedFileServerServer
+
+	s *server
+}
+
+func (s *server) startGRPCServer() error {
+	listener, err := net.Listen("tcp", s.cfg.GRPCAddr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", s.cfg.GRPCAddr, err)
+	}
+
+	s.grpc = grpc.NewServer(
+		grpc.UnaryInterceptor(tracing.UnaryServerInterceptor),
+		grpc.StreamInterceptor(tracing.StreamServerInterceptor),
+	)
+	fspb.RegisterFileServerServer(s.grpc, &grpcServer{s: s})
+
+	go func() {
+		log.Info().Msgf("gRPC server started to listen %s", s.cfg.GRPCAddr)
+		if err := s.grpc.Serve(listener); err != nil {
+			log.Error().Err(err).Msg("serve grpc")
+		}
+	}()
+
+	return nil
+}
+
+func (g *grpcServer) Put(stream fspb.FileServer_PutServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return grpcErr(fss.NewBadRequestError("receive first message: %w", err))
+	}
+
+	size, err := g.s.storeFragment(first.GetName(), &putReader{stream: stream, buf: first.GetChunk()})
+	if err != nil {
+		return grpcErr(err)
+	}
+
+	return stream.SendAndClose(&fspb.PutResponse{Size: size})
+}
+
+// putReader adapts client stream of chunks to io.Reader.
+type putReader struct {
+	stream fspb.FileServer_PutServer
+	buf    []byte
+}
+
+func (r *putReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf = msg.GetChunk()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (g *grpcServer) Get(req *fspb.GetRequest, stream fspb.FileServer_GetServer) (err error) {
+	file, err := g.s.openFragment(req.GetName())
+	if err != nil {
+		return grpcErr(err)
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(file.Close(), err)
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return grpcErr(fss.NewInternalError("stat file: %w", err))
+	}
+
+	buf := make([]byte, grpcChunkSize)
+	for first := true; ; first = false {
+		n, err := file.Read(buf)
+		if n > 0 || first {
+			msg := &fspb.GetResponse{Chunk: buf[:n]}
+			if first {
+				msg.Size = info.Size()
+			}
+
+			if sendErr := stream.Send(msg); sendErr != nil {
+				return sendErr
+			}
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+
+		case err != nil:
+			return grpcErr(fss.NewInternalError("read file: %w", err))
+		}
+	}
+}
+
+func (g *grpcServer) Delete(_ context.Context, req *fspb.DeleteRequest) (*fspb.DeleteResponse, error) {
+	if err := g.s.deleteFragment(req.GetName()); err != nil {
+		return nil, grpcErr(err)
+	}
+
+	return &fspb.DeleteResponse{}, nil
+}
+
+func (g *grpcServer) Stat(_ context.Context, req *fspb.StatRequest) (*fspb.StatResponse, error) {
+	info, err := g.s.statFragment(req.GetName())
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+
+	return &fspb.StatResponse{
+		Name:       info.Name,
+		Size:       info.Size,
+		ModifiedAt: timestamppb.New(info.ModifiedAt),
+	}, nil
+}
+
+func (g *grpcServer) Exists(_ context.Context, req *fspb.ExistsRequest) (*fspb.ExistsResponse, error) {
+	exists, err := g.s.fragmentsExist(req.GetNames())
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+
+	return &fspb.ExistsResponse{Exists: exists}, nil
+}
+
+func (g *grpcServer) List(req *fspb.ListRequest, stream fspb.FileServer_ListServer) error {
+	fragments, err := g.s.listFragments(req.GetPrefix())
+	if err != nil {
+		return grpcErr(err)
+	}
+
+	for len(fragments) > 0 {
+		n := min(len(fragments), grpcListBatchSize)
+		msg := &fspb.ListResponse{Fragments: make([]*fspb.StatResponse, 0, n)}
+		for _, info := range fragments[:n] {
+			msg.Fragments = append(msg.Fragments, &fspb.StatResponse{
+				Name:       info.Name,
+				Size:       info.Size,
+				ModifiedAt: timestamppb.New(info.ModifiedAt),
+			})
+		}
+
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+
+		fragments = fragments[n:]
+	}
+
+	return nil
+}
+
+func (g *grpcServer) Stats(_ context.Context, _ *fspb.StatsRequest) (*fspb.StatsResponse, error) {
+	stats, err := g.s.stats()
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+
+	return &fspb.StatsResponse{
+		Capacity:  stats.Capacity,
+		Used:      stats.Used,
+		Free:      stats.Free,
+		Fragments: stats.Fragments,
+	}, nil
+}
+
+func grpcErr(err error) error {
+	switch {
+	case errors.As(err, &fss.BadRequestError{}), errors.As(err, &fss.ValidationError{}):
+		return status.Error(codes.InvalidArgument, err.Error())
+
+	case errors.As(err, &fss.NotFoundError{}):
+		return status.Error(codes.NotFound, err.Error())
+
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -2,67 +2,205 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 
 	"github.com/Tsapen/fss/internal/config"
 	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/health"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/logging"
+	"github.com/Tsapen/fss/internal/metrics"
+	"github.com/Tsapen/fss/internal/tracing"
 )
 
 type server struct {
-	cfg config.FSConfig
-	s   *http.Server
+	cfg    config.FSConfig
+	s      *http.Server
+	grpc   *grpc.Server
+	health health.State
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	cfg, err := config.GetForFS()
 	if err != nil {
 		log.Fatal().Err(err).Msg("read config")
 	}
 
+	if err = logging.Setup(logging.Config(*cfg.Log)); err != nil {
+		log.Fatal().Err(err).Msg("init logging")
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), "file-server", tracing.Config(*cfg.Tracing))
+	if err != nil {
+		log.Fatal().Err(err).Msg("init tracing")
+	}
+
 	fs := newFileServer(*cfg)
+	metrics.RegisterServerStats(fs.stats)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- fs.startServer(ctx)
+	}()
+
+	select {
+	case err = <-serveErr:
+		log.Error().Err(err).Msg("run http server")
+
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	}
 
-	fs.startServer()
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	closeErr := errors.Join(fs.shutdown(shutdownCtx), shutdown(shutdownCtx))
+	if closeErr != nil {
+		log.Error().Err(closeErr).Msg("shutdown")
+	}
+
+	if err != nil || closeErr != nil {
+		os.Exit(1)
+	}
 }
 
 func newFileServer(cfg config.FSConfig) *server {
 	r := mux.NewRouter()
+
+	var handler http.Handler = r
+	if cfg.H2C {
+		handler = h2c.NewHandler(r, &http2.Server{})
+	}
+
 	s := &server{
 		cfg: cfg,
 		s: &http.Server{
 			Addr:    cfg.HTTPCfg.Addr,
-			Handler: r,
+			Handler: handler,
 		},
 	}
 
 	r.HandleFunc("/file", s.storeHandler).Methods(http.MethodPost)
 	r.HandleFunc("/file", s.getHandler).Methods(http.MethodGet)
+	r.HandleFunc("/file", s.deleteHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/file", s.statHandler).Methods(http.MethodHead)
+	r.HandleFunc("/file/exists", s.existsHandler).Methods(http.MethodPost)
+	r.HandleFunc("/file/list", s.listHandler).Methods(http.MethodGet)
+	r.HandleFunc("/file/stats", s.statsHandler).Methods(http.MethodGet)
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", s.health.Live).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", s.health.Ready).Methods(http.MethodGet)
+	r.Use(logging.Middleware, s.health.Middleware, metrics.Middleware, tracing.Middleware)
 
 	return s
 }
 
-func (s *server) startServer() error {
+func (s *server) startServer(ctx context.Context) error {
+	if s.cfg.GRPCAddr != "" {
+		if err := s.startGRPCServer(); err != nil {
+			return fmt.Errorf("start grpc server: %w", err)
+		}
+	}
+
+	if s.cfg.UnixSocket != "" {
+		if err := os.Remove(s.cfg.UnixSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove stale socket: %w", err)
+		}
+
+		listener, err := net.Listen("unix", s.cfg.UnixSocket)
+		if err != nil {
+			return fmt.Errorf("listen unix socket: %w", err)
+		}
+
+		go func() {
+			log.Info().Msgf("HTTP server started to listen %s", s.cfg.UnixSocket)
+			if err := s.s.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("serve unix socket")
+			}
+		}()
+	}
+
+	if join := s.cfg.Join; join != nil {
+		if join.FSSAddress == "" || join.AdvertiseURL == "" {
+			return fmt.Errorf("join config needs fss_address and advertise_url")
+		}
+
+		go s.register(ctx)
+	}
+
 	log.Info().Msgf("HTTP server started to listen %s", s.cfg.HTTPCfg.Addr)
 
-	return s.s.ListenAndServe()
+	if err := s.s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
 }
 
-func (s *server) storeHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := fss.WithReqID(r.Context(), uuid.NewString())
+// shutdown makes the server not ready and keeps serving for the drain delay, then it rejects
+// new requests and waits for running ones until ctx is done, then the rest of connections are closed.
+func (s *server) shutdown(ctx context.Context) error {
+	s.health.Drain()
 
-	logger := log.With().Str("method", r.Method).Str("path", r.URL.String()).Str("request_id", fss.ReqIDFromCtx(ctx)).Logger()
-	logger.Info().Msg("received request")
+	delay := time.NewTimer(s.cfg.HTTPCfg.DrainDelay)
+	select {
+	case <-delay.C:
+	case <-ctx.Done():
+		delay.Stop()
+	}
 
-	if err := s.store(r); err != nil {
-		renderErr(ctx, logger, err, w)
+	s.health.Reject()
+
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+
+		defer func() {
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				s.grpc.Stop()
+			}
+		}()
+	}
+
+	if err := s.s.Shutdown(ctx); err != nil {
+		return fss.HandleErrPair(s.s.Close(), fmt.Errorf("shutdown http server: %w", err))
+	}
+
+	return nil
+}
+
+func (s *server) storeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
+
+	if _, err := s.storeFragment(r.URL.Query().Get("filename"), r.Body); err != nil {
+		httperr.Render(ctx, logger, err, w)
 
 		return
 	}
@@ -71,84 +209,126 @@ func (s *server) storeHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info().Msg("processed request")
 }
 
-func (s *server) store(r *http.Request) (err error) {
-	filename := r.URL.Query().Get("filename")
-	if filename == "" {
-		return fss.NewBadRequestError("filename is empty")
-	}
+func (s *server) getHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
 
-	filePath := filepath.Join(".", "stored_files", filename)
-	file, err := os.Create(filePath)
+	file, err := s.openFragment(r.URL.Query().Get("filename"))
 	if err != nil {
-		return fss.NewInternalError("store file: %w", err)
+		httperr.Render(ctx, logger, err, w)
+		return
 	}
 
-	defer func() {
-		err = fss.HandleErrPair(file.Close(), err)
-	}()
+	defer file.Close()
 
-	if _, err = io.Copy(file, r.Body); err != nil {
-		return fss.NewInternalError("copy into file: %w", err)
+	if info, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
 	}
 
-	return nil
-}
+	if _, err = io.Copy(w, file); err != nil {
+		httperr.Render(ctx, logger, fss.NewInternalError("send file: %w", err), w)
+		return
+	}
 
-func (s *server) getHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := fss.WithReqID(r.Context(), uuid.NewString())
+	logger.Info().Msg("processed request")
+}
 
-	logger := log.With().Str("method", r.Method).Str("path", r.URL.String()).Str("request_id", fss.ReqIDFromCtx(ctx)).Logger()
-	logger.Info().Msg("received request")
+func (s *server) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
 
-	rc, err := s.get(r)
-	if err != nil {
-		renderErr(ctx, logger, err, w)
+	if err := s.deleteFragment(r.URL.Query().Get("filename")); err != nil {
+		httperr.Render(ctx, logger, err, w)
 		return
 	}
 
-	defer rc.Close()
+	w.WriteHeader(http.StatusOK)
+	logger.Info().Msg("processed request")
+}
+
+func (s *server) statHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
 
-	if _, err = io.Copy(w, rc); err != nil {
-		renderErr(ctx, logger, fss.NewInternalError("send file: %w", err), w)
+	info, err := s.statFragment(r.URL.Query().Get("filename"))
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
 		return
 	}
 
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Last-Modified", info.ModifiedAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
 	logger.Info().Msg("processed request")
 }
 
-func (s *server) get(r *http.Request) (rc io.ReadCloser, err error) {
-	filename := r.URL.Query().Get("filename")
-	if filename == "" {
-		return nil, fss.NewBadRequestError("filename is empty")
+type existsRequest struct {
+	Names []string `json:"names"`
+}
+
+type existsResponse struct {
+	Exists []bool `json:"exists"`
+}
+
+func (s *server) existsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
+
+	req := new(existsRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httperr.Render(ctx, logger, fss.NewBadRequestError("decode request: %w", err), w)
+		return
 	}
 
-	filePath := filepath.Join(".", "stored_files", filename)
-	file, err := os.Open(filePath)
+	exists, err := s.fragmentsExist(req.Names)
 	if err != nil {
-		return nil, fss.NewInternalError("open file: %w", err)
+		httperr.Render(ctx, logger, err, w)
+		return
 	}
 
-	return file, nil
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(existsResponse{Exists: exists}); err != nil {
+		logger.Info().Err(err).Msg("failed to write response")
+		return
+	}
+
+	logger.Info().Msg("processed request")
 }
 
-func httpStatus(err error) int {
-	switch {
-	case errors.As(err, &fss.ValidationError{}):
-		return http.StatusBadRequest
+func (s *server) listHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
 
-	case errors.As(err, &fss.NotFoundError{}):
-		return http.StatusNotFound
+	fragments, err := s.listFragments(r.URL.Query().Get("prefix"))
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
 
-	case errors.As(err, &fss.ConflictError{}):
-		return http.StatusConflict
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(fragments); err != nil {
+		logger.Info().Err(err).Msg("failed to write response")
+		return
+	}
 
-	default:
-		return http.StatusInternalServerError
+	logger.Info().Msg("processed request")
+}
+
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, logger := s.requestLogger(r)
+
+	stats, err := s.stats()
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		logger.Info().Err(err).Msg("failed to write response")
+		return
 	}
+
+	logger.Info().Msg("processed request")
 }
 
-func renderErr(ctx context.Context, logger zerolog.Logger, err error, w http.ResponseWriter) {
-	statusCode := httpStatus(err)
-	w.WriteHeader(statusCode)
-	logger.Info().Err(err).Int("status code", statusCode).Msg("failed to process message")
+func (s *server) requestLogger(r *http.Request) (context.Context, zerolog.Logger) {
+	ctx := r.Context()
+
+	return ctx, fss.LoggerFromCtx(ctx)
 }
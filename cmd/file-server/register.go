@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+const registerRetryInterval = 5 * time.Second
+
+type registerRequest struct {
+	ServerURL string `json:"server_url"`
+	Capacity  int64  `json:"capacity"`
+	Weight    int    `json:"weight"`
+	Zone      string `json:"zone"`
+}
+
+// errRegistrationRejected stops retries of the registration.
+type errRegistrationRejected struct {
+	status  int
+	message string
+}
+
+func (e errRegistrationRejected) Error() string {
+	return fmt.Sprintf("registration rejected with status %d: %s", e.status, e.message)
+}
+
+// register adds the file server into the FSS. It retries until the FSS answers,
+// a server which is already registered is fine.
+func (s *server) register(ctx context.Context) {
+	join := s.cfg.Join
+	logger := log.With().Str("fss", join.FSSAddress).Str("advertise_url", join.AdvertiseURL).Logger()
+
+	uri, err := url.JoinPath(join.FSSAddress, "/api/v1/fs-servers")
+	if err != nil {
+		logger.Error().Err(err).Msg("construct FSS url")
+		return
+	}
+
+	for {
+		err := s.sendRegistration(ctx, uri)
+		if err == nil {
+			logger.Info().Msg("registered in FSS")
+			return
+		}
+
+		if errors.As(err, &errRegistrationRejected{}) {
+			logger.Error().Err(err).Msg("failed to register in FSS")
+			return
+		}
+
+		logger.Info().Err(err).Msg("retry registration in FSS")
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(registerRetryInterval):
+		}
+	}
+}
+
+func (s *server) sendRegistration(ctx context.Context, uri string) error {
+	join := s.cfg.Join
+
+	body, err := json.Marshal(registerRequest{
+		ServerURL: join.AdvertiseURL,
+		Capacity:  s.cfg.Capacity,
+		Weight:    join.Weight,
+		Zone:      join.Zone,
+	})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("construct request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if join.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+join.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK, resp.StatusCode == http.StatusConflict:
+		return nil
+
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+
+	default:
+		body, _ := httperr.Read(resp.Body)
+
+		return errRegistrationRejected{status: resp.StatusCode, message: body.Message}
+	}
+}
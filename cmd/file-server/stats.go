@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// stats reports usage of the storage. Capacity is the size of the disk with
+// the storage directory limited by the configured capacity.
+func (s *server) stats() (*fss.ServerStats, error) {
+	fragments, err := s.listFragments("")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &fss.ServerStats{
+		Fragments: int64(len(fragments)),
+	}
+
+	for _, f := range fragments {
+		stats.Used += f.Size
+	}
+
+	diskSize, diskFree, err := diskUsage(s.storageDir())
+	if err != nil {
+		return nil, fss.NewInternalError("get disk usage: %w", err)
+	}
+
+	stats.Capacity, stats.Free = diskSize, diskFree
+	if limit := s.cfg.Capacity; limit > 0 {
+		free := max(limit-stats.Used, 0)
+		if diskSize == 0 || limit < diskSize {
+			stats.Capacity = limit
+		}
+
+		if diskSize == 0 || free < diskFree {
+			stats.Free = free
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// diskUsage is not supported on the platform, only the configured capacity is reported.
+func diskUsage(string) (size, free int64, err error) {
+	return 0, 0, nil
+}
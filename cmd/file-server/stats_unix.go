@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// diskUsage returns size and free space of the disk with dir in bytes.
+func diskUsage(dir string) (size, free int64, err error) {
+	// The storage directory is created on the first upload, so stat the closest existing parent.
+	for {
+		var st syscall.Statfs_t
+		err = syscall.Statfs(dir, &st)
+		if errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			continue
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+const (
+	defaultStorageDir = "stored_files"
+
+	// tempPrefix starts names of fragments which are being written.
+	tempPrefix = ".tmp-"
+)
+
+func (s *server) storageDir() string {
+	if s.cfg.FSDir != "" {
+		return s.cfg.FSDir
+	}
+
+	return filepath.Join(".", defaultStorageDir)
+}
+
+// fragmentPath returns the path of a fragment inside the storage directory.
+func (s *server) fragmentPath(name string) (string, error) {
+	if name == "" {
+		return "", fss.NewBadRequestError("filename is empty")
+	}
+
+	return filepath.Join(s.storageDir(), filepath.Clean("/"+name)), nil
+}
+
+// storeFragment writes the fragment into a temporary file and renames it into place once it
+// is synced, so an aborted write leaves the previous version of the fragment intact.
+func (s *server) storeFragment(name string, data io.Reader) (size int64, err error) {
+	filePath, err := s.fragmentPath(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return 0, fss.NewInternalError("create directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), tempPrefix+"*")
+	if err != nil {
+		return 0, fss.NewInternalError("create temporary file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	if size, err = io.Copy(file, data); err != nil {
+		return 0, fss.NewInternalError("copy into file: %w", err)
+	}
+
+	if err = file.Sync(); err != nil {
+		return 0, fss.NewInternalError("sync file: %w", err)
+	}
+
+	if err = file.Close(); err != nil {
+		return 0, fss.NewInternalError("close file: %w", err)
+	}
+
+	if err = os.Rename(file.Name(), filePath); err != nil {
+		return 0, fss.NewInternalError("rename file: %w", err)
+	}
+
+	return size, nil
+}
+
+func (s *server) openFragment(name string) (*os.File, error) {
+	filePath, err := s.fragmentPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, fss.NewNotFoundError("fragment '%s' not found", name)
+
+	case err != nil:
+		return nil, fss.NewInternalError("open file: %w", err)
+
+	default:
+		return file, nil
+	}
+}
+
+func (s *server) deleteFragment(name string) error {
+	filePath, err := s.fragmentPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fss.NewNotFoundError("fragment '%s' not found", name)
+
+	case err != nil:
+		return fss.NewInternalError("remove file: %w", err)
+
+	default:
+		return nil
+	}
+}
+
+func (s *server) statFragment(name string) (*fss.FragmentInfo, error) {
+	filePath, err := s.fragmentPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, fss.NewNotFoundError("fragment '%s' not found", name)
+
+	case err != nil:
+		return nil, fss.NewInternalError("stat file: %w", err)
+
+	default:
+		return &fss.FragmentInfo{
+			Name:       name,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		}, nil
+	}
+}
+
+func (s *server) fragmentsExist(names []string) ([]bool, error) {
+	exists := make([]bool, 0, len(names))
+	for _, name := range names {
+		_, err := s.statFragment(name)
+		switch {
+		case errors.As(err, &fss.NotFoundError{}):
+			exists = append(exists, false)
+
+		case err != nil:
+			return nil, err
+
+		default:
+			exists = append(exists, true)
+		}
+	}
+
+	return exists, nil
+}
+
+// listFragments returns info of the stored fragments which names start with prefix.
+func (s *server) listFragments(prefix string) ([]fss.FragmentInfo, error) {
+	root := s.storageDir()
+
+	var fragments []fss.FragmentInfo
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fragments = append(fragments, fss.FragmentInfo{
+			Name:       name,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fss.NewInternalError("walk storage directory: %w", err)
+	}
+
+	return fragments, nil
+}
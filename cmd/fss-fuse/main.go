@@ -0,0 +1,99 @@
+// Command fss-fuse mounts the FSS namespace as a local file system.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Tsapen/fss/internal/config"
+	"github.com/Tsapen/fss/internal/fusefs"
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+const usage = `usage: fss-fuse [-write] [-chunk-size N] [-cache-size N] [-tmp DIR] [-address URL] [-token T] [-debug] DIR
+
+The FSS is mounted read-only unless -write is set, written files are uploaded when they are closed.
+The FSS address and token are read from FSS_ROOT_DIR/FSS_CLIENT_CONFIG unless -address is set.
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+
+		log.Fatalf("fss-fuse: %v", err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("fss-fuse", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	writable := fs.Bool("write", false, "upload written files")
+	chunkSize := fs.Int64("chunk-size", 0, "size of file ranges read at once, 1 MiB by default")
+	cacheSize := fs.Int64("cache-size", 0, "bound of cached bytes, 64 MiB by default")
+	tempDir := fs.String("tmp", "", "directory of files being written")
+	address := fs.String("address", "", "FSS address, overrides the client config")
+	token := fs.String("token", "", "bearer token, overrides the client config")
+	debug := fs.Bool("debug", false, "log FUSE requests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	if *address == "" {
+		cfg, err := config.GetForClient()
+		if err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+
+		*address = cfg.Address
+		if *token == "" {
+			*token = cfg.Token
+		}
+	}
+
+	c, err := client.New(client.Config{Address: *address, Token: *token})
+	if err != nil {
+		return fmt.Errorf("init client: %w", err)
+	}
+
+	fsys := fusefs.New(c, fusefs.Config{
+		ChunkSize: *chunkSize,
+		CacheSize: *cacheSize,
+		Writable:  *writable,
+		TempDir:   *tempDir,
+		Debug:     *debug,
+	})
+	defer fsys.Close()
+
+	server, err := fsys.Mount(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("mount %s: %w", fs.Arg(0), err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		<-sig
+		if err := server.Unmount(); err != nil {
+			log.Printf("unmount: %v", err)
+		}
+	}()
+
+	log.Printf("fss is mounted on %s", fs.Arg(0))
+	server.Wait()
+
+	return nil
+}
@@ -23,7 +23,13 @@ type tc struct {
 func TestFSS(t *testing.T, addr string, fssConfig *config.FSSConfig) {
 	ctx := context.Background()
 
-	db, err := postgres.New(postgres.Config(*fssConfig.DB))
+	db, err := postgres.New(postgres.Config{
+		UserName:    fssConfig.DB.UserName,
+		Password:    fssConfig.DB.Password,
+		Port:        fssConfig.DB.Port,
+		VirtualHost: fssConfig.DB.VirtualHost,
+		HostName:    fssConfig.DB.HostName,
+	})
 	if err != nil {
 		t.Fatalf("open db conn: %v\n", err)
 	}
@@ -1,38 +1,202 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
 	"github.com/rs/zerolog/log"
 
 	"github.com/Tsapen/fss/internal/config"
+	"github.com/Tsapen/fss/internal/coordination"
 	dm "github.com/Tsapen/fss/internal/download-manager"
 	fsshttp "github.com/Tsapen/fss/internal/fss-http"
+	"github.com/Tsapen/fss/internal/gc"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/keeper"
+	"github.com/Tsapen/fss/internal/logging"
+	"github.com/Tsapen/fss/internal/maintenance"
+	"github.com/Tsapen/fss/internal/metrics"
 	"github.com/Tsapen/fss/internal/migrator"
 	"github.com/Tsapen/fss/internal/postgres"
+	"github.com/Tsapen/fss/internal/readcache"
+	"github.com/Tsapen/fss/internal/sqlite"
+	"github.com/Tsapen/fss/internal/tracing"
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	cfg, err := config.GetForFSS()
 	if err != nil {
 		log.Fatal().Err(err).Msg("read config")
 	}
 
-	db, err := postgres.New(postgres.Config(*cfg.DB))
+	if err = logging.Setup(logging.Config(*cfg.Log)); err != nil {
+		log.Fatal().Err(err).Msg("init logging")
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), "fss", tracing.Config(*cfg.Tracing))
+	if err != nil {
+		log.Fatal().Err(err).Msg("init tracing")
+	}
+
+	db, err := openStorage(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("init storage")
 	}
 
-	if err = migrator.ApplyMigrations(cfg.MigrationsPath, db.DB.DB); err != nil {
-		log.Fatal().Err(err).Msg("apply migrations")
+	driver := cfg.DB.Driver
+	if driver == "" {
+		driver = migrator.DriverPostgres
 	}
 
-	dmService := dm.New(db, cfg.Timeout)
+	storage := metrics.InstrumentStorage(driver, tracing.TraceStorage(driver, db))
+
+	fragmentStore := keeper.New(keeper.Config(*cfg.Keeper))
 
-	httpService, err := fsshttp.NewServer(fsshttp.Config(*cfg.HTTPCfg), cfg.MaxFragmentSize, dmService)
+	holder := cfg.Coordination.InstanceID
+	if holder == "" {
+		holder = coordination.NewHolder()
+	}
+
+	dmService, err := dm.New(storage, fragmentStore, dm.Config{
+		Timeout:         cfg.Timeout,
+		Placement:       cfg.Placement.Default,
+		BucketPlacement: cfg.Placement.Buckets,
+		StatsTTL:        cfg.Placement.StatsTTL,
+		Quota:           dm.Quota(cfg.Quotas.Default),
+		BucketQuotas:    bucketQuotas(cfg.Quotas.Buckets),
+		Holder:          holder,
+		UploadLeaseTTL:  cfg.Coordination.UploadLeaseTTL,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("init download manager")
+	}
+
+	collector := gc.New(gc.Config(*cfg.GC), storage, fragmentStore)
+	jobManager := jobs.NewManager(storage)
+	maintenanceService := maintenance.New(dmService, storage, fragmentStore)
+	jobManager.Register(jobs.KindGC, collector.Job)
+	jobManager.Register(jobs.KindScrub, maintenanceService.Scrub)
+	jobManager.Register(jobs.KindRebalance, maintenanceService.Rebalance)
+
+	// The leader collects garbage and runs jobs started by operators.
+	elector := coordination.NewElector(storage, holder, cfg.Coordination.LeaderTTL)
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(ctx, func(ctx context.Context) {
+			collected := make(chan struct{})
+			go func() {
+				defer close(collected)
+				collector.Run(ctx)
+			}()
+
+			jobManager.Lead(ctx)
+			<-collected
+		})
+	}()
+
+	var readCache *readcache.Cache
+	if cfg.ReadCache.Size > 0 {
+		if readCache, err = readcache.New(readcache.Config(*cfg.ReadCache)); err != nil {
+			log.Fatal().Err(err).Msg("init read cache")
+		}
+	}
+
+	httpService, err := fsshttp.NewServer(fsshttp.Config(*cfg.HTTPCfg), cfg.MaxFragmentSize, dmService, fragmentStore, jobManager, readCache)
 	if err != nil {
 		log.Fatal().Err(err).Msg("init http server")
 	}
 
-	if err = httpService.StartServer(); err != nil {
-		log.Fatal().Err(err).Msg("run tcp server")
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpService.StartServer()
+	}()
+
+	select {
+	case err = <-serveErr:
+		log.Error().Err(err).Msg("run tcp server")
+
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
 	}
+
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Running uploads finish or roll back before the leader lease, connections and the db are released.
+	closeErr := httpService.Shutdown(shutdownCtx)
+	jobManager.Close()
+	<-electorDone
+	closeErr = errors.Join(closeErr, fragmentStore.Close(), db.Close(), shutdown(shutdownCtx))
+	if closeErr != nil {
+		log.Error().Err(closeErr).Msg("shutdown")
+	}
+
+	if err != nil || closeErr != nil {
+		os.Exit(1)
+	}
+}
+
+// closableStorage is the metadata db which is closed on shutdown.
+type closableStorage interface {
+	dm.Storage
+	Close() error
+}
+
+// openStorage connects to the metadata db chosen by the driver and applies its migrations.
+func openStorage(cfg *config.FSSConfig) (closableStorage, error) {
+	switch cfg.DB.Driver {
+	case "", migrator.DriverPostgres:
+		db, err := postgres.New(postgres.Config{
+			UserName:    cfg.DB.UserName,
+			Password:    cfg.DB.Password,
+			Port:        cfg.DB.Port,
+			VirtualHost: cfg.DB.VirtualHost,
+			HostName:    cfg.DB.HostName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("init postgres: %w", err)
+		}
+
+		if err = migrator.ApplyMigrations(migrator.DriverPostgres, cfg.MigrationsPath, db.DB.DB); err != nil {
+			return nil, fmt.Errorf("apply migrations: %w", err)
+		}
+
+		return db, nil
+
+	case migrator.DriverSQLite:
+		db, err := sqlite.New(sqlite.Config{Path: cfg.DB.Path})
+		if err != nil {
+			return nil, fmt.Errorf("init sqlite: %w", err)
+		}
+
+		if err = migrator.ApplyMigrations(migrator.DriverSQLite, path.Join(cfg.MigrationsPath, "sqlite"), db.DB.DB); err != nil {
+			return nil, fmt.Errorf("apply migrations: %w", err)
+		}
+
+		return db, nil
+
+	default:
+		return nil, fmt.Errorf("unknown db driver '%s'", cfg.DB.Driver)
+	}
+}
+
+// bucketQuotas converts quotas of the config to quotas of the download manager.
+func bucketQuotas(buckets map[string]config.QuotaCfg) map[string]dm.Quota {
+	quotas := make(map[string]dm.Quota, len(buckets))
+	for bucket, quota := range buckets {
+		quotas[bucket] = dm.Quota(quota)
+	}
+
+	return quotas
 }
@@ -0,0 +1,458 @@
+// Command fssctl administers the FSS: file servers, files, maintenance jobs and bucket usage.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Tsapen/fss/internal/config"
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+const usage = `usage: fssctl [-o table|json] [-address URL] [-token T] <command> [args]
+
+commands:
+  servers list
+  servers add [-capacity N] [-weight N] [-zone Z] [-mode M] URL
+  servers disable ID
+  files list [-prefix P] [-after NAME] [-limit N]
+  files stat NAME
+  files fragments NAME
+  files rm NAME
+  files put NAME PATH
+  files get NAME PATH
+  jobs start [-watch] gc|scrub|rebalance
+  jobs list
+  jobs get ID
+  jobs watch ID
+  usage
+
+The FSS address and token are read from FSS_ROOT_DIR/FSS_CLIENT_CONFIG unless -address is set.
+`
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// watchInterval is the period of job progress polling.
+const watchInterval = time.Second
+
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+	c      *client.Client
+	output string
+	out    io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+
+		fmt.Fprintf(os.Stderr, "fssctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fssctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	output := fs.String("o", outputTable, "output format: table or json")
+	address := fs.String("address", "", "FSS address, overrides the client config")
+	token := fs.String("token", "", "bearer token, overrides the client config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != outputTable && *output != outputJSON {
+		return fmt.Errorf("unknown output format %q: %w", *output, errUsage)
+	}
+
+	if *address == "" {
+		cfg, err := config.GetForClient()
+		if err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+
+		*address = cfg.Address
+		if *token == "" {
+			*token = cfg.Token
+		}
+	}
+
+	c, err := client.New(client.Config{Address: *address, Token: *token})
+	if err != nil {
+		return fmt.Errorf("init client: %w", err)
+	}
+
+	cmd := &cli{c: c, output: *output, out: os.Stdout}
+
+	args = fs.Args()
+	if len(args) == 1 && args[0] == "usage" {
+		return cmd.usage(ctx)
+	}
+
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "servers":
+		return cmd.servers(ctx, args[1], args[2:])
+
+	case "files":
+		return cmd.files(ctx, args[1], args[2:])
+
+	case "jobs":
+		return cmd.jobs(ctx, args[1], args[2:])
+
+	default:
+		return fmt.Errorf("unknown command %q: %w", args[0], errUsage)
+	}
+}
+
+func (c *cli) servers(ctx context.Context, sub string, args []string) error {
+	switch sub {
+	case "list":
+		servers, err := c.c.Servers(ctx)
+		if err != nil {
+			return err
+		}
+
+		return c.print(servers, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tURL\tMODE\tSTATUS\tZONE\tWEIGHT\tCAPACITY\tUSED\tFRAGMENTS")
+			for _, s := range servers {
+				used, fragments := "-", "-"
+				if s.Usage != nil {
+					used, fragments = strconv.FormatInt(s.Usage.Used, 10), strconv.FormatInt(s.Usage.Fragments, 10)
+				}
+
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+					s.ID, s.URL, s.Mode, dash(s.Status), dash(s.Zone), s.Weight, s.Capacity, used, fragments)
+			}
+		})
+
+	case "add":
+		fs := flag.NewFlagSet("servers add", flag.ContinueOnError)
+		server := client.NewServer{}
+		fs.Int64Var(&server.Capacity, "capacity", 0, "capacity in bytes, 0 is unlimited")
+		fs.IntVar(&server.Weight, "weight", 0, "placement weight")
+		fs.StringVar(&server.Zone, "zone", "", "failure zone")
+		fs.StringVar(&server.Mode, "mode", "", "active, read_only or disabled")
+		if err := parse(fs, args, 1); err != nil {
+			return err
+		}
+
+		server.URL = fs.Arg(0)
+
+		return c.c.AddServer(ctx, server)
+
+	case "disable":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse server id: %w", err)
+		}
+
+		server, err := c.c.DisableServer(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return c.print(server, func(w io.Writer) {
+			fmt.Fprintf(w, "server %d is %s\n", server.ID, server.Mode)
+		})
+
+	default:
+		return fmt.Errorf("unknown servers command %q: %w", sub, errUsage)
+	}
+}
+
+func (c *cli) files(ctx context.Context, sub string, args []string) error {
+	switch sub {
+	case "list":
+		fs := flag.NewFlagSet("files list", flag.ContinueOnError)
+		list := client.ListFiles{}
+		fs.StringVar(&list.Prefix, "prefix", "", "name prefix")
+		fs.StringVar(&list.After, "after", "", "last name of the previous page")
+		fs.IntVar(&list.Limit, "limit", 0, "page size")
+		if err := parse(fs, args, 0); err != nil {
+			return err
+		}
+
+		files, err := c.c.Files(ctx, list)
+		if err != nil {
+			return err
+		}
+
+		return c.print(files, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME\tCOMMITTED\tFRAGMENTS\tPLACEMENT\tLAST COMMITTED")
+			for _, f := range files {
+				printFile(w, f)
+			}
+		})
+
+	case "stat":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		f, err := c.c.StatFile(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		return c.print(f, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME\tCOMMITTED\tFRAGMENTS\tPLACEMENT\tLAST COMMITTED")
+			printFile(w, *f)
+		})
+
+	case "fragments":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		fragments, err := c.c.FileFragments(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		return c.print(fragments, func(w io.Writer) {
+			fmt.Fprintln(w, "INDEX\tSERVER\tURL\tMODE\tSTATE\tSTATUS\tSIZE\tCHECKSUM")
+			for _, f := range fragments {
+				size, checksum := "-", "-"
+				if f.Size != nil {
+					size = strconv.FormatInt(*f.Size, 10)
+				}
+
+				if f.Checksum != nil {
+					checksum = *f.Checksum
+				}
+
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					f.Index, f.ServerID, f.ServerURL, f.ServerMode, dash(f.State), f.Status, size, checksum)
+			}
+		})
+
+	case "rm":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		return c.c.DeleteFile(ctx, args[0])
+
+	case "put":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		return c.c.SaveFile(ctx, args[0], args[1])
+
+	case "get":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		return c.c.GetFile(ctx, args[0], args[1])
+
+	default:
+		return fmt.Errorf("unknown files command %q: %w", sub, errUsage)
+	}
+}
+
+func (c *cli) jobs(ctx context.Context, sub string, args []string) error {
+	switch sub {
+	case "start":
+		fs := flag.NewFlagSet("jobs start", flag.ContinueOnError)
+		watch := fs.Bool("watch", false, "watch the job progress until it finishes")
+		if err := parse(fs, args, 1); err != nil {
+			return err
+		}
+
+		job, err := c.c.StartJob(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		if *watch {
+			return c.watch(ctx, job.ID)
+		}
+
+		return c.printJobs([]client.Job{*job})
+
+	case "list":
+		jobs, err := c.c.Jobs(ctx)
+		if err != nil {
+			return err
+		}
+
+		return c.printJobs(jobs)
+
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		job, err := c.c.Job(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		return c.printJobs([]client.Job{*job})
+
+	case "watch":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		return c.watch(ctx, args[0])
+
+	default:
+		return fmt.Errorf("unknown jobs command %q: %w", sub, errUsage)
+	}
+}
+
+// usage prints usage of buckets with their quotas.
+func (c *cli) usage(ctx context.Context) error {
+	usage, err := c.c.Usage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.print(usage, func(w io.Writer) {
+		fmt.Fprintln(w, "BUCKET\tFILES\tBYTES\tSOFT QUOTA\tHARD QUOTA\tSTATUS")
+		for _, u := range usage {
+			status := "ok"
+			switch {
+			case u.HardExceeded:
+				status = "hard quota exceeded"
+
+			case u.SoftExceeded:
+				status = "soft quota exceeded"
+			}
+
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n",
+				dash(u.Bucket), u.Files, u.Bytes, quotaOrDash(u.SoftQuota), quotaOrDash(u.HardQuota), status)
+		}
+	})
+}
+
+// watch prints the job progress until the job finishes and fails unless the job succeeded.
+func (c *cli) watch(ctx context.Context, id string) error {
+	job, err := c.c.WatchJob(ctx, id, watchInterval, func(job *client.Job) {
+		if c.output == outputJSON {
+			_ = json.NewEncoder(c.out).Encode(job)
+			return
+		}
+
+		fmt.Fprintf(c.out, "%s %s: %s %d/%d done, %d failed\n", job.ID, job.Kind, job.State, job.Done, job.Total, job.Failed)
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.output == outputTable {
+		for _, issue := range job.Issues {
+			fmt.Fprintf(c.out, "  %s\n", issue)
+		}
+	}
+
+	if job.State != client.JobSucceeded {
+		return fmt.Errorf("job %s %s: %s", job.ID, job.State, job.Error)
+	}
+
+	return nil
+}
+
+func (c *cli) printJobs(jobs []client.Job) error {
+	return c.print(jobs, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tKIND\tSTATE\tSTARTED\tFINISHED\tTOTAL\tDONE\tFAILED\tERROR")
+		for _, j := range jobs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+				j.ID, j.Kind, j.State, j.StartedAt.Format(time.RFC3339), timeOrDash(j.FinishedAt),
+				j.Total, j.Done, j.Failed, dash(j.Error))
+		}
+	})
+}
+
+// print writes v as JSON or as a table written by table.
+func (c *cli) print(v any, table func(w io.Writer)) error {
+	if c.output == outputJSON {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	table(w)
+
+	return w.Flush()
+}
+
+func printFile(w io.Writer, f client.File) {
+	fragments := "-"
+	if f.Fragments != nil {
+		fragments = strconv.Itoa(*f.Fragments)
+	}
+
+	fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\n", f.Name, f.Committed, fragments, f.Placement, timeOrDash(f.LastCommittedAt))
+}
+
+func quotaOrDash(quota int64) string {
+	if quota == 0 {
+		return "-"
+	}
+
+	return strconv.FormatInt(quota, 10)
+}
+
+// parse parses flags of a subcommand expecting n positional arguments.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %v: %w", fs.Name(), err, errUsage)
+	}
+
+	if fs.NArg() != n {
+		return fmt.Errorf("%s: expected %d arguments, got %q: %w", fs.Name(), n, strings.Join(fs.Args(), " "), errUsage)
+	}
+
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func timeOrDash(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
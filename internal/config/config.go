@@ -12,6 +12,9 @@ import (
 	"github.com/Tsapen/fss/internal/fss"
 )
 
+// defaultShutdownTimeout bounds draining of running requests on SIGTERM.
+const defaultShutdownTimeout = 30 * time.Second
+
 type (
 	fssEnvs struct {
 		RootDir        string `env:"FSS_ROOT_DIR"`
@@ -30,25 +33,63 @@ type (
 	}
 
 	FSSConfig struct {
-		HTTPCfg *HTTPCfg `json:"http"`
-		DB      *DBCfg   `json:"db"`
+		HTTPCfg   *HTTPCfg      `json:"http"`
+		DB        *DBCfg        `json:"db"`
+		Keeper    *KeeperCfg    `json:"keeper"`
+		Placement *PlacementCfg `json:"placement"`
+		GC        *GCCfg        `json:"gc"`
+		ReadCache *ReadCacheCfg `json:"read_cache"`
+		Quotas    *QuotasCfg    `json:"quotas"`
+
+		Coordination *CoordinationCfg `json:"coordination"`
+		Tracing      *TracingCfg      `json:"tracing"`
+		Log          *LogCfg          `json:"log"`
 
 		MaxFragmentSize int64         `json:"max_fragment_size"`
 		Timeout         time.Duration `json:"-"`
+		ShutdownTimeout time.Duration `json:"-"`
 		MigrationsPath  string        `json:"-"`
 	}
 
 	FSConfig struct {
 		HTTPCfg *HTTPCfg `json:"http"`
 
-		FSDir string `json:"file_storage_directory"`
+		FSDir      string `json:"file_storage_directory"`
+		H2C        bool   `json:"h2c"`
+		UnixSocket string `json:"unix_socket"`
+		GRPCAddr   string `json:"grpc_address"`
+		Capacity   int64  `json:"capacity"`
+
+		ShutdownTimeout time.Duration `json:"-"`
+
+		Join    *JoinCfg    `json:"join"`
+		Tracing *TracingCfg `json:"tracing"`
+		Log     *LogCfg     `json:"log"`
+	}
+
+	// JoinCfg makes the file server register itself in the FSS at startup.
+	JoinCfg struct {
+		FSSAddress   string `json:"fss_address"`
+		Token        string `json:"token"`
+		AdvertiseURL string `json:"advertise_url"`
+		Weight       int    `json:"weight"`
+		Zone         string `json:"zone"`
 	}
 
 	HTTPCfg struct {
-		Addr string `json:"address"`
+		Addr       string `json:"address"`
+		JoinToken  string `json:"join_token"`
+		APIToken   string `json:"api_token"`
+		PresignKey string `json:"presign_key"`
+
+		// DrainDelay is how long a shutting down server keeps serving while it is not ready.
+		DrainDelay time.Duration `json:"-"`
 	}
 
 	DBCfg struct {
+		Driver string `json:"driver"`
+		Path   string `json:"path"`
+
 		UserName    string `json:"username"`
 		Password    string `json:"password"`
 		Port        string `json:"port"`
@@ -57,8 +98,92 @@ type (
 		HostName string `json:"host"`
 	}
 
+	KeeperCfg struct {
+		MaxAttempts       int           `json:"max_attempts"`
+		BaseBackoff       time.Duration `json:"-"`
+		MaxBackoff        time.Duration `json:"-"`
+		Jitter            *float64      `json:"jitter"`
+		RetryableStatuses []int         `json:"retryable_statuses"`
+
+		BaseTimeout   time.Duration `json:"-"`
+		MinThroughput int64         `json:"min_throughput"`
+		MaxTimeout    time.Duration `json:"-"`
+
+		HedgeDelay time.Duration `json:"-"`
+
+		BreakerFailures       int           `json:"breaker_failures"`
+		BreakerOpenTimeout    time.Duration `json:"-"`
+		BreakerHalfOpenProbes int           `json:"breaker_half_open_probes"`
+
+		MaxIdleConns        int               `json:"max_idle_conns"`
+		MaxIdleConnsPerHost int               `json:"max_idle_conns_per_host"`
+		MaxConnsPerHost     int               `json:"max_conns_per_host"`
+		IdleConnTimeout     time.Duration     `json:"-"`
+		DialTimeout         time.Duration     `json:"-"`
+		KeepAlive           time.Duration     `json:"-"`
+		H2C                 bool              `json:"h2c"`
+		UnixSockets         map[string]string `json:"unix_sockets"`
+	}
+
+	// PlacementCfg names placement strategies: round_robin, rendezvous or ring.
+	PlacementCfg struct {
+		Default  string            `json:"default"`
+		Buckets  map[string]string `json:"buckets"`
+		StatsTTL time.Duration     `json:"-"`
+	}
+
+	// ReadCacheCfg enables the cache of downloaded fragments when size is positive,
+	// fragments are kept in dir or in memory. The policy is lru or tinylfu.
+	ReadCacheCfg struct {
+		Size   int64  `json:"size"`
+		Dir    string `json:"dir"`
+		Policy string `json:"policy"`
+	}
+
+	// QuotasCfg limits bytes of buckets, Buckets override Default for their buckets.
+	QuotasCfg struct {
+		Default QuotaCfg            `json:"default"`
+		Buckets map[string]QuotaCfg `json:"buckets"`
+	}
+
+	// QuotaCfg is a soft and a hard limit of bytes, 0 means no limit.
+	QuotaCfg struct {
+		Soft int64 `json:"soft"`
+		Hard int64 `json:"hard"`
+	}
+
+	GCCfg struct {
+		Interval    time.Duration `json:"-"`
+		StaleAfter  time.Duration `json:"-"`
+		OrphanGrace time.Duration `json:"-"`
+		BatchSize   int           `json:"batch_size"`
+	}
+
+	// CoordinationCfg configures leases shared by FSS replicas.
+	CoordinationCfg struct {
+		InstanceID     string        `json:"instance_id"`
+		LeaderTTL      time.Duration `json:"-"`
+		UploadLeaseTTL time.Duration `json:"-"`
+	}
+
+	// TracingCfg selects the span exporter: none, stdout, file or otlp.
+	TracingCfg struct {
+		Exporter    string  `json:"exporter"`
+		Endpoint    string  `json:"endpoint"`
+		Insecure    bool    `json:"insecure"`
+		File        string  `json:"file"`
+		SampleRatio float64 `json:"sample_ratio"`
+	}
+
+	// LogCfg sets the log level and the json or console format.
+	LogCfg struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	}
+
 	ClientConfig struct {
 		Address string `json:"address"`
+		Token   string `json:"token"`
 	}
 )
 
@@ -74,6 +199,37 @@ func GetForFSS() (*FSSConfig, error) {
 	}
 
 	cfg.MigrationsPath = path.Join(envs.RootDir, envs.MigrationsPath)
+	if cfg.Keeper == nil {
+		cfg.Keeper = new(KeeperCfg)
+	}
+
+	if cfg.Placement == nil {
+		cfg.Placement = new(PlacementCfg)
+	}
+
+	if cfg.GC == nil {
+		cfg.GC = new(GCCfg)
+	}
+
+	if cfg.ReadCache == nil {
+		cfg.ReadCache = new(ReadCacheCfg)
+	}
+
+	if cfg.Quotas == nil {
+		cfg.Quotas = new(QuotasCfg)
+	}
+
+	if cfg.Coordination == nil {
+		cfg.Coordination = new(CoordinationCfg)
+	}
+
+	if cfg.Tracing == nil {
+		cfg.Tracing = new(TracingCfg)
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = new(LogCfg)
+	}
 
 	return cfg, nil
 }
@@ -81,7 +237,8 @@ func GetForFSS() (*FSSConfig, error) {
 func (c *FSSConfig) UnmarshalJSON(data []byte) error {
 	type Alias FSSConfig
 	aux := &struct {
-		Timeout string `json:"fs_timeout"`
+		Timeout         string `json:"fs_timeout"`
+		ShutdownTimeout string `json:"shutdown_timeout"`
 		*Alias
 	}{
 		Alias: (*Alias)(c),
@@ -98,6 +255,231 @@ func (c *FSSConfig) UnmarshalJSON(data []byte) error {
 
 	c.Timeout = duration
 
+	if c.ShutdownTimeout, err = parseShutdownTimeout(aux.ShutdownTimeout); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *FSConfig) UnmarshalJSON(data []byte) error {
+	type Alias FSConfig
+	aux := &struct {
+		ShutdownTimeout string `json:"shutdown_timeout"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+
+	var err error
+	if c.ShutdownTimeout, err = parseShutdownTimeout(aux.ShutdownTimeout); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func parseShutdownTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultShutdownTimeout, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parse shutdown_timeout: %w", err)
+	}
+
+	return duration, nil
+}
+
+func (c *KeeperCfg) UnmarshalJSON(data []byte) error {
+	type Alias KeeperCfg
+	aux := &struct {
+		BaseBackoff string `json:"base_backoff"`
+		MaxBackoff  string `json:"max_backoff"`
+		BaseTimeout string `json:"base_timeout"`
+		MaxTimeout  string `json:"max_timeout"`
+		HedgeDelay  string `json:"hedge_delay"`
+		OpenTimeout string `json:"breaker_open_timeout"`
+		IdleTimeout string `json:"idle_conn_timeout"`
+		DialTimeout string `json:"dial_timeout"`
+		KeepAlive   string `json:"keep_alive"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse keeper config: %w", err)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{name: "base_backoff", value: aux.BaseBackoff, dest: &c.BaseBackoff},
+		{name: "max_backoff", value: aux.MaxBackoff, dest: &c.MaxBackoff},
+		{name: "base_timeout", value: aux.BaseTimeout, dest: &c.BaseTimeout},
+		{name: "max_timeout", value: aux.MaxTimeout, dest: &c.MaxTimeout},
+		{name: "hedge_delay", value: aux.HedgeDelay, dest: &c.HedgeDelay},
+		{name: "breaker_open_timeout", value: aux.OpenTimeout, dest: &c.BreakerOpenTimeout},
+		{name: "idle_conn_timeout", value: aux.IdleTimeout, dest: &c.IdleConnTimeout},
+		{name: "dial_timeout", value: aux.DialTimeout, dest: &c.DialTimeout},
+		{name: "keep_alive", value: aux.KeepAlive, dest: &c.KeepAlive},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", d.name, err)
+		}
+
+		*d.dest = duration
+	}
+
+	return nil
+}
+
+func (c *HTTPCfg) UnmarshalJSON(data []byte) error {
+	type Alias HTTPCfg
+	aux := &struct {
+		DrainDelay string `json:"drain_delay"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse http config: %w", err)
+	}
+
+	if aux.DrainDelay == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(aux.DrainDelay)
+	if err != nil {
+		return fmt.Errorf("parse drain_delay: %w", err)
+	}
+
+	c.DrainDelay = duration
+
+	return nil
+}
+
+func (c *PlacementCfg) UnmarshalJSON(data []byte) error {
+	type Alias PlacementCfg
+	aux := &struct {
+		StatsTTL string `json:"stats_ttl"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse placement config: %w", err)
+	}
+
+	if aux.StatsTTL == "" {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(aux.StatsTTL)
+	if err != nil {
+		return fmt.Errorf("parse stats_ttl: %w", err)
+	}
+
+	c.StatsTTL = duration
+
+	return nil
+}
+
+func (c *GCCfg) UnmarshalJSON(data []byte) error {
+	type Alias GCCfg
+	aux := &struct {
+		Interval    string `json:"interval"`
+		StaleAfter  string `json:"stale_after"`
+		OrphanGrace string `json:"orphan_grace"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse gc config: %w", err)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{name: "interval", value: aux.Interval, dest: &c.Interval},
+		{name: "stale_after", value: aux.StaleAfter, dest: &c.StaleAfter},
+		{name: "orphan_grace", value: aux.OrphanGrace, dest: &c.OrphanGrace},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", d.name, err)
+		}
+
+		*d.dest = duration
+	}
+
+	return nil
+}
+
+func (c *CoordinationCfg) UnmarshalJSON(data []byte) error {
+	type Alias CoordinationCfg
+	aux := &struct {
+		LeaderTTL      string `json:"leader_ttl"`
+		UploadLeaseTTL string `json:"upload_lease_ttl"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("parse coordination config: %w", err)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{name: "leader_ttl", value: aux.LeaderTTL, dest: &c.LeaderTTL},
+		{name: "upload_lease_ttl", value: aux.UploadLeaseTTL, dest: &c.UploadLeaseTTL},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", d.name, err)
+		}
+
+		*d.dest = duration
+	}
+
 	return nil
 }
 
@@ -112,6 +494,14 @@ func GetForFS() (*FSConfig, error) {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
 
+	if cfg.Tracing == nil {
+		cfg.Tracing = new(TracingCfg)
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = new(LogCfg)
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,155 @@
+// Package coordination lets FSS replicas share work through leases kept in the metadata storage.
+package coordination
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// LeaderLease is the name of the lease held by the replica which runs background jobs.
+const LeaderLease = "leader"
+
+const (
+	defaultLeaderTTL = 30 * time.Second
+	releaseTimeout   = 5 * time.Second
+)
+
+// Store keeps leases. AcquireLease returns fss.ConflictError if the lease is
+// held by another holder and is not expired, the holder prolongs its own lease.
+type Store interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) error
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// UploadLease returns the name of the lease which guards the upload of the file.
+func UploadLease(filename string) string {
+	return "upload:" + filename
+}
+
+// NewHolder returns a holder id unique among replicas.
+func NewHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "fss"
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Lease is a named lease of one holder.
+type Lease struct {
+	store  Store
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+// NewLease creates lease, it is not acquired yet.
+func NewLease(store Store, name, holder string, ttl time.Duration) *Lease {
+	return &Lease{
+		store:  store,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+	}
+}
+
+// Acquire takes the lease or prolongs it for the TTL.
+func (l *Lease) Acquire(ctx context.Context) error {
+	return l.store.AcquireLease(ctx, l.name, l.holder, l.ttl)
+}
+
+// Release gives the lease up.
+func (l *Lease) Release(ctx context.Context) error {
+	return l.store.ReleaseLease(ctx, l.name, l.holder)
+}
+
+// Elector runs a job on the only replica which holds the leader lease.
+type Elector struct {
+	lease *Lease
+}
+
+// NewElector creates elector, ttl is the time the leadership survives a crashed leader.
+func NewElector(store Store, holder string, ttl time.Duration) *Elector {
+	if ttl == 0 {
+		ttl = defaultLeaderTTL
+	}
+
+	return &Elector{
+		lease: NewLease(store, LeaderLease, holder, ttl),
+	}
+}
+
+// Run tries to take the leadership every third of the TTL until ctx is done.
+// The job is started when the leadership is taken and its context is canceled
+// when the lease can't be prolonged.
+func (e *Elector) Run(ctx context.Context, job func(ctx context.Context)) {
+	ticker := time.NewTicker(e.lease.ttl / 3)
+	defer ticker.Stop()
+
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+
+	stop := func() {
+		if cancel != nil {
+			cancel()
+			<-done
+			cancel = nil
+		}
+	}
+
+	defer func() {
+		stop()
+
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer releaseCancel()
+
+		if err := e.lease.Release(releaseCtx); err != nil {
+			log.Error().Err(err).Msg("release leadership")
+		}
+	}()
+
+	for {
+		err := e.lease.Acquire(ctx)
+		switch {
+		case err == nil && cancel == nil:
+			log.Info().Str("holder", e.lease.holder).Msg("took leadership")
+
+			jobCtx, jobCancel := context.WithCancel(ctx)
+			cancel, done = jobCancel, make(chan struct{})
+
+			go func() {
+				defer close(done)
+				job(jobCtx)
+			}()
+
+		case err != nil && cancel != nil:
+			log.Error().Err(err).Msg("lost leadership")
+			stop()
+
+		case err != nil && !errors.As(err, &fss.ConflictError{}):
+			log.Error().Err(err).Msg("take leadership")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package coordination_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/internal/storagetest"
+)
+
+const testTTL = 30 * time.Millisecond
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.NewStorage()
+
+	a := coordination.NewLease(store, coordination.UploadLease("file"), "a", time.Minute)
+	b := coordination.NewLease(store, coordination.UploadLease("file"), "b", time.Minute)
+
+	assert.NoError(t, a.Acquire(ctx))
+	assert.ErrorAs(t, b.Acquire(ctx), &fss.ConflictError{})
+	assert.NoError(t, a.Release(ctx))
+	assert.NoError(t, b.Acquire(ctx))
+}
+
+func TestElector(t *testing.T) {
+	store := memstore.NewStorage()
+
+	var running, started atomic.Int32
+	job := func(ctx context.Context) {
+		started.Add(1)
+		running.Add(1)
+		defer running.Add(-1)
+
+		<-ctx.Done()
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		defer close(doneA)
+		coordination.NewElector(store, "a", testTTL).Run(ctxA, job)
+	}()
+
+	assert.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+
+	go coordination.NewElector(store, "b", testTTL).Run(ctxB, job)
+
+	time.Sleep(3 * testTTL)
+	assert.Equal(t, int32(1), running.Load())
+	assert.Equal(t, int32(1), started.Load())
+
+	// The leader releases the lease on exit, so the follower takes over.
+	cancelA()
+	<-doneA
+
+	assert.Eventually(t, func() bool { return started.Load() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), running.Load())
+}
+
+func TestElectorLosesLeadership(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := storagetest.NewFaultyStorage(memstore.NewStorage())
+	started, stopped := make(chan struct{}), make(chan struct{})
+
+	go coordination.NewElector(store, "a", testTTL).Run(ctx, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	<-started
+	store.Fail("AcquireLease", errors.New("injected"))
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("job is not stopped")
+	}
+}
@@ -0,0 +1,228 @@
+package dm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+const (
+	defaultStatsTTL = 30 * time.Second
+
+	// capacityLevels is the number of steps free capacity scales server weight by.
+	capacityLevels = 8
+
+	// maxBatchSlots bounds fragments of a batch, they are kept in memory until all of them are stored.
+	maxBatchSlots = 32
+)
+
+// StatsSource reports usage and availability of file servers.
+type StatsSource interface {
+	ServerStats(ctx context.Context, serverURL string) (*fss.ServerStats, error)
+	// Available reports whether the circuit breaker of the server lets requests through.
+	Available(serverURL string) bool
+}
+
+type cachedStats struct {
+	stats     *fss.ServerStats
+	fetchedAt time.Time
+}
+
+// statsCache keeps stats of file servers to avoid asking them on every upload.
+type statsCache struct {
+	source StatsSource
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	stats map[string]cachedStats
+}
+
+func newStatsCache(source StatsSource, ttl time.Duration) *statsCache {
+	if ttl == 0 {
+		ttl = defaultStatsTTL
+	}
+
+	return &statsCache{
+		source: source,
+		ttl:    ttl,
+		stats:  make(map[string]cachedStats),
+	}
+}
+
+// get returns stats of the server or nil if they are unknown.
+func (c *statsCache) get(ctx context.Context, serverURL string) *fss.ServerStats {
+	if c.source == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	cached, ok := c.stats[serverURL]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.stats
+	}
+
+	stats, err := c.source.ServerStats(ctx, serverURL)
+	if err != nil {
+		log.Info().Err(err).Str("server", serverURL).Msg("failed to get server stats")
+	}
+
+	c.mu.Lock()
+	c.stats[serverURL] = cachedStats{stats: stats, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return stats
+}
+
+// availableServers drops servers which circuit breakers are open.
+func (s *Service) availableServers(servers []fss.Server) []fss.Server {
+	if s.stats.source == nil {
+		return servers
+	}
+
+	available := make([]fss.Server, 0, len(servers))
+	for _, server := range servers {
+		if s.stats.source.Available(server.URL) {
+			available = append(available, server)
+		}
+	}
+
+	return available
+}
+
+// weighServers scales weights of the servers by their free capacity and drops
+// full servers. Free capacity is taken from reported stats, then from the
+// declared capacity; servers with unknown capacity count as the most free ones.
+func (s *Service) weighServers(ctx context.Context, servers []fss.Server) []fss.Server {
+	free := make([]int64, len(servers))
+	var maxFree int64
+	for i, server := range servers {
+		free[i] = -1
+		if stats := s.stats.get(ctx, server.URL); stats != nil && stats.Capacity > 0 {
+			free[i] = stats.Free
+		} else if server.Capacity > 0 {
+			free[i] = server.Capacity
+		}
+
+		maxFree = max(maxFree, free[i])
+	}
+
+	weighted := make([]fss.Server, 0, len(servers))
+	for i, server := range servers {
+		server.Weight = max(server.Weight, 1)
+		switch {
+		case free[i] == 0:
+			continue
+
+		case free[i] > 0:
+			// Round up so that every server with free space keeps at least one level.
+			server.Weight *= int((free[i]*capacityLevels + maxFree - 1) / maxFree)
+
+		case maxFree > 0:
+			server.Weight *= capacityLevels
+		}
+
+		weighted = append(weighted, server)
+	}
+
+	return weighted
+}
+
+// BatchSlots returns the servers of consecutive fragments of one batch. Every server
+// gets fragments in proportion to its weight, interleaved with fragments of other
+// servers, and the batch starts with the first server of the placement.
+func BatchSlots(servers []fss.Server) []fss.Server {
+	if len(servers) == 0 {
+		return nil
+	}
+
+	weights := make([]int, len(servers))
+	divisor := 0
+	for i, server := range servers {
+		weights[i] = max(server.Weight, 1)
+		divisor = gcd(divisor, weights[i])
+	}
+
+	total := 0
+	for i := range weights {
+		weights[i] /= divisor
+		total += weights[i]
+	}
+
+	if total > maxBatchSlots && len(servers) < maxBatchSlots {
+		scaled := 0
+		for i := range weights {
+			weights[i] = max(weights[i]*maxBatchSlots/total, 1)
+			scaled += weights[i]
+		}
+
+		total = scaled
+	}
+
+	// Smooth weighted round robin interleaves servers by weight.
+	slots := make([]fss.Server, 0, total)
+	current := make([]int, len(servers))
+	first := -1
+	for len(slots) < total {
+		best := 0
+		for i := range current {
+			current[i] += weights[i]
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+
+		current[best] -= total
+		if best == 0 && first < 0 {
+			first = len(slots)
+		}
+
+		slots = append(slots, servers[best])
+	}
+
+	return append(slots[first:], slots[:first]...)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// spreadZones reorders servers so that neighbours are in different failure
+// domains while possible. Fragments of a batch, and replicas placed on the
+// following servers, don't share a zone. Order inside a zone is kept.
+func spreadZones(servers []fss.Server) []fss.Server {
+	var zones []string
+	byZone := make(map[string][]fss.Server)
+	for _, server := range servers {
+		if _, ok := byZone[server.Zone]; !ok {
+			zones = append(zones, server.Zone)
+		}
+
+		byZone[server.Zone] = append(byZone[server.Zone], server)
+	}
+
+	if len(zones) < 2 {
+		return servers
+	}
+
+	spread := make([]fss.Server, 0, len(servers))
+	for len(spread) < len(servers) {
+		for _, zone := range zones {
+			if rest := byZone[zone]; len(rest) > 0 {
+				spread = append(spread, rest[0])
+				byZone[zone] = rest[1:]
+			}
+		}
+	}
+
+	return spread
+}
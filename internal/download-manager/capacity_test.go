@@ -0,0 +1,154 @@
+package dm_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+func TestStartSavingSpreadsZones(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	for i, zone := range []string{"rack-1", "rack-1", "rack-1", "rack-2", "rack-2", "rack-3"} {
+		server := fss.Server{URL: fmt.Sprintf("http://fs-%d", i), Weight: 1, Zone: zone}
+		assert.NoError(t, storage.CreateServer(ctx, server))
+	}
+
+	s, err := dm.New(storage, nil, dm.Config{Timeout: testTimeout, Placement: dm.PlacementRendezvous})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 20; i++ {
+		servers, _, err := s.StartSaving(ctx, fmt.Sprintf("file_%d", i), dm.Precondition{})
+		if !assert.NoError(t, err) || !assert.Len(t, servers, 6) {
+			return
+		}
+
+		zones := make(map[string]bool)
+		for _, server := range servers[:3] {
+			zones[server.Zone] = true
+		}
+
+		assert.Len(t, zones, 3, "first servers must be in different zones")
+	}
+}
+
+func TestStartSavingUsesFreeCapacity(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	stats := memstore.NewFragmentStore()
+	for i, capacity := range []int64{1000, 1000, 100, 10} {
+		uri := fmt.Sprintf("http://fs-%d", i)
+		assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: uri, Weight: 1}))
+		stats.SetCapacity(uri, capacity)
+	}
+
+	// The last server is full.
+	assert.NoError(t, stats.StoreFragment(ctx, "http://fs-3", "fragment", make([]byte, 10)))
+
+	s, err := dm.New(storage, stats, dm.Config{Timeout: testTimeout, Placement: dm.PlacementRendezvous})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	first := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		servers, _, err := s.StartSaving(ctx, fmt.Sprintf("file_%d", i), dm.Precondition{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Len(t, servers, 3)
+		first[servers[0].URL]++
+	}
+
+	assert.Zero(t, first["http://fs-3"])
+	assert.Greater(t, first["http://fs-0"], 3*first["http://fs-2"])
+	assert.Greater(t, first["http://fs-1"], 3*first["http://fs-2"])
+}
+
+func TestStartSavingSkipsUnavailableServers(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	stats := memstore.NewFragmentStore()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: fmt.Sprintf("http://fs-%d", i), Weight: 1}))
+	}
+
+	s, err := dm.New(storage, stats, dm.Config{Timeout: testTimeout})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	stats.SetUnavailable("http://fs-1", true)
+	servers, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	if assert.NoError(t, err) && assert.Len(t, servers, 2) {
+		for _, server := range servers {
+			assert.NotEqual(t, "http://fs-1", server.URL)
+		}
+	}
+
+	stats.SetUnavailable("http://fs-0", true)
+	stats.SetUnavailable("http://fs-2", true)
+	_, _, err = s.StartSaving(ctx, "other", dm.Precondition{})
+	assert.ErrorAs(t, err, &fss.UnavailableError{})
+}
+
+func TestBatchSlots(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		// counts of every server in the batch.
+		counts []int
+	}{
+		{name: "equal weights", weights: []int{1, 1, 1}, counts: []int{1, 1, 1}},
+		{name: "common divisor", weights: []int{8, 8, 16}, counts: []int{1, 1, 2}},
+		{name: "proportional", weights: []int{2, 8}, counts: []int{1, 4}},
+		{name: "light server first", weights: []int{1, 3, 2}, counts: []int{1, 3, 2}},
+		{name: "unset weight", weights: []int{0, 2}, counts: []int{1, 2}},
+		{name: "bounded batch", weights: []int{100, 1}, counts: []int{31, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := testServers(len(tt.weights))
+			for i, weight := range tt.weights {
+				servers[i].Weight = weight
+			}
+
+			slots := dm.BatchSlots(servers)
+			assert.Equal(t, servers[0], slots[0], "the batch starts with the first server")
+
+			counts := make([]int, len(servers))
+			for _, slot := range slots {
+				counts[slot.ID-1]++
+			}
+
+			assert.Equal(t, tt.counts, counts)
+		})
+	}
+}
+
+func TestCreateServerValidation(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 0)
+
+	assert.ErrorAs(t, s.CreateServer(ctx, fss.Server{}), &fss.ValidationError{})
+	assert.ErrorAs(t, s.CreateServer(ctx, fss.Server{URL: "http://fs", Weight: -1}), &fss.ValidationError{})
+	assert.ErrorAs(t, s.CreateServer(ctx, fss.Server{URL: "http://fs", Capacity: -1}), &fss.ValidationError{})
+
+	assert.NoError(t, s.CreateServer(ctx, fss.Server{URL: "http://fs", Zone: "rack-1"}))
+
+	servers, err := storage.Servers(ctx, 1)
+	if assert.NoError(t, err) && assert.Len(t, servers, 1) {
+		assert.Equal(t, 1, servers[0].Weight)
+		assert.Equal(t, "rack-1", servers[0].Zone)
+	}
+}
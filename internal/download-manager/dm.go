@@ -2,39 +2,139 @@ package dm
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Tsapen/fss/internal/coordination"
 	"github.com/Tsapen/fss/internal/fss"
 )
 
 type Metadata struct {
-	ServerURLs []string
-	PartNum    int
+	Fragments []fss.Fragment
+	// ETag identifies the content, it is empty for files uploaded before etags.
+	ETag string
+	// CommittedAt changes when the file is overwritten.
+	CommittedAt time.Time
+}
+
+// Precondition restricts an upload by the state of the stored file.
+type Precondition struct {
+	// IfMatch lists etags one of which the committed file must have, "*" matches any.
+	IfMatch []string
+	// IfNoneMatch allows only creation of a new file.
+	IfNoneMatch bool
+}
+
+func (p Precondition) matches(etag *string) bool {
+	for _, m := range p.IfMatch {
+		if m == "*" || etag != nil && m == *etag {
+			return true
+		}
+	}
+
+	return false
 }
 
 type Storage interface {
-	CreateFile(ctx context.Context, filename string) (int64, error)
+	CreateFile(ctx context.Context, filename, placement string) (int64, error)
 	File(ctx context.Context, name string) (*fss.File, error)
 	UpdateFile(ctx context.Context, f *fss.File) (err error)
 	DeleteFile(ctx context.Context, name string) error
+	StaleFiles(ctx context.Context, committedBefore time.Time, limit int) ([]fss.File, error)
+	Files(ctx context.Context, prefix, after string, limit int) ([]fss.File, error)
 	Servers(ctx context.Context, last int64) ([]fss.Server, error)
-	CreateServer(ctx context.Context, uri string) error
+	CreateServer(ctx context.Context, server fss.Server) error
+	Server(ctx context.Context, id int64) (*fss.Server, error)
+	UpdateServer(ctx context.Context, server fss.Server) error
+	DeleteServer(ctx context.Context, id int64) error
+	CreateFragments(ctx context.Context, fragments []fss.Fragment) error
+	Fragments(ctx context.Context, filename string) ([]fss.Fragment, error)
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) error
+	ReleaseLease(ctx context.Context, name, holder string) error
+	BucketUsage(ctx context.Context, bucket string) (*fss.Usage, error)
+	Usage(ctx context.Context) ([]fss.Usage, error)
+	SaveJob(ctx context.Context, job fss.Job) error
+	Job(ctx context.Context, id string) (*fss.Job, error)
+	Jobs(ctx context.Context, limit int) ([]fss.Job, error)
+}
+
+// Config contains settings of the service.
+type Config struct {
+	Timeout time.Duration
+
+	// Placement is a name of the default placement strategy,
+	// BucketPlacement overrides it for buckets, the first segment of a filename.
+	Placement       string
+	BucketPlacement map[string]string
+
+	// StatsTTL is how long reported server stats are reused by placement.
+	StatsTTL time.Duration
+
+	// Quota limits buckets, BucketQuotas override it for buckets.
+	Quota        Quota
+	BucketQuotas map[string]Quota
+
+	// Holder identifies the replica in upload leases, UploadLeaseTTL is how long
+	// an upload keeps its file name without a committed batch, 2*Timeout by default.
+	Holder         string
+	UploadLeaseTTL time.Duration
 }
 
 type Service struct {
-	storage Storage
-	timeout time.Duration
+	storage   Storage
+	timeout   time.Duration
+	placement PlacementStrategy
+	buckets   map[string]PlacementStrategy
+	stats     *statsCache
+
+	quota        Quota
+	bucketQuotas map[string]Quota
+
+	holder    string
+	leaseTTL  time.Duration
+	uploadSeq atomic.Int64
+	mu        sync.Mutex
+	uploads   map[string]*coordination.Lease
 }
 
-func New(storage Storage, timeout time.Duration) *Service {
-	return &Service{
-		storage: storage,
-		timeout: timeout,
+// New creates the service, stats may be nil if file servers usage is unknown.
+func New(storage Storage, stats StatsSource, cfg Config) (*Service, error) {
+	placement, err := Strategy(cfg.Placement)
+	if err != nil {
+		return nil, fmt.Errorf("get placement strategy: %w", err)
 	}
+
+	buckets := make(map[string]PlacementStrategy, len(cfg.BucketPlacement))
+	for bucket, name := range cfg.BucketPlacement {
+		if buckets[bucket], err = Strategy(name); err != nil {
+			return nil, fmt.Errorf("get placement strategy of bucket '%s': %w", bucket, err)
+		}
+	}
+
+	if cfg.Holder == "" {
+		cfg.Holder = coordination.NewHolder()
+	}
+
+	if cfg.UploadLeaseTTL == 0 {
+		cfg.UploadLeaseTTL = 2 * cfg.Timeout
+	}
+
+	return &Service{
+		storage:      storage,
+		timeout:      cfg.Timeout,
+		placement:    placement,
+		buckets:      buckets,
+		stats:        newStatsCache(stats, cfg.StatsTTL),
+		quota:        cfg.Quota,
+		bucketQuotas: cfg.BucketQuotas,
+		holder:       cfg.Holder,
+		leaseTTL:     cfg.UploadLeaseTTL,
+		uploads:      make(map[string]*coordination.Lease),
+	}, nil
 }
 
 func (s *Service) Metadata(ctx context.Context, filename string) (*Metadata, error) {
@@ -43,112 +143,345 @@ func (s *Service) Metadata(ctx context.Context, filename string) (*Metadata, err
 		return nil, fmt.Errorf("get file: %w", err)
 	}
 
-	if f.Fragments == nil {
-		return nil, fmt.Errorf("file is not committed")
+	fragments, err := s.fileFragments(ctx, f)
+	if err != nil {
+		return nil, err
 	}
 
-	serverURLs, err := s.orderedServerURLs(ctx, f.Name, f.LastServerID)
-	if err != nil {
-		return nil, fmt.Errorf("get ordered server urls: %w", err)
+	for _, f := range fragments {
+		if f.ServerMode == fss.ServerModeDisabled {
+			return nil, fss.NewUnavailableError("server '%s' is disabled", f.ServerURL)
+		}
 	}
 
-	return &Metadata{
-		ServerURLs: serverURLs,
-		PartNum:    *f.Fragments,
-	}, nil
+	m := &Metadata{
+		Fragments: fragments,
+	}
+
+	if f.ETag != nil {
+		m.ETag = *f.ETag
+	}
+
+	if f.LastCommittedAt != nil {
+		m.CommittedAt = *f.LastCommittedAt
+	}
+
+	return m, nil
 }
 
-func (s *Service) StartSaving(ctx context.Context, filename string) ([]string, error) {
-	lastServerID, err := s.storage.CreateFile(ctx, filename)
+// StartSaving takes the upload lease of the file and returns servers for its fragments
+// with the file version which names them. An uncommitted file left by an upload which
+// lost its lease is replaced, a committed one is replaced only if it matches cond.IfMatch
+// and stays readable until the upload is committed.
+func (s *Service) StartSaving(ctx context.Context, filename string, cond Precondition) (_ []fss.Server, _ int64, err error) {
+	lease := coordination.NewLease(s.storage, coordination.UploadLease(filename), s.uploadHolder(), s.leaseTTL)
+	err = lease.Acquire(ctx)
 	if errors.As(err, &fss.ConflictError{}) {
-		if err := s.deleteFile(ctx, filename); err != nil {
-			return nil, fmt.Errorf("delete file: %w", err)
+		return nil, 0, fss.NewLockedError("file '%s' is being uploaded", filename)
+	}
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("acquire upload lease: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fss.HandleErrPair(lease.Release(ctx), err)
 		}
+	}()
+
+	placement := s.bucketPlacement(filename)
 
-		lastServerID, err = s.storage.CreateFile(ctx, filename)
+	version, err := s.replaceFile(ctx, filename, cond)
+	if err != nil {
+		return nil, 0, err
 	}
 
+	lastServerID := int64(math.MaxInt64)
+	if version == 0 {
+		if lastServerID, err = s.storage.CreateFile(ctx, filename, placement.Name()); err != nil {
+			return nil, 0, fmt.Errorf("create file metadata: %w", err)
+		}
+	}
+
+	servers, err := s.storage.Servers(ctx, lastServerID)
 	if err != nil {
-		return nil, fmt.Errorf("create file metadata: %w", err)
+		return nil, 0, fmt.Errorf("get servers: %w", err)
+	}
+
+	servers = writableServers(servers)
+	if len(servers) == 0 {
+		return nil, 0, fmt.Errorf("empty servers list")
 	}
 
-	serverURLS, err := s.orderedServerURLs(ctx, filename, lastServerID)
+	servers = s.weighServers(ctx, s.availableServers(servers))
+	if len(servers) == 0 {
+		return nil, 0, fss.NewUnavailableError("no file server is available")
+	}
+
+	s.mu.Lock()
+	s.uploads[filename] = lease
+	s.mu.Unlock()
+
+	return spreadZones(placement.Place(filename, servers)), version, nil
+}
+
+// replaceFile checks cond against the stored file and returns the version of the upload.
+// An uncommitted file is deleted and the upload creates the file anew with version 0.
+// A committed file is kept, the upload stores the next version of it. The caller holds
+// the upload lease, so uncommitted files and versions are left by uploads which lost their lease.
+func (s *Service) replaceFile(ctx context.Context, filename string, cond Precondition) (int64, error) {
+	f, err := s.storage.File(ctx, filename)
+	switch {
+	case errors.As(err, &fss.NotFoundError{}):
+		if len(cond.IfMatch) > 0 {
+			return 0, fss.NewPreconditionFailedError("file '%s' doesn't exist", filename)
+		}
+
+		return 0, nil
+
+	case err != nil:
+		return 0, fmt.Errorf("get metadata: %w", err)
+
+	case f.Fragments == nil:
+		if len(cond.IfMatch) > 0 {
+			return 0, fss.NewPreconditionFailedError("file '%s' is not committed", filename)
+		}
+
+		if err := s.storage.DeleteFile(ctx, filename); err != nil {
+			return 0, fmt.Errorf("delete file: %w", err)
+		}
+
+		return 0, nil
+
+	case cond.IfNoneMatch:
+		return 0, fss.NewPreconditionFailedError("file '%s' exists", filename)
+
+	case len(cond.IfMatch) == 0:
+		return 0, fss.NewConflictError("file '%s' exists", filename)
+
+	case !cond.matches(f.ETag):
+		return 0, fss.NewPreconditionFailedError("etag of file '%s' doesn't match", filename)
+	}
+
+	now := time.Now()
+	version := f.Version + 1
+	f.UploadVersion = &version
+	f.UploadSize = nil
+	f.UploadCommittedAt = &now
+	if err := s.storage.UpdateFile(ctx, f); err != nil {
+		return 0, fmt.Errorf("start version: %w", err)
+	}
+
+	return version, nil
+}
+
+// RollbackFile deletes the file or the uploaded version of the replaced file if the upload still holds its lease.
+func (s *Service) RollbackFile(ctx context.Context, filename string) error {
+	lease, err := s.finishUpload(filename)
 	if err != nil {
-		return nil, fmt.Errorf("get ordered servers list: %w", err)
+		return err
+	}
+
+	if err := lease.Acquire(ctx); err != nil {
+		return fmt.Errorf("prolong upload lease: %w", err)
 	}
 
-	return serverURLS, nil
+	return fss.HandleErrPair(lease.Release(ctx), s.dropUpload(ctx, filename))
 }
 
-func (s *Service) deleteFile(ctx context.Context, filename string) error {
+func (s *Service) dropUpload(ctx context.Context, filename string) error {
 	f, err := s.storage.File(ctx, filename)
 	if err != nil {
-		return fmt.Errorf("get metadata: %w", err)
+		return fmt.Errorf("get file: %w", err)
 	}
 
-	if f.Fragments == nil && f.LastCommittedAt != nil && time.Since(*f.LastCommittedAt) > 2*s.timeout {
+	if f.UploadVersion == nil {
 		return s.storage.DeleteFile(ctx, filename)
 	}
 
-	return nil
+	f.UploadVersion, f.UploadSize, f.UploadCommittedAt = nil, nil, nil
+
+	return s.storage.UpdateFile(ctx, f)
 }
 
-func (s *Service) RollbackFile(ctx context.Context, filename string) error {
-	return s.storage.DeleteFile(ctx, filename)
+// CommitBatch records placement of the stored fragments and the bytes stored so far, and prolongs the upload.
+// It fails with QuotaExceededError if the bucket of the file exceeds its hard quota with the batch.
+func (s *Service) CommitBatch(ctx context.Context, filename string, fragments []fss.Fragment, stored int64) error {
+	lease, err := s.upload(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := lease.Acquire(ctx); err != nil {
+		return fmt.Errorf("prolong upload lease: %w", err)
+	}
+
+	if err := s.storage.CreateFragments(ctx, fragments); err != nil {
+		return fmt.Errorf("create fragments: %w", err)
+	}
+
+	f, err := s.storage.File(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("get file: %w", err)
+	}
+
+	now := time.Now()
+	if f.UploadVersion != nil {
+		f.UploadCommittedAt, f.UploadSize = &now, &stored
+	} else {
+		f.LastCommittedAt, f.Size = &now, &stored
+	}
+
+	if err := s.storage.UpdateFile(ctx, f); err != nil {
+		return err
+	}
+
+	return s.checkQuota(ctx, filename)
 }
 
-func (s *Service) CommitBatch(ctx context.Context, filename string) error {
+// CommitFile marks the file as committed with its size and content etag and releases its upload lease.
+// It returns fragments of the replaced version for removal from file servers.
+func (s *Service) CommitFile(ctx context.Context, filename string, fragmentsNum int, size int64, etag string) (_ []fss.Fragment, err error) {
+	lease, err := s.finishUpload(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lease.Acquire(ctx); err != nil {
+		return nil, fmt.Errorf("prolong upload lease: %w", err)
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(lease.Release(ctx), err)
+	}()
+
+	f, err := s.storage.File(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+
+	var replaced []fss.Fragment
+	if f.UploadVersion != nil {
+		if replaced, err = s.fileFragments(ctx, f); err != nil {
+			return nil, err
+		}
+
+		f.Version = *f.UploadVersion
+		f.UploadVersion, f.UploadSize, f.UploadCommittedAt = nil, nil, nil
+	}
+
+	// The commit time tells versions of the file apart, e.g. in the read cache.
 	now := time.Now()
+	f.LastCommittedAt = &now
+	f.Fragments = &fragmentsNum
+	f.ETag = &etag
+	f.Size = &size
+	if err := s.storage.UpdateFile(ctx, f); err != nil {
+		return nil, err
+	}
 
-	return s.storage.UpdateFile(ctx, &fss.File{
-		Name:            filename,
-		LastCommittedAt: &now,
-	})
+	return replaced, nil
 }
 
-func (s *Service) CommitFile(ctx context.Context, filename string, fragmentsNum int) error {
-	return s.storage.UpdateFile(ctx, &fss.File{
-		Name:            filename,
-		LastCommittedAt: nil,
-		Fragments:       &fragmentsNum,
-	})
+// uploadHolder returns a holder of one upload, uploads of a replica must not share leases.
+func (s *Service) uploadHolder() string {
+	return fmt.Sprintf("%s/%d", s.holder, s.uploadSeq.Add(1))
 }
 
-func (s *Service) orderedServerURLs(ctx context.Context, filename string, lastServerID int64) ([]string, error) {
-	servers, err := s.storage.Servers(ctx, lastServerID)
-	if err != nil {
-		return nil, fmt.Errorf("get servers: %w", err)
+func (s *Service) upload(filename string) (*coordination.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.uploads[filename]
+	if !ok {
+		return nil, fss.NewConflictError("upload of '%s' is not started", filename)
 	}
 
-	if len(servers) == 0 {
-		return nil, fmt.Errorf("empty servers list")
+	return lease, nil
+}
+
+func (s *Service) finishUpload(filename string) (*coordination.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.uploads[filename]
+	if !ok {
+		return nil, fss.NewConflictError("upload of '%s' is not started", filename)
+	}
+
+	delete(s.uploads, filename)
+
+	return lease, nil
+}
+
+// fileFragments returns placement of fragments of the committed file.
+func (s *Service) fileFragments(ctx context.Context, f *fss.File) ([]fss.Fragment, error) {
+	if f.Fragments == nil {
+		return nil, fss.NewConflictError("file '%s' is not committed", f.Name)
 	}
 
-	filenameHash, err := s.hash(filename, len(servers))
+	fragments, err := s.storage.Fragments(ctx, f.Name)
 	if err != nil {
-		return nil, fmt.Errorf("get hash: %w", err)
+		return nil, fmt.Errorf("get fragments: %w", err)
 	}
 
-	serverURLs := make([]string, 0, len(servers))
-	for i := 0; i < len(servers); i++ {
-		serverURLs = append(serverURLs, servers[(i+filenameHash)%len(servers)].URL)
+	if len(fragments) == 0 && *f.Fragments > 0 {
+		// Files committed before fragments were recorded keep the legacy placement.
+		if fragments, err = s.legacyFragments(ctx, f); err != nil {
+			return nil, fmt.Errorf("get legacy fragments: %w", err)
+		}
 	}
 
-	return serverURLs, nil
+	return fragments, nil
 }
 
-func (s *Service) hash(inputString string, leng int) (int, error) {
-	hasher := sha256.New()
-	hasher.Write([]byte(inputString))
+func (s *Service) legacyFragments(ctx context.Context, f *fss.File) ([]fss.Fragment, error) {
+	placement, err := Strategy(f.Placement)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := s.orderedServers(ctx, placement, f.Name, f.LastServerID)
+	if err != nil {
+		return nil, err
+	}
+
+	fragments := make([]fss.Fragment, 0, *f.Fragments)
+	for i := 0; i < *f.Fragments; i++ {
+		server := servers[i%len(servers)]
+		fragments = append(fragments, fss.Fragment{
+			FileName:   f.Name,
+			Version:    f.Version,
+			Index:      i,
+			ServerID:   server.ID,
+			ServerURL:  server.URL,
+			ServerMode: server.Mode,
+			State:      fss.FragmentStateStored,
+		})
+	}
+
+	return fragments, nil
+}
 
-	result, err := hex.DecodeString(hex.EncodeToString(hasher.Sum(nil)))
+func (s *Service) orderedServers(ctx context.Context, placement PlacementStrategy, filename string, lastServerID int64) ([]fss.Server, error) {
+	servers, err := s.storage.Servers(ctx, lastServerID)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("get servers: %w", err)
 	}
 
-	return int(result[0]) % leng, nil
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("empty servers list")
+	}
+
+	return placement.Place(filename, servers), nil
 }
 
-func (s *Service) CreateServer(ctx context.Context, uri string) error {
-	return s.storage.CreateServer(ctx, uri)
+// bucketPlacement returns placement strategy of the bucket of the file.
+func (s *Service) bucketPlacement(filename string) PlacementStrategy {
+	if placement, ok := s.buckets[fss.Bucket(filename)]; ok {
+		return placement
+	}
+
+	return s.placement
 }
@@ -0,0 +1,342 @@
+package dm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/internal/storagetest"
+)
+
+const testTimeout = time.Second
+
+var errInjected = errors.New("injected")
+
+func newService(t *testing.T, serversNum int) (*dm.Service, *storagetest.FaultyStorage) {
+	storage := storagetest.NewFaultyStorage(memstore.NewStorage())
+	for i := 0; i < serversNum; i++ {
+		if err := storage.CreateServer(context.Background(), fss.Server{URL: "http://fs-" + string(rune('1'+i)), Weight: 1}); err != nil {
+			t.Fatalf("create server: %v", err)
+		}
+	}
+
+	s, err := dm.New(storage, nil, dm.Config{Timeout: testTimeout})
+	if err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+
+	return s, storage
+}
+
+func TestStartSavingErrors(t *testing.T) {
+	ctx := context.Background()
+
+	commit := func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+		_, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+		assert.NoError(t, err)
+		_, err = s.CommitFile(ctx, "file", 0, 0, "etag")
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage)
+		cond    dm.Precondition
+		wantErr error
+	}{
+		{
+			name: "create file fails",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+				storage.Fail("CreateFile", errInjected)
+			},
+			wantErr: errInjected,
+		},
+		{
+			name: "get servers fails",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+				storage.Fail("Servers", errInjected)
+			},
+			wantErr: errInjected,
+		},
+		{
+			name: "active upload",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+				_, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+				assert.NoError(t, err)
+			},
+			wantErr: fss.LockedError{},
+		},
+		{
+			name: "acquire lease fails",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+				storage.Fail("AcquireLease", errInjected)
+			},
+			wantErr: errInjected,
+		},
+		{
+			name: "lookup of conflicting file fails",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {
+				_, err := storage.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+				assert.NoError(t, err)
+
+				storage.Fail("File", errInjected)
+			},
+			wantErr: errInjected,
+		},
+		{
+			name:    "committed file exists",
+			prepare: commit,
+			wantErr: fss.ConflictError{},
+		},
+		{
+			name:    "create only",
+			prepare: commit,
+			cond:    dm.Precondition{IfNoneMatch: true},
+			wantErr: fss.PreconditionFailedError{},
+		},
+		{
+			name:    "etag doesn't match",
+			prepare: commit,
+			cond:    dm.Precondition{IfMatch: []string{"other"}},
+			wantErr: fss.PreconditionFailedError{},
+		},
+		{
+			name:    "overwrite of missing file",
+			prepare: func(t *testing.T, s *dm.Service, storage *storagetest.FaultyStorage) {},
+			cond:    dm.Precondition{IfMatch: []string{"*"}},
+			wantErr: fss.PreconditionFailedError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, storage := newService(t, 3)
+			tt.prepare(t, s, storage)
+
+			_, _, err := s.StartSaving(ctx, "file", tt.cond)
+			switch target := tt.wantErr.(type) {
+			case fss.LockedError:
+				assert.ErrorAs(t, err, &target)
+			case fss.ConflictError:
+				assert.ErrorAs(t, err, &target)
+			case fss.PreconditionFailedError:
+				assert.ErrorAs(t, err, &target)
+			default:
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartSavingOverwrite(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newService(t, 3)
+
+	_, _, err := s.StartSaving(ctx, "file", dm.Precondition{IfNoneMatch: true})
+	assert.NoError(t, err)
+	_, err = s.CommitFile(ctx, "file", 0, 0, "v1")
+	assert.NoError(t, err)
+
+	for _, etags := range [][]string{{"other", "v1"}, {"*"}} {
+		_, _, err = s.StartSaving(ctx, "file", dm.Precondition{IfMatch: etags})
+		assert.NoError(t, err)
+		_, err = s.CommitFile(ctx, "file", 0, 0, "v1")
+		assert.NoError(t, err)
+	}
+
+	m, err := s.Metadata(ctx, "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v1", m.ETag)
+	}
+}
+
+func TestReplacedFileStaysReadable(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newService(t, 3)
+
+	_, version, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+	assert.Zero(t, version)
+	_, err = s.CommitFile(ctx, "file", 0, 0, "v1")
+	assert.NoError(t, err)
+
+	_, version, err = s.StartSaving(ctx, "file", dm.Precondition{IfMatch: []string{"v1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	m, err := s.Metadata(ctx, "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v1", m.ETag, "the file is readable while it is replaced")
+	}
+
+	assert.NoError(t, s.RollbackFile(ctx, "file"))
+
+	m, err = s.Metadata(ctx, "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v1", m.ETag, "rollback keeps the replaced file")
+	}
+
+	_, version, err = s.StartSaving(ctx, "file", dm.Precondition{IfMatch: []string{"v1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	_, err = s.CommitFile(ctx, "file", 0, 0, "v2")
+	assert.NoError(t, err)
+
+	m, err = s.Metadata(ctx, "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "v2", m.ETag)
+	}
+}
+
+func TestStartSavingWithoutServers(t *testing.T) {
+	s, _ := newService(t, 0)
+
+	_, _, err := s.StartSaving(context.Background(), "file", dm.Precondition{})
+	assert.Error(t, err)
+}
+
+func TestStartSavingReplacesAbandonedUpload(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 3)
+
+	crashed, err := dm.New(storage, nil, dm.Config{Timeout: testTimeout, UploadLeaseTTL: time.Millisecond})
+	assert.NoError(t, err)
+
+	_, _, err = crashed.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	servers, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+	assert.Len(t, servers, 3)
+
+	// The lease is lost, so the crashed upload can't commit or roll back the new one.
+	assert.ErrorAs(t, crashed.CommitBatch(ctx, "file", nil, 0), &fss.ConflictError{})
+	assert.ErrorAs(t, crashed.RollbackFile(ctx, "file"), &fss.ConflictError{})
+	_, err = s.CommitFile(ctx, "file", 0, 0, "etag")
+	assert.NoError(t, err)
+
+	_, _, err = s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.ErrorAs(t, err, &fss.ConflictError{})
+}
+
+func TestStartSavingAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 3)
+
+	replica, err := dm.New(storage, nil, dm.Config{Timeout: testTimeout})
+	assert.NoError(t, err)
+
+	_, _, err = replica.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+
+	_, _, err = s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.ErrorAs(t, err, &fss.LockedError{})
+
+	assert.NoError(t, replica.RollbackFile(ctx, "file"))
+
+	_, _, err = s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+}
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 3)
+
+	_, err := s.Metadata(ctx, "missing")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	servers, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+
+	_, err = s.Metadata(ctx, "file")
+	assert.Error(t, err, "file is not committed")
+
+	size, checksum := int64(4), "checksum"
+	fragments := make([]fss.Fragment, 0, 2)
+	for i, server := range servers[:2] {
+		fragments = append(fragments, fss.Fragment{
+			FileName:  "file",
+			Index:     i,
+			ServerID:  server.ID,
+			ServerURL: server.URL,
+			Size:      &size,
+			Checksum:  &checksum,
+			State:     fss.FragmentStateStored,
+		})
+	}
+
+	assert.NoError(t, s.CommitBatch(ctx, "file", fragments, 2*size))
+	_, err = s.CommitFile(ctx, "file", len(fragments), 2*size, "etag")
+	assert.NoError(t, err)
+
+	m, err := s.Metadata(ctx, "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, fragments, m.Fragments)
+		assert.Equal(t, "etag", m.ETag)
+		assert.WithinDuration(t, time.Now(), m.CommittedAt, time.Minute)
+	}
+
+	storage.Fail("Fragments", errInjected)
+	_, err = s.Metadata(ctx, "file")
+	assert.ErrorIs(t, err, errInjected)
+}
+
+func TestMetadataLegacyPlacement(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 3)
+
+	servers, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+	_, err = s.CommitFile(ctx, "file", 5, 0, "etag")
+	assert.NoError(t, err)
+
+	m, err := s.Metadata(ctx, "file")
+	if assert.NoError(t, err) && assert.Len(t, m.Fragments, 5) {
+		for i, f := range m.Fragments {
+			assert.Equal(t, i, f.Index)
+			assert.Equal(t, servers[i%len(servers)].URL, f.ServerURL)
+			assert.Nil(t, f.Checksum)
+		}
+	}
+
+	storage.Fail("Servers", errInjected)
+	_, err = s.Metadata(ctx, "file")
+	assert.ErrorIs(t, err, errInjected)
+}
+
+func TestCommitErrors(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newService(t, 1)
+
+	assert.ErrorAs(t, s.CommitBatch(ctx, "file", nil, 0), &fss.ConflictError{})
+
+	_, _, err := s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+
+	storage.Fail("AcquireLease", errInjected)
+	assert.ErrorIs(t, s.CommitBatch(ctx, "file", nil, 0), errInjected)
+	storage.Heal("AcquireLease")
+
+	storage.Fail("CreateFragments", errInjected)
+	assert.ErrorIs(t, s.CommitBatch(ctx, "file", nil, 0), errInjected)
+
+	storage.Fail("UpdateFile", errInjected)
+	assert.ErrorIs(t, s.CommitBatch(ctx, "file", nil, 0), errInjected)
+
+	storage.Fail("DeleteFile", errInjected)
+	assert.ErrorIs(t, s.RollbackFile(ctx, "file"), errInjected)
+	storage.Heal("DeleteFile")
+
+	_, _, err = s.StartSaving(ctx, "file", dm.Precondition{})
+	assert.NoError(t, err)
+	_, err = s.CommitFile(ctx, "file", 1, 0, "etag")
+	assert.ErrorIs(t, err, errInjected)
+}
@@ -0,0 +1,89 @@
+package dm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// maxFilesLimit bounds one page of listed files.
+const maxFilesLimit = 1000
+
+// Files returns a page of files which names start with prefix and follow after,
+// running uploads included. Limit 0 means the maximum page.
+func (s *Service) Files(ctx context.Context, prefix, after string, limit int) ([]fss.File, error) {
+	if limit < 0 {
+		return nil, fss.NewValidationError("negative limit %d", limit)
+	}
+
+	if limit == 0 || limit > maxFilesLimit {
+		limit = maxFilesLimit
+	}
+
+	files, err := s.storage.Files(ctx, prefix, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get files: %w", err)
+	}
+
+	return files, nil
+}
+
+// File returns metadata of the file.
+func (s *Service) File(ctx context.Context, filename string) (*fss.File, error) {
+	f, err := s.storage.File(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+
+	return f, nil
+}
+
+// Fragments returns placement of fragments of the committed file, fragments
+// of disabled servers included.
+func (s *Service) Fragments(ctx context.Context, filename string) ([]fss.Fragment, error) {
+	f, err := s.storage.File(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+
+	return s.fileFragments(ctx, f)
+}
+
+// DeleteFile deletes metadata of the committed file and returns its fragments
+// for removal from file servers. Running uploads can't be deleted.
+func (s *Service) DeleteFile(ctx context.Context, filename string) (_ []fss.Fragment, err error) {
+	lease := coordination.NewLease(s.storage, coordination.UploadLease(filename), s.uploadHolder(), s.leaseTTL)
+	err = lease.Acquire(ctx)
+	if errors.As(err, &fss.ConflictError{}) {
+		return nil, fss.NewLockedError("file '%s' is being uploaded", filename)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("acquire upload lease: %w", err)
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(lease.Release(ctx), err)
+	}()
+
+	f, err := s.storage.File(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+
+	var fragments []fss.Fragment
+	if f.Fragments != nil {
+		if fragments, err = s.fileFragments(ctx, f); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.storage.DeleteFile(ctx, filename); err != nil {
+		return nil, fmt.Errorf("delete file: %w", err)
+	}
+
+	return fragments, nil
+}
@@ -0,0 +1,155 @@
+package dm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Placement strategy names, stored per file.
+const (
+	PlacementRoundRobin = "round_robin"
+	PlacementRendezvous = "rendezvous"
+	PlacementRing       = "ring"
+)
+
+// ringVNodes is the number of ring points of a server with weight 1.
+const ringVNodes = 64
+
+// PlacementStrategy orders servers for a file. Fragment i of the file goes to
+// the server with position i mod len(servers).
+type PlacementStrategy interface {
+	Name() string
+	Place(filename string, servers []fss.Server) []fss.Server
+}
+
+var strategies = map[string]PlacementStrategy{
+	PlacementRoundRobin: roundRobin{},
+	PlacementRendezvous: rendezvous{},
+	PlacementRing:       ring{},
+}
+
+// Strategy returns placement strategy by name, empty name means round robin.
+func Strategy(name string) (PlacementStrategy, error) {
+	if name == "" {
+		name = PlacementRoundRobin
+	}
+
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fss.NewValidationError("unknown placement strategy '%s'", name)
+	}
+
+	return strategy, nil
+}
+
+// roundRobin is the legacy strategy: servers keep id order and start from
+// the position taken from the first byte of the filename hash.
+type roundRobin struct{}
+
+func (roundRobin) Name() string {
+	return PlacementRoundRobin
+}
+
+func (roundRobin) Place(filename string, servers []fss.Server) []fss.Server {
+	sum := sha256.Sum256([]byte(filename))
+	start := int(sum[0]) % len(servers)
+
+	ordered := make([]fss.Server, 0, len(servers))
+	for i := 0; i < len(servers); i++ {
+		ordered = append(ordered, servers[(i+start)%len(servers)])
+	}
+
+	return ordered
+}
+
+// rendezvous orders servers by highest random weight of the (file, server) pair
+// scaled by server weight, so adding a server moves only the fragments it wins.
+type rendezvous struct{}
+
+func (rendezvous) Name() string {
+	return PlacementRendezvous
+}
+
+func (rendezvous) Place(filename string, servers []fss.Server) []fss.Server {
+	scores := make(map[int64]float64, len(servers))
+	for _, server := range servers {
+		// Weighted rendezvous: -w / ln(u) with u uniform in (0, 1).
+		h := hash64(filename, strconv.FormatInt(server.ID, 10))
+		u := (float64(h>>11) + 0.5) / (1 << 53)
+		scores[server.ID] = -float64(serverWeight(server)) / math.Log(u)
+	}
+
+	ordered := append([]fss.Server(nil), servers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return scores[ordered[i].ID] > scores[ordered[j].ID]
+	})
+
+	return ordered
+}
+
+// ring is a consistent-hash ring where every server owns points in proportion
+// to its weight. Servers are ordered as met walking the ring from the file hash.
+type ring struct{}
+
+type ringPoint struct {
+	hash   uint64
+	server int
+}
+
+func (ring) Name() string {
+	return PlacementRing
+}
+
+func (ring) Place(filename string, servers []fss.Server) []fss.Server {
+	var points []ringPoint
+	for i, server := range servers {
+		for v := 0; v < ringVNodes*serverWeight(server); v++ {
+			points = append(points, ringPoint{
+				hash:   hash64(strconv.FormatInt(server.ID, 10), strconv.Itoa(v)),
+				server: i,
+			})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	key := hash64(filename)
+	start := sort.Search(len(points), func(i int) bool {
+		return points[i].hash >= key
+	})
+
+	ordered := make([]fss.Server, 0, len(servers))
+	seen := make(map[int]struct{}, len(servers))
+	for i := 0; i < len(points) && len(ordered) < len(servers); i++ {
+		p := points[(start+i)%len(points)]
+		if _, ok := seen[p.server]; ok {
+			continue
+		}
+
+		seen[p.server] = struct{}{}
+		ordered = append(ordered, servers[p.server])
+	}
+
+	return ordered
+}
+
+func serverWeight(server fss.Server) int {
+	return max(server.Weight, 1)
+}
+
+func hash64(parts ...string) uint64 {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
@@ -0,0 +1,128 @@
+package dm_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+func testServers(n int) []fss.Server {
+	servers := make([]fss.Server, 0, n)
+	for i := 1; i <= n; i++ {
+		servers = append(servers, fss.Server{ID: int64(i), URL: fmt.Sprintf("http://fs-%d", i)})
+	}
+
+	return servers
+}
+
+func TestPlacementStrategies(t *testing.T) {
+	for _, name := range []string{dm.PlacementRoundRobin, dm.PlacementRendezvous, dm.PlacementRing} {
+		t.Run(name, func(t *testing.T) {
+			strategy, err := dm.Strategy(name)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			servers := testServers(5)
+			ordered := strategy.Place("file", servers)
+			assert.ElementsMatch(t, servers, ordered)
+			assert.Equal(t, ordered, strategy.Place("file", servers))
+		})
+	}
+
+	_, err := dm.Strategy("unknown")
+	assert.ErrorAs(t, err, &fss.ValidationError{})
+}
+
+func TestRoundRobinKeepsLegacyOrder(t *testing.T) {
+	strategy, err := dm.Strategy("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// sha256("file")[0] is 0x7d, 125 mod 3 = 2.
+	servers := testServers(3)
+	assert.Equal(t, []fss.Server{servers[2], servers[0], servers[1]}, strategy.Place("file", servers))
+}
+
+func TestPlacementStability(t *testing.T) {
+	for _, name := range []string{dm.PlacementRendezvous, dm.PlacementRing} {
+		t.Run(name, func(t *testing.T) {
+			strategy, err := dm.Strategy(name)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			servers := testServers(10)
+			added := testServers(11)[10]
+
+			var moved int
+			for i := 0; i < 1000; i++ {
+				filename := fmt.Sprintf("file_%d", i)
+				before := strategy.Place(filename, servers)[0]
+				after := strategy.Place(filename, append(servers, added))[0]
+				if before != after {
+					assert.Equal(t, added, after)
+					moved++
+				}
+			}
+
+			assert.Less(t, moved, 250)
+		})
+	}
+}
+
+func TestRendezvousUsesAllServers(t *testing.T) {
+	strategy, err := dm.Strategy(dm.PlacementRendezvous)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	servers := testServers(300)
+	first := make(map[int64]int)
+	for i := 0; i < 3000; i++ {
+		first[strategy.Place(fmt.Sprintf("file_%d", i), servers)[0].ID]++
+	}
+
+	assert.Len(t, first, len(servers))
+}
+
+func TestBucketPlacement(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	for _, server := range testServers(3) {
+		assert.NoError(t, storage.CreateServer(ctx, server))
+	}
+
+	_, err := dm.New(storage, nil, dm.Config{BucketPlacement: map[string]string{"photos": "unknown"}})
+	assert.Error(t, err)
+
+	s, err := dm.New(storage, nil, dm.Config{
+		Timeout:         testTimeout,
+		Placement:       dm.PlacementRing,
+		BucketPlacement: map[string]string{"photos": dm.PlacementRendezvous},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for filename, want := range map[string]string{
+		"photos/cat.png": dm.PlacementRendezvous,
+		"docs/readme.md": dm.PlacementRing,
+		"photos":         dm.PlacementRing,
+	} {
+		_, _, err := s.StartSaving(ctx, filename, dm.Precondition{})
+		assert.NoError(t, err)
+
+		f, err := storage.File(ctx, filename)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, f.Placement, filename)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package dm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Quota limits bytes of a bucket, 0 means no limit. Uploads over Hard are aborted,
+// Soft only marks the bucket in the usage report.
+type Quota struct {
+	Soft int64
+	Hard int64
+}
+
+// Allowance is the quota of the bucket of an upload with the usage of the bucket when it started.
+type Allowance struct {
+	Bucket string
+	Quota  Quota
+	// Used is taken by other files of the bucket, running uploads included.
+	Used int64
+}
+
+// Check fails if the upload of size bytes doesn't fit the hard quota.
+func (a Allowance) Check(size int64) error {
+	if a.Quota.Hard > 0 && size > a.Quota.Hard {
+		return fss.NewTooLargeError("file is larger than the quota of bucket '%s' of %d bytes", a.Bucket, a.Quota.Hard)
+	}
+
+	if a.Quota.Hard > 0 && a.Used+size > a.Quota.Hard {
+		return fss.NewQuotaExceededError("bucket '%s' exceeds its quota of %d bytes", a.Bucket, a.Quota.Hard)
+	}
+
+	return nil
+}
+
+// SoftExceeded reports whether the upload of size bytes exceeds the soft quota.
+func (a Allowance) SoftExceeded(size int64) bool {
+	return a.Quota.Soft > 0 && a.Used+size > a.Quota.Soft
+}
+
+// BucketUsage is the usage of a bucket with its quota.
+type BucketUsage struct {
+	fss.Usage
+	Quota Quota
+}
+
+// Allowance returns the quota of the bucket of the file and the bytes taken by other files.
+// It is called after StartSaving, so a replaced file is not counted.
+func (s *Service) Allowance(ctx context.Context, filename string) (Allowance, error) {
+	bucket := fss.Bucket(filename)
+	a := Allowance{Bucket: bucket, Quota: s.bucketQuota(bucket)}
+	if a.Quota == (Quota{}) {
+		return a, nil
+	}
+
+	usage, err := s.storage.BucketUsage(ctx, bucket)
+	if err != nil {
+		return a, fmt.Errorf("get usage of bucket '%s': %w", bucket, err)
+	}
+
+	a.Used = usage.Bytes
+
+	return a, nil
+}
+
+// Usage reports buckets which have files or own quotas, ordered by bucket.
+func (s *Service) Usage(ctx context.Context) ([]BucketUsage, error) {
+	usage, err := s.storage.Usage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get usage: %w", err)
+	}
+
+	seen := make(map[string]bool, len(usage))
+	report := make([]BucketUsage, 0, len(usage)+len(s.bucketQuotas))
+	for _, u := range usage {
+		seen[u.Bucket] = true
+		report = append(report, BucketUsage{Usage: u, Quota: s.bucketQuota(u.Bucket)})
+	}
+
+	for bucket, quota := range s.bucketQuotas {
+		if !seen[bucket] {
+			report = append(report, BucketUsage{Usage: fss.Usage{Bucket: bucket}, Quota: quota})
+		}
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Bucket < report[j].Bucket
+	})
+
+	return report, nil
+}
+
+// checkQuota fails if the bucket of the file exceeds its hard quota. Uploads record their
+// sizes before the check, so concurrent uploads which don't fit together fail rather than overshoot.
+func (s *Service) checkQuota(ctx context.Context, filename string) error {
+	bucket := fss.Bucket(filename)
+	quota := s.bucketQuota(bucket)
+	if quota.Hard == 0 {
+		return nil
+	}
+
+	usage, err := s.storage.BucketUsage(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("get usage of bucket '%s': %w", bucket, err)
+	}
+
+	if usage.Bytes > quota.Hard {
+		return fss.NewQuotaExceededError("bucket '%s' exceeds its quota of %d bytes", bucket, quota.Hard)
+	}
+
+	return nil
+}
+
+func (s *Service) bucketQuota(bucket string) Quota {
+	if quota, ok := s.bucketQuotas[bucket]; ok {
+		return quota
+	}
+
+	return s.quota
+}
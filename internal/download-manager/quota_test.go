@@ -0,0 +1,112 @@
+package dm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+func TestAllowanceCheck(t *testing.T) {
+	allowance := dm.Allowance{Bucket: "b", Quota: dm.Quota{Soft: 10, Hard: 20}, Used: 8}
+
+	tests := []struct {
+		name     string
+		size     int64
+		wantErr  error
+		wantSoft bool
+	}{
+		{name: "fits", size: 2},
+		{name: "over soft quota", size: 5, wantSoft: true},
+		{name: "fits exactly", size: 12, wantSoft: true},
+		{name: "over hard quota", size: 13, wantErr: fss.QuotaExceededError{}, wantSoft: true},
+		{name: "larger than quota", size: 21, wantErr: fss.TooLargeError{}, wantSoft: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := allowance.Check(tt.size)
+			switch target := tt.wantErr.(type) {
+			case fss.QuotaExceededError:
+				assert.ErrorAs(t, err, &target)
+			case fss.TooLargeError:
+				assert.ErrorAs(t, err, &target)
+			default:
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantSoft, allowance.SoftExceeded(tt.size))
+		})
+	}
+
+	assert.NoError(t, dm.Allowance{Used: 100}.Check(100), "no quota")
+}
+
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	require.NoError(t, storage.CreateServer(ctx, fss.Server{URL: "http://fs-1", Weight: 1}))
+
+	s, err := dm.New(storage, nil, dm.Config{
+		Timeout:      testTimeout,
+		Quota:        dm.Quota{Hard: 100},
+		BucketQuotas: map[string]dm.Quota{"big": {Soft: 500, Hard: 1000}, "empty": {Hard: 10}},
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{"big/a", "big/b", "small/a"} {
+		_, _, err := s.StartSaving(ctx, name, dm.Precondition{})
+		require.NoError(t, err)
+		_, err = s.CommitFile(ctx, name, 1, 30, "etag")
+		require.NoError(t, err)
+	}
+
+	allowance, err := s.Allowance(ctx, "big/c")
+	require.NoError(t, err)
+	assert.Equal(t, dm.Allowance{Bucket: "big", Quota: dm.Quota{Soft: 500, Hard: 1000}, Used: 60}, allowance)
+
+	allowance, err = s.Allowance(ctx, "other/a")
+	require.NoError(t, err)
+	assert.Equal(t, dm.Allowance{Bucket: "other", Quota: dm.Quota{Hard: 100}}, allowance)
+
+	usage, err := s.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []dm.BucketUsage{
+		{Usage: fss.Usage{Bucket: "big", Files: 2, Bytes: 60}, Quota: dm.Quota{Soft: 500, Hard: 1000}},
+		{Usage: fss.Usage{Bucket: "empty"}, Quota: dm.Quota{Hard: 10}},
+		{Usage: fss.Usage{Bucket: "small", Files: 1, Bytes: 30}, Quota: dm.Quota{Hard: 100}},
+	}, usage)
+}
+
+func TestConcurrentUploadsQuota(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	require.NoError(t, storage.CreateServer(ctx, fss.Server{URL: "http://fs-1", Weight: 1}))
+
+	s, err := dm.New(storage, nil, dm.Config{Timeout: testTimeout, Quota: dm.Quota{Hard: 100}})
+	require.NoError(t, err)
+
+	// Both uploads start before either stores a byte, so both fit their allowances.
+	for _, name := range []string{"b/1", "b/2"} {
+		_, _, err := s.StartSaving(ctx, name, dm.Precondition{})
+		require.NoError(t, err)
+
+		allowance, err := s.Allowance(ctx, name)
+		require.NoError(t, err)
+		require.NoError(t, allowance.Check(60))
+	}
+
+	assert.NoError(t, s.CommitBatch(ctx, "b/1", nil, 60))
+
+	var quotaErr fss.QuotaExceededError
+	assert.ErrorAs(t, s.CommitBatch(ctx, "b/2", nil, 60), &quotaErr)
+
+	require.NoError(t, s.RollbackFile(ctx, "b/2"))
+	_, err = s.CommitFile(ctx, "b/1", 1, 60, "etag")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,134 @@
+package dm
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// ServerUpdate contains fields of a server to change, nil fields are kept.
+type ServerUpdate struct {
+	URL      *string
+	Capacity *int64
+	Weight   *int
+	Zone     *string
+	Mode     *string
+}
+
+// CreateServer registers file server, weight 0 means the default weight 1
+// and empty mode means active.
+func (s *Service) CreateServer(ctx context.Context, server fss.Server) error {
+	if server.Weight == 0 {
+		server.Weight = 1
+	}
+
+	if server.Mode == "" {
+		server.Mode = fss.ServerModeActive
+	}
+
+	if err := validateServer(server); err != nil {
+		return err
+	}
+
+	return s.storage.CreateServer(ctx, server)
+}
+
+// Servers returns all registered servers ordered by id.
+func (s *Service) Servers(ctx context.Context) ([]fss.Server, error) {
+	servers, err := s.storage.Servers(ctx, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("get servers: %w", err)
+	}
+
+	return servers, nil
+}
+
+// Server returns a server by id.
+func (s *Service) Server(ctx context.Context, id int64) (*fss.Server, error) {
+	server, err := s.storage.Server(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get server: %w", err)
+	}
+
+	return server, nil
+}
+
+// UpdateServer changes the server. Fragments are bound to the server id,
+// so a new url is used for the fragments stored before.
+func (s *Service) UpdateServer(ctx context.Context, id int64, upd ServerUpdate) (*fss.Server, error) {
+	server, err := s.storage.Server(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get server: %w", err)
+	}
+
+	if upd.URL != nil {
+		server.URL = *upd.URL
+	}
+
+	if upd.Capacity != nil {
+		server.Capacity = *upd.Capacity
+	}
+
+	if upd.Weight != nil {
+		server.Weight = *upd.Weight
+	}
+
+	if upd.Zone != nil {
+		server.Zone = *upd.Zone
+	}
+
+	if upd.Mode != nil {
+		server.Mode = *upd.Mode
+	}
+
+	if err = validateServer(*server); err != nil {
+		return nil, err
+	}
+
+	if err = s.storage.UpdateServer(ctx, *server); err != nil {
+		return nil, fmt.Errorf("update server: %w", err)
+	}
+
+	return server, nil
+}
+
+// DeleteServer removes a server which keeps no fragments.
+func (s *Service) DeleteServer(ctx context.Context, id int64) error {
+	if err := s.storage.DeleteServer(ctx, id); err != nil {
+		return fmt.Errorf("delete server: %w", err)
+	}
+
+	return nil
+}
+
+func validateServer(server fss.Server) error {
+	if server.URL == "" {
+		return fss.NewValidationError("server url is empty")
+	}
+
+	if server.Capacity < 0 || server.Weight < 1 {
+		return fss.NewValidationError("capacity must not be negative and weight must be positive")
+	}
+
+	switch server.Mode {
+	case fss.ServerModeActive, fss.ServerModeReadOnly, fss.ServerModeDisabled:
+		return nil
+
+	default:
+		return fss.NewValidationError("unknown server mode '%s'", server.Mode)
+	}
+}
+
+// writableServers returns servers which accept new fragments.
+func writableServers(servers []fss.Server) []fss.Server {
+	writable := make([]fss.Server, 0, len(servers))
+	for _, server := range servers {
+		if server.Mode == fss.ServerModeActive || server.Mode == "" {
+			writable = append(writable, server)
+		}
+	}
+
+	return writable
+}
@@ -0,0 +1,420 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: fileserver.proto
+
+package fspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	FileServer_Put_FullMethodName    = "/fss.fileserver.v1.FileServer/Put"
+	FileServer_Get_FullMethodName    = "/fss.fileserver.v1.FileServer/Get"
+	FileServer_Delete_FullMethodName = "/fss.fileserver.v1.FileServer/Delete"
+	FileServer_Stat_FullMethodName   = "/fss.fileserver.v1.FileServer/Stat"
+	FileServer_Exists_FullMethodName = "/fss.fileserver.v1.FileServer/Exists"
+	FileServer_List_FullMethodName   = "/fss.fileserver.v1.FileServer/List"
+	FileServer_Stats_FullMethodName  = "/fss.fileserver.v1.FileServer/Stats"
+)
+
+// FileServerClient is the client API for FileServer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FileServerClient interface {
+	Put(ctx context.Context, opts ...grpc.CallOption) (FileServer_PutClient, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (FileServer_GetClient, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error)
+	Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (FileServer_ListClient, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+}
+
+type fileServerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFileServerClient(cc grpc.ClientConnInterface) FileServerClient {
+	return &fileServerClient{cc}
+}
+
+func (c *fileServerClient) Put(ctx context.Context, opts ...grpc.CallOption) (FileServer_PutClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileServer_ServiceDesc.Streams[0], FileServer_Put_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileServerPutClient{stream}
+	return x, nil
+}
+
+type FileServer_PutClient interface {
+	Send(*PutRequest) error
+	CloseAndRecv() (*PutResponse, error)
+	grpc.ClientStream
+}
+
+type fileServerPutClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileServerPutClient) Send(m *PutRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *fileServerPutClient) CloseAndRecv() (*PutResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PutResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileServerClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (FileServer_GetClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileServer_ServiceDesc.Streams[1], FileServer_Get_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileServerGetClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileServer_GetClient interface {
+	Recv() (*GetResponse, error)
+	grpc.ClientStream
+}
+
+type fileServerGetClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileServerGetClient) Recv() (*GetResponse, error) {
+	m := new(GetResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileServerClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, FileServer_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServerClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, FileServer_Stat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServerClient) Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error) {
+	out := new(ExistsResponse)
+	err := c.cc.Invoke(ctx, FileServer_Exists_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServerClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (FileServer_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileServer_ServiceDesc.Streams[2], FileServer_List_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileServerListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileServer_ListClient interface {
+	Recv() (*ListResponse, error)
+	grpc.ClientStream
+}
+
+type fileServerListClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileServerListClient) Recv() (*ListResponse, error) {
+	m := new(ListResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileServerClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, FileServer_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FileServerServer is the server API for FileServer service.
+// All implementations must embed UnimplementedFileServerServer
+// for forward compatibility
+type FileServerServer interface {
+	Put(FileServer_PutServer) error
+	Get(*GetRequest, FileServer_GetServer) error
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Stat(context.Context, *StatRequest) (*StatResponse, error)
+	Exists(context.Context, *ExistsRequest) (*ExistsResponse, error)
+	List(*ListRequest, FileServer_ListServer) error
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	mustEmbedUnimplementedFileServerServer()
+}
+
+// UnimplementedFileServerServer must be embedded to have forward compatible implementations.
+type UnimplementedFileServerServer struct {
+}
+
+func (UnimplementedFileServerServer) Put(FileServer_PutServer) error {
+	return status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedFileServerServer) Get(*GetRequest, FileServer_GetServer) error {
+	return status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedFileServerServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedFileServerServer) Stat(context.Context, *StatRequest) (*StatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedFileServerServer) Exists(context.Context, *ExistsRequest) (*ExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exists not implemented")
+}
+func (UnimplementedFileServerServer) List(*ListRequest, FileServer_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedFileServerServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedFileServerServer) mustEmbedUnimplementedFileServerServer() {}
+
+// UnsafeFileServerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FileServerServer will
+// result in compilation errors.
+type UnsafeFileServerServer interface {
+	mustEmbedUnimplementedFileServerServer()
+}
+
+func RegisterFileServerServer(s grpc.ServiceRegistrar, srv FileServerServer) {
+	s.RegisterService(&FileServer_ServiceDesc, srv)
+}
+
+func _FileServer_Put_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServerServer).Put(&fileServerPutServer{stream})
+}
+
+type FileServer_PutServer interface {
+	SendAndClose(*PutResponse) error
+	Recv() (*PutRequest, error)
+	grpc.ServerStream
+}
+
+type fileServerPutServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileServerPutServer) SendAndClose(m *PutResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *fileServerPutServer) Recv() (*PutRequest, error) {
+	m := new(PutRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _FileServer_Get_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServerServer).Get(m, &fileServerGetServer{stream})
+}
+
+type FileServer_GetServer interface {
+	Send(*GetResponse) error
+	grpc.ServerStream
+}
+
+type fileServerGetServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileServerGetServer) Send(m *GetResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileServer_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServerServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileServer_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServerServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileServer_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServerServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileServer_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServerServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileServer_Exists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServerServer).Exists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileServer_Exists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServerServer).Exists(ctx, req.(*ExistsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileServer_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServerServer).List(m, &fileServerListServer{stream})
+}
+
+type FileServer_ListServer interface {
+	Send(*ListResponse) error
+	grpc.ServerStream
+}
+
+type fileServerListServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileServerListServer) Send(m *ListResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileServer_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServerServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileServer_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServerServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FileServer_ServiceDesc is the grpc.ServiceDesc for FileServer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileServer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fss.fileserver.v1.FileServer",
+	HandlerType: (*FileServerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Delete",
+			Handler:    _FileServer_Delete_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _FileServer_Stat_Handler,
+		},
+		{
+			MethodName: "Exists",
+			Handler:    _FileServer_Exists_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _FileServer_Stats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Put",
+			Handler:       _FileServer_Put_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Get",
+			Handler:       _FileServer_Get_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "List",
+			Handler:       _FileServer_List_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fileserver.proto",
+}
@@ -2,16 +2,24 @@ package fsshttp
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	dm "github.com/Tsapen/fss/internal/download-manager"
 	"github.com/Tsapen/fss/internal/fss"
-	"github.com/Tsapen/fss/internal/keeper"
+	"github.com/Tsapen/fss/internal/health"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/logging"
+	"github.com/Tsapen/fss/internal/metrics"
+	"github.com/Tsapen/fss/internal/readcache"
+	"github.com/Tsapen/fss/internal/tracing"
 )
 
 type Server struct {
@@ -19,59 +27,147 @@ type Server struct {
 	maxFragmentSize int64
 	s               *http.Server
 	dmService       *dm.Service
-	fsClient        *keeper.Keeper
+	fsClient        fss.FragmentStore
+	jobs            *jobs.Manager
+	// cache keeps fragments of downloaded files, nil disables it.
+	cache *readcache.Cache
+
+	health health.State
+	// ctx is the base context of requests, it is canceled when the shutdown deadline passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// uploadsMu orders registration of uploads with the final wait for them,
+	// no upload starts once the shutdown waits.
+	uploadsMu sync.Mutex
+	draining  bool
+	uploads   sync.WaitGroup
 }
 
 type Config struct {
 	Addr string
+
+	// JoinToken is required from file servers which register themselves, empty means no check.
+	JoinToken string
+	// APIToken is required from clients unless the request is presigned, empty means no check.
+	APIToken string
+	// PresignKey signs presigned URLs, empty disables them.
+	PresignKey string
+
+	// DrainDelay is how long the shutdown keeps serving requests while /readyz answers 503,
+	// so load balancers notice the server is not ready before it stops accepting them.
+	DrainDelay time.Duration
 }
 
-func NewServer(cfg Config, maxFragmentSize int64, dmService *dm.Service) (*Server, error) {
+// NewServer constructs the server, readCache may be nil.
+func NewServer(cfg Config, maxFragmentSize int64, dmService *dm.Service, fragmentStore fss.FragmentStore, jobManager *jobs.Manager, readCache *readcache.Cache) (*Server, error) {
 	r := mux.NewRouter()
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &Server{
 		cfg:       cfg,
 		dmService: dmService,
 		s: &http.Server{
-			Addr:    cfg.Addr,
-			Handler: r,
+			Addr:        cfg.Addr,
+			Handler:     r,
+			BaseContext: func(net.Listener) context.Context { return ctx },
 		},
-		fsClient:        keeper.New(),
+		fsClient:        fragmentStore,
+		jobs:            jobManager,
+		cache:           readCache,
 		maxFragmentSize: maxFragmentSize,
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", s.health.Live).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", s.health.Ready).Methods(http.MethodGet)
+
 	r = r.PathPrefix("/api/v1").Subrouter()
-	r.HandleFunc("/file", s.withMW(s.uploadFile)).Methods(http.MethodPost)
-	r.HandleFunc("/file", s.withMW(s.downloadFile)).Methods(http.MethodGet)
+	r.Use(logging.Middleware, s.health.Middleware, metrics.Middleware, tracing.Middleware, s.authMiddleware)
+	r.HandleFunc("/file", s.uploadFile).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/file", s.downloadFile).Methods(http.MethodGet)
+	r.HandleFunc("/file", s.deleteFile).Methods(http.MethodDelete)
+	r.HandleFunc("/file/stat", s.statFile).Methods(http.MethodGet)
+	r.HandleFunc("/file/fragments", s.fileFragments).Methods(http.MethodGet)
+	r.HandleFunc("/files", s.listFiles).Methods(http.MethodGet)
+	r.HandleFunc("/presign", s.presign).Methods(http.MethodPost)
+
+	r.HandleFunc("/fs-server", s.addServer).Methods(http.MethodPost)
+
+	r.HandleFunc("/fs-servers", s.listServers).Methods(http.MethodGet)
+	r.HandleFunc("/fs-servers", s.addServer).Methods(http.MethodPost)
+	r.HandleFunc("/fs-servers/{id}", s.getServer).Methods(http.MethodGet)
+	r.HandleFunc("/fs-servers/{id}", s.updateServer).Methods(http.MethodPatch)
+	r.HandleFunc("/fs-servers/{id}", s.deleteServer).Methods(http.MethodDelete)
 
-	r.HandleFunc("/fs-server", s.withMW(s.addServer)).Methods(http.MethodPost)
+	r.HandleFunc("/jobs", s.listJobs).Methods(http.MethodGet)
+	r.HandleFunc("/jobs", s.startJob).Methods(http.MethodPost)
+	r.HandleFunc("/jobs/{id}", s.getJob).Methods(http.MethodGet)
+
+	r.HandleFunc("/usage", s.usage).Methods(http.MethodGet)
 
 	return s, nil
 }
 
-// Start runs server.
+// Handler returns the handler of the server routes.
+func (s *Server) Handler() http.Handler {
+	return s.s.Handler
+}
+
+// Start runs server until Shutdown is called.
 func (s *Server) StartServer() error {
 	log.Info().Msgf("HTTP server started to listen %s", s.cfg.Addr)
 
-	return s.s.ListenAndServe()
-}
+	if err := s.s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
 
-func (s *Server) withMW(f http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := fss.WithReqID(r.Context(), uuid.NewString())
+	return nil
+}
 
-		logger := log.With().Str("method", r.Method).Str("path", r.URL.String()).Str("request_id", fss.ReqIDFromCtx(ctx)).Logger()
-		logger.Info().Msg("received request")
+// Shutdown makes the server not ready and keeps serving for the drain delay, then it rejects
+// new requests and waits for running ones until ctx is done. Then running uploads are
+// canceled and rolled back.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Drain()
+
+	delay := time.NewTimer(s.cfg.DrainDelay)
+	select {
+	case <-delay.C:
+	case <-ctx.Done():
+		delay.Stop()
+	}
 
-		ctx = fss.WithLogger(ctx, logger)
-		r = r.WithContext(ctx)
+	s.health.Reject()
 
-		f(w, r)
+	err := s.s.Shutdown(ctx)
+	if err == nil {
+		return nil
 	}
+
+	s.cancel()
+	err = fss.HandleErrPair(s.s.Close(), err)
+
+	s.uploadsMu.Lock()
+	s.draining = true
+	s.uploadsMu.Unlock()
+
+	s.uploads.Wait()
+
+	return fmt.Errorf("shutdown http server: %w", err)
 }
 
-func renderErr(ctx context.Context, logger zerolog.Logger, err error, w http.ResponseWriter) {
-	statusCode := httpStatus(err)
-	w.WriteHeader(statusCode)
+// startUpload registers an upload which the shutdown waits for, it fails once the shutdown waits.
+func (s *Server) startUpload() error {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+
+	if s.draining {
+		return fss.NewUnavailableError("server is shutting down")
+	}
+
+	s.uploads.Add(1)
 
-	logger.Info().Err(err).Int("status code", statusCode).Msg("failed to process message")
+	return nil
 }
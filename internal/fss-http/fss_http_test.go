@@ -0,0 +1,1050 @@
+package fsshttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/maintenance"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/internal/readcache"
+)
+
+const testFragmentSize = 16
+
+type testEnv struct {
+	server     *Server
+	storage    *memstore.Storage
+	fragments  *memstore.FragmentStore
+	serverURLs []string
+	baseURL    string
+	uri        string
+}
+
+func newTestEnv(t *testing.T, serversNum int) *testEnv {
+	return newTestEnvWithConfig(t, Config{}, serversNum)
+}
+
+func newTestEnvWithConfig(t *testing.T, cfg Config, serversNum int) *testEnv {
+	return newTestEnvWithDeps(t, cfg, dm.Config{}, nil, serversNum)
+}
+
+func newTestEnvWithDeps(t *testing.T, cfg Config, dmCfg dm.Config, readCache *readcache.Cache, serversNum int) *testEnv {
+	storage := memstore.NewStorage()
+	serverURLs := make([]string, 0, serversNum)
+	for i := 0; i < serversNum; i++ {
+		serverURLs = append(serverURLs, "http://file-server-"+string(rune('a'+i)))
+		if err := storage.CreateServer(context.Background(), fss.Server{URL: serverURLs[i], Weight: 1}); err != nil {
+			t.Fatalf("create server: %v", err)
+		}
+	}
+
+	dmCfg.Timeout = time.Second
+	dmService, err := dm.New(storage, nil, dmCfg)
+	if err != nil {
+		t.Fatalf("create download manager: %v", err)
+	}
+
+	fragments := memstore.NewFragmentStore()
+	jobManager := jobs.NewManager(storage)
+	t.Cleanup(jobManager.Close)
+
+	leaderCtx, resign := context.WithCancel(context.Background())
+	t.Cleanup(resign)
+	go jobManager.Lead(leaderCtx)
+	if !assert.Eventually(t, jobManager.Leading, time.Second, time.Millisecond) {
+		t.Fatalf("jobs manager doesn't lead")
+	}
+
+	maintenanceService := maintenance.New(dmService, storage, fragments)
+	jobManager.Register(jobs.KindScrub, maintenanceService.Scrub)
+	jobManager.Register(jobs.KindRebalance, maintenanceService.Rebalance)
+
+	s, err := NewServer(cfg, testFragmentSize, dmService, fragments, jobManager, readCache)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+
+	srv := httptest.NewServer(s.s.Handler)
+	t.Cleanup(srv.Close)
+
+	return &testEnv{
+		server:     s,
+		storage:    storage,
+		fragments:  fragments,
+		serverURLs: serverURLs,
+		baseURL:    srv.URL + "/api/v1",
+		uri:        srv.URL + "/api/v1/file",
+	}
+}
+
+func (e *testEnv) do(t *testing.T, method, filename string, body []byte) (int, []byte) {
+	status, _, data := e.doWithHeader(t, method, filename, nil, body)
+
+	return status, data
+}
+
+func (e *testEnv) doWithHeader(t *testing.T, method, filename string, header http.Header, body []byte) (int, http.Header, []byte) {
+	req, err := http.NewRequest(method, e.uri+"?filename="+url.QueryEscape(filename), bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("construct request: %v", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp.StatusCode, resp.Header, data
+}
+
+func TestUploadDownload(t *testing.T) {
+	tests := []struct {
+		name       string
+		serversNum int
+		size       int
+	}{
+		{name: "empty file", serversNum: 3, size: 0},
+		{name: "single fragment", serversNum: 3, size: testFragmentSize - 1},
+		{name: "exact batch", serversNum: 3, size: 3 * testFragmentSize},
+		{name: "several batches", serversNum: 4, size: 10*testFragmentSize + 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, tt.serversNum)
+			content := make([]byte, tt.size)
+			rand.Read(content)
+
+			status, _ := env.do(t, http.MethodPost, "file", content)
+			assert.Equal(t, http.StatusOK, status)
+
+			status, got := env.do(t, http.MethodGet, "file", nil)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, content, got)
+		})
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	env := newTestEnv(t, 3)
+
+	status, data := env.do(t, http.MethodGet, "missing", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	body, ok := httperr.Read(bytes.NewReader(data))
+	if assert.True(t, ok) {
+		assert.Equal(t, httperr.CodeNotFound, body.Code)
+		assert.NotEmpty(t, body.RequestID)
+	}
+
+	env.fragments.SetUnavailable(env.serverURLs[0], true)
+	status, _ = env.do(t, http.MethodPost, "file", make([]byte, testFragmentSize))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestDownloadUnavailableServer(t *testing.T) {
+	readCache, err := readcache.New(readcache.Config{Size: 1 << 20})
+	if err != nil {
+		t.Fatalf("create read cache: %v", err)
+	}
+
+	env := newTestEnvWithDeps(t, Config{}, dm.Config{}, readCache, 3)
+	content := make([]byte, 3*testFragmentSize-1)
+	rand.Read(content)
+
+	for _, filename := range []string{"file", "cached"} {
+		status, _ := env.do(t, http.MethodPost, filename, content)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	status, _ := env.do(t, http.MethodGet, "cached", nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	fragments, err := env.storage.Fragments(context.Background(), "file")
+	if !assert.NoError(t, err) || !assert.Len(t, fragments, 3) {
+		return
+	}
+
+	env.fragments.SetUnavailable(fragments[0].ServerURL, true)
+
+	status, _ = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// A range which doesn't touch the unavailable server is served.
+	rng := http.Header{"Range": []string{fmt.Sprintf("bytes=%d-", testFragmentSize)}}
+	status, _, got := env.doWithHeader(t, http.MethodGet, "file", rng, nil)
+	assert.Equal(t, http.StatusPartialContent, status)
+	assert.Equal(t, content[testFragmentSize:], got)
+
+	// Cached fragments don't need their servers.
+	status, got = env.do(t, http.MethodGet, "cached", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, got)
+}
+
+func TestRequestID(t *testing.T) {
+	env := newTestEnv(t, 3)
+
+	status, header, data := env.doWithHeader(t, http.MethodGet, "missing", http.Header{fss.RequestIDHeader: []string{"client-id"}}, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "client-id", header.Get(fss.RequestIDHeader))
+
+	body, ok := httperr.Read(bytes.NewReader(data))
+	if assert.True(t, ok) {
+		assert.Equal(t, "client-id", body.RequestID)
+	}
+
+	_, header, _ = env.doWithHeader(t, http.MethodGet, "missing", nil, nil)
+	assert.NotEmpty(t, header.Get(fss.RequestIDHeader))
+}
+
+func TestShutdown(t *testing.T) {
+	env := newTestEnv(t, 3)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go env.server.s.Serve(listener)
+
+	// The upload stores the first batch and waits for the rest of the body.
+	body, bodyWriter := io.Pipe()
+	uploadDone := make(chan struct{})
+	go func() {
+		defer close(uploadDone)
+
+		resp, err := http.Post("http://"+listener.Addr().String()+"/api/v1/file?filename=file", "", body)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	_, err = bodyWriter.Write(make([]byte, 3*testFragmentSize))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		f, err := env.storage.File(context.Background(), "file")
+		return err == nil && f.LastCommittedAt != nil
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, env.server.Shutdown(ctx))
+	bodyWriter.Close()
+	<-uploadDone
+
+	assert.ErrorAs(t, env.server.startUpload(), &fss.UnavailableError{}, "no upload starts after the shutdown")
+
+	_, err = env.storage.File(context.Background(), "file")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	resp, err := http.Get(strings.TrimSuffix(env.baseURL, "/api/v1") + "/readyz")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	status, _ := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	env := newTestEnvWithConfig(t, Config{DrainDelay: 300 * time.Millisecond}, 3)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go env.server.s.Serve(listener)
+
+	addr := "http://" + listener.Addr().String()
+	get := func(path string) int {
+		resp, err := http.Get(addr + path)
+		if err != nil {
+			return 0
+		}
+
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	shutdownDone := make(chan error, 1)
+	go func() {
+		shutdownDone <- env.server.Shutdown(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		return get("/readyz") == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, get("/api/v1/files"), "requests are served during the drain delay")
+
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("shutdown finished before the drain delay: %v", err)
+	default:
+	}
+
+	assert.NoError(t, <-shutdownDone)
+	assert.Zero(t, get("/readyz"), "the server stops listening after the drain delay")
+}
+
+func TestConditionalUpload(t *testing.T) {
+	env := newTestEnv(t, 3)
+	createOnly := http.Header{"If-None-Match": []string{"*"}}
+	v1, v2 := []byte("first version"), []byte("second version")
+
+	status, header, _ := env.doWithHeader(t, http.MethodPost, "file", createOnly, v1)
+	assert.Equal(t, http.StatusOK, status)
+
+	etag := header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	status, header, got := env.doWithHeader(t, http.MethodGet, "file", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, etag, header.Get("ETag"))
+	assert.Equal(t, v1, got)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "create only", header: createOnly, want: http.StatusPreconditionFailed},
+		{name: "unconditional", want: http.StatusConflict},
+		{name: "stale etag", header: http.Header{"If-Match": []string{`"stale"`}}, want: http.StatusPreconditionFailed},
+		{name: "weak etag", header: http.Header{"If-Match": []string{"W/" + etag}}, want: http.StatusPreconditionFailed},
+		{name: "unsupported", header: http.Header{"If-None-Match": []string{etag}}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, _ := env.doWithHeader(t, http.MethodPost, "file", tt.header, v2)
+			assert.Equal(t, tt.want, status)
+		})
+	}
+
+	status, header, _ = env.doWithHeader(t, http.MethodPost, "file", http.Header{"If-Match": []string{`"stale", ` + etag}}, v2)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, etag, header.Get("ETag"))
+
+	status, got = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, v2, got)
+
+	status, _ = env.do(t, http.MethodPost, "", v1)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestDownloadRange(t *testing.T) {
+	env := newTestEnv(t, 3)
+	content := make([]byte, 5*testFragmentSize+3)
+	rand.Read(content)
+
+	status, header, _ := env.doWithHeader(t, http.MethodPost, "file", nil, content)
+	assert.Equal(t, http.StatusOK, status)
+
+	etag := header.Get("ETag")
+	size := int64(len(content))
+
+	tests := []struct {
+		name         string
+		header       http.Header
+		status       int
+		want         []byte
+		contentRange string
+	}{
+		{name: "whole file", status: http.StatusOK, want: content},
+		{name: "inside a fragment", header: http.Header{"Range": []string{"bytes=2-5"}}, status: http.StatusPartialContent, want: content[2:6], contentRange: "bytes 2-5/83"},
+		{name: "across fragments", header: http.Header{"Range": []string{"bytes=10-40"}}, status: http.StatusPartialContent, want: content[10:41], contentRange: "bytes 10-40/83"},
+		{name: "open end", header: http.Header{"Range": []string{"bytes=70-"}}, status: http.StatusPartialContent, want: content[70:], contentRange: "bytes 70-82/83"},
+		{name: "end after size", header: http.Header{"Range": []string{"bytes=80-1000"}}, status: http.StatusPartialContent, want: content[80:], contentRange: "bytes 80-82/83"},
+		{name: "suffix", header: http.Header{"Range": []string{"bytes=-20"}}, status: http.StatusPartialContent, want: content[size-20:], contentRange: "bytes 63-82/83"},
+		{name: "matching if-range", header: http.Header{"Range": []string{"bytes=0-0"}, "If-Range": []string{etag}}, status: http.StatusPartialContent, want: content[:1], contentRange: "bytes 0-0/83"},
+		{name: "stale if-range", header: http.Header{"Range": []string{"bytes=0-0"}, "If-Range": []string{`"stale"`}}, status: http.StatusOK, want: content},
+		{name: "multiple ranges", header: http.Header{"Range": []string{"bytes=0-1,5-6"}}, status: http.StatusOK, want: content},
+		{name: "malformed", header: http.Header{"Range": []string{"bytes=5-1"}}, status: http.StatusOK, want: content},
+		{name: "after the end", header: http.Header{"Range": []string{"bytes=83-"}}, status: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */83"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, got := env.doWithHeader(t, http.MethodGet, "file", tt.header, nil)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.contentRange, header.Get("Content-Range"))
+			assert.Equal(t, "bytes", header.Get("Accept-Ranges"))
+			if tt.want != nil {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	readCache, err := readcache.New(readcache.Config{Size: 1 << 20})
+	if err != nil {
+		t.Fatalf("create read cache: %v", err)
+	}
+
+	env := newTestEnvWithDeps(t, Config{}, dm.Config{}, readCache, 3)
+	content := make([]byte, 3*testFragmentSize+5)
+	rand.Read(content)
+
+	status, _ := env.do(t, http.MethodPost, "file", content)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, got := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, got)
+	assert.Equal(t, int64(len(content)), readCache.Size())
+
+	// Cached fragments are served without file servers.
+	for _, uri := range env.serverURLs {
+		for i := 0; i < 4; i++ {
+			_ = env.fragments.DeleteFragment(context.Background(), uri, fss.FragmentName("file", 0, i))
+		}
+	}
+
+	status, header, got := env.doWithHeader(t, http.MethodGet, "file", http.Header{"Range": []string{"bytes=10-20"}}, nil)
+	assert.Equal(t, http.StatusPartialContent, status)
+	assert.Equal(t, "bytes 10-20/53", header.Get("Content-Range"))
+	assert.Equal(t, content[10:21], got)
+
+	overwritten := make([]byte, 2*testFragmentSize)
+	rand.Read(overwritten)
+
+	status, _, _ = env.doWithHeader(t, http.MethodPost, "file", http.Header{"If-Match": []string{"*"}}, overwritten)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, got = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, overwritten, got)
+	assert.Equal(t, int64(len(overwritten)), readCache.Size())
+
+	status, _ = env.do(t, http.MethodDelete, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Zero(t, readCache.Size())
+}
+
+func TestUploadInProgress(t *testing.T) {
+	env := newTestEnv(t, 3)
+	assert.NoError(t, env.storage.AcquireLease(context.Background(), coordination.UploadLease("file"), "other", time.Minute))
+
+	status, _ := env.do(t, http.MethodPost, "file", []byte("content"))
+	assert.Equal(t, http.StatusLocked, status)
+}
+
+func TestDownloadUncommitted(t *testing.T) {
+	env := newTestEnv(t, 3)
+	_, err := env.storage.CreateFile(context.Background(), "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	status, body := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var resp httperr.Response
+	if assert.NoError(t, json.Unmarshal(body, &resp)) {
+		assert.Equal(t, httperr.CodeConflict, resp.Error.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	env := newTestEnv(t, 3)
+
+	status, _ := env.do(t, http.MethodPost, "file", make([]byte, 3*testFragmentSize))
+	assert.Equal(t, http.StatusOK, status)
+
+	resp, err := http.Get(strings.TrimSuffix(env.baseURL, "/api/v1") + "/metrics")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(data), `fss_http_requests_total{method="POST",route="/api/v1/file",status="200"}`)
+	assert.Contains(t, string(data), "fss_uploaded_bytes_total")
+}
+
+func TestReplaceKeepsCommittedVersion(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t, 3)
+	v1, v2 := bytes.Repeat([]byte("1"), 5*testFragmentSize), bytes.Repeat([]byte("2"), 4*testFragmentSize)
+
+	status, header, _ := env.doWithHeader(t, http.MethodPost, "file", nil, v1)
+	assert.Equal(t, http.StatusOK, status)
+	replace := http.Header{"If-Match": []string{header.Get("ETag")}}
+
+	env.fragments.SetUnavailable(env.serverURLs[1], true)
+	status, _, _ = env.doWithHeader(t, http.MethodPost, "file", replace, v2)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	env.fragments.SetUnavailable(env.serverURLs[1], false)
+
+	status, got := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, v1, got, "failed upload keeps the committed version")
+
+	body, bodyWriter := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, env.uri+"?filename=file", body)
+	if err != nil {
+		t.Fatalf("construct request: %v", err)
+	}
+
+	req.Header = replace
+	statusCh := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			statusCh <- 0
+			return
+		}
+
+		resp.Body.Close()
+		statusCh <- resp.StatusCode
+	}()
+
+	_, err = bodyWriter.Write(v2[:3*testFragmentSize])
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		f, err := env.storage.File(ctx, "file")
+		return err == nil && f.UploadSize != nil
+	}, time.Second, 10*time.Millisecond)
+
+	status, got = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, v1, got, "committed version is read while the next one is uploaded")
+
+	_, err = bodyWriter.Write(v2[3*testFragmentSize:])
+	assert.NoError(t, err)
+	bodyWriter.Close()
+	assert.Equal(t, http.StatusOK, <-statusCh)
+
+	status, got = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, v2, got)
+
+	for _, uri := range env.serverURLs {
+		fragments, err := env.fragments.ListFragments(ctx, uri, "file_")
+		assert.NoError(t, err)
+
+		for _, f := range fragments {
+			_, version, _, _ := fss.ParseFragmentName(f.Name)
+			assert.Equal(t, int64(1), version, "fragment '%s' of the replaced version is deleted", f.Name)
+		}
+	}
+}
+
+func TestUploadRollback(t *testing.T) {
+	env := newTestEnv(t, 3)
+	env.fragments.SetUnavailable(env.serverURLs[1], true)
+
+	status, _ := env.do(t, http.MethodPost, "file", make([]byte, 5*testFragmentSize))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	_, err := env.storage.File(context.Background(), "file")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+}
+
+func (e *testEnv) api(t *testing.T, method, path string, header http.Header, body any, resp any) int {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+
+	req, err := http.NewRequest(method, e.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("construct request: %v", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if resp != nil && (res.StatusCode == http.StatusOK || res.StatusCode == http.StatusAccepted) {
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	}
+
+	return res.StatusCode
+}
+
+func TestUploadByCapacity(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t, 2)
+	for id, capacity := range map[int64]int64{1: 250, 2: 1000} {
+		server, err := env.storage.Server(ctx, id)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		server.Capacity = capacity
+		assert.NoError(t, env.storage.UpdateServer(ctx, *server))
+	}
+
+	status, _ := env.do(t, http.MethodPost, "file", make([]byte, 40*testFragmentSize-1))
+	assert.Equal(t, http.StatusOK, status)
+
+	fragments, err := env.storage.Fragments(ctx, "file")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	counts := make(map[int64]int)
+	for _, f := range fragments {
+		counts[f.ServerID]++
+	}
+
+	assert.Equal(t, map[int64]int{1: 8, 2: 32}, counts, "fragments follow free capacity 1:4")
+}
+
+func TestServersCRUD(t *testing.T) {
+	env := newTestEnv(t, 2)
+	env.fragments.SetCapacity(env.serverURLs[0], 100)
+	env.fragments.SetUnavailable(env.serverURLs[1], true)
+
+	var servers []serverResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/fs-servers", nil, nil, &servers))
+	if assert.Len(t, servers, 2) {
+		assert.Equal(t, serverStatusAvailable, servers[0].Status)
+		assert.Equal(t, &fss.ServerStats{Capacity: 100, Free: 100}, servers[0].Usage)
+		assert.Equal(t, serverStatusUnavailable, servers[1].Status)
+		assert.Nil(t, servers[1].Usage)
+	}
+
+	req := map[string]any{"server_url": "http://file-server-new", "weight": 2, "zone": "rack-2"}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPost, "/fs-servers", nil, req, nil))
+	assert.Equal(t, http.StatusConflict, env.api(t, http.MethodPost, "/fs-servers", nil, req, nil))
+	assert.Equal(t, http.StatusBadRequest, env.api(t, http.MethodPost, "/fs-servers", nil, "not an object", nil))
+
+	var server serverResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/fs-servers/3", nil, nil, &server))
+	assert.Equal(t, "rack-2", server.Zone)
+	assert.Equal(t, fss.ServerModeActive, server.Mode)
+
+	upd := map[string]any{"url": "http://file-server-moved", "mode": fss.ServerModeReadOnly}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPatch, "/fs-servers/3", nil, upd, &server))
+	assert.Equal(t, "http://file-server-moved", server.URL)
+	assert.Equal(t, fss.ServerModeReadOnly, server.Mode)
+	assert.Equal(t, 2, server.Weight)
+
+	assert.Equal(t, http.StatusBadRequest, env.api(t, http.MethodPatch, "/fs-servers/3", nil, map[string]any{"mode": "unknown"}, nil))
+	assert.Equal(t, http.StatusBadRequest, env.api(t, http.MethodGet, "/fs-servers/abc", nil, nil, nil))
+	assert.Equal(t, http.StatusNotFound, env.api(t, http.MethodPatch, "/fs-servers/42", nil, upd, nil))
+
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodDelete, "/fs-servers/3", nil, nil, nil))
+	assert.Equal(t, http.StatusNotFound, env.api(t, http.MethodGet, "/fs-servers/3", nil, nil, nil))
+}
+
+func TestServerModes(t *testing.T) {
+	env := newTestEnv(t, 2)
+	content := make([]byte, 4*testFragmentSize)
+	rand.Read(content)
+
+	status, _ := env.do(t, http.MethodPost, "file", content)
+	assert.Equal(t, http.StatusOK, status)
+
+	assert.Equal(t, http.StatusConflict, env.api(t, http.MethodDelete, "/fs-servers/1", nil, nil, nil))
+
+	readOnly := map[string]any{"mode": fss.ServerModeReadOnly}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPatch, "/fs-servers/1", nil, readOnly, nil))
+
+	status, got := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, got)
+
+	status, _ = env.do(t, http.MethodPost, "new_file", content)
+	assert.Equal(t, http.StatusOK, status)
+
+	fragments, err := env.storage.Fragments(context.Background(), "new_file")
+	if assert.NoError(t, err) {
+		for _, f := range fragments {
+			assert.Equal(t, env.serverURLs[1], f.ServerURL)
+		}
+	}
+
+	disabled := map[string]any{"mode": fss.ServerModeDisabled}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPatch, "/fs-servers/1", nil, disabled, nil))
+
+	status, _ = env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestJoinToken(t *testing.T) {
+	env := newTestEnvWithConfig(t, Config{JoinToken: "secret"}, 0)
+	req := map[string]any{"server_url": "http://file-server-new"}
+
+	assert.Equal(t, http.StatusUnauthorized, env.api(t, http.MethodPost, "/fs-servers", nil, req, nil))
+
+	wrong := http.Header{"Authorization": []string{"Bearer wrong"}}
+	assert.Equal(t, http.StatusUnauthorized, env.api(t, http.MethodPost, "/fs-servers", wrong, req, nil))
+
+	valid := http.Header{"Authorization": []string{"Bearer secret"}}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPost, "/fs-servers", valid, req, nil))
+}
+
+func TestAPIToken(t *testing.T) {
+	env := newTestEnvWithConfig(t, Config{JoinToken: "join", APIToken: "api"}, 1)
+	api := http.Header{"Authorization": []string{"Bearer api"}}
+	join := http.Header{"Authorization": []string{"Bearer join"}}
+
+	assert.Equal(t, http.StatusUnauthorized, env.api(t, http.MethodGet, "/files", nil, nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, env.api(t, http.MethodGet, "/files", join, nil, nil))
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/files", api, nil, nil))
+
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPost, "/fs-servers", join, map[string]any{"server_url": "http://file-server-b"}, nil))
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPost, "/fs-servers", api, map[string]any{"server_url": "http://file-server-c"}, nil))
+
+	status, _, _ := env.doWithHeader(t, http.MethodPost, "file", join, []byte("content"))
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestPresign(t *testing.T) {
+	env := newTestEnvWithConfig(t, Config{APIToken: "api", PresignKey: "key"}, 3)
+	auth := http.Header{"Authorization": []string{"Bearer api"}}
+	content := make([]byte, 3*testFragmentSize)
+	rand.Read(content)
+
+	presign := func(t *testing.T, req presignRequest) (int, string) {
+		var resp presignResponse
+		status := env.api(t, http.MethodPost, "/presign", auth, req, &resp)
+
+		return status, resp.URL
+	}
+
+	do := func(t *testing.T, method, uri string, body []byte) int {
+		req, err := http.NewRequest(method, uri, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("construct request: %v", err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		if method == http.MethodGet && resp.StatusCode == http.StatusOK {
+			got, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+
+		return resp.StatusCode
+	}
+
+	status, put := presign(t, presignRequest{Method: http.MethodPut, Filename: "file", ExpiresIn: 60, MaxSize: int64(len(content))})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, small := presign(t, presignRequest{Method: http.MethodPut, Filename: "small", ExpiresIn: 60, MaxSize: testFragmentSize})
+	assert.Equal(t, http.StatusOK, status)
+
+	status, get := presign(t, presignRequest{Method: http.MethodGet, Filename: "file", ExpiresIn: 60})
+	assert.Equal(t, http.StatusOK, status)
+
+	assert.Equal(t, http.StatusOK, do(t, http.MethodPut, put, content))
+	assert.Equal(t, http.StatusOK, do(t, http.MethodGet, get, nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do(t, http.MethodPut, small, content))
+	assert.Equal(t, http.StatusUnauthorized, do(t, http.MethodPut, get, content))
+	assert.Equal(t, http.StatusUnauthorized, do(t, http.MethodGet, strings.Replace(get, "filename=file", "filename=other", 1), nil))
+	assert.Equal(t, http.StatusUnauthorized, do(t, http.MethodDelete, get, nil))
+
+	u, err := url.Parse(get)
+	assert.NoError(t, err)
+
+	query := u.Query()
+	query.Set(paramExpires, "1")
+	query.Set(paramSignature, env.server.sign(http.MethodGet, "file", "1", ""))
+	u.RawQuery = query.Encode()
+	assert.Equal(t, http.StatusUnauthorized, do(t, http.MethodGet, u.String(), nil))
+
+	status, _ = presign(t, presignRequest{Method: http.MethodDelete, Filename: "file", ExpiresIn: 60})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = presign(t, presignRequest{Method: http.MethodGet, Filename: "file", ExpiresIn: 0})
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestQuota(t *testing.T) {
+	env := newTestEnvWithDeps(t, Config{}, dm.Config{
+		Quota:        dm.Quota{Hard: 4 * testFragmentSize},
+		BucketQuotas: map[string]dm.Quota{"soft": {Soft: testFragmentSize}},
+	}, nil, 3)
+
+	upload := func(t *testing.T, filename string, size int, chunked bool, header http.Header) int {
+		var body io.Reader = bytes.NewReader(make([]byte, size))
+		if chunked {
+			// The size of a chunked body is unknown until it is read.
+			body = io.MultiReader(body)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, env.uri+"?filename="+url.QueryEscape(filename), body)
+		if err != nil {
+			t.Fatalf("construct request: %v", err)
+		}
+
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, upload(t, "a/1", 40, false, nil))
+	assert.Equal(t, http.StatusInsufficientStorage, upload(t, "a/2", 40, false, nil))
+	assert.Equal(t, http.StatusInsufficientStorage, upload(t, "a/2", 40, true, nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(t, "a/3", 70, false, nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(t, "b/1", 70, true, nil))
+
+	status, _ := env.do(t, http.MethodGet, "a/2", nil)
+	assert.Equal(t, http.StatusNotFound, status, "aborted upload is rolled back")
+
+	overwrite := http.Header{"If-Match": []string{"*"}}
+	assert.Equal(t, http.StatusOK, upload(t, "a/1", 60, true, overwrite), "replaced file is not counted")
+	assert.Equal(t, http.StatusOK, upload(t, "soft/1", 20, false, nil))
+
+	var usage []usageResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/usage", nil, nil, &usage))
+	assert.Equal(t, []usageResponse{
+		{Bucket: "a", Files: 1, Bytes: 60, HardQuota: 4 * testFragmentSize},
+		{Bucket: "soft", Files: 1, Bytes: 20, SoftQuota: testFragmentSize, SoftExceeded: true},
+	}, usage)
+}
+
+func TestConcurrentUploadsQuota(t *testing.T) {
+	batch := 3 * testFragmentSize
+	env := newTestEnvWithDeps(t, Config{}, dm.Config{Quota: dm.Quota{Hard: int64(batch) + testFragmentSize}}, nil, 3)
+
+	type upload struct {
+		body   *io.PipeWriter
+		status chan int
+	}
+
+	start := func(filename string) upload {
+		body, bodyWriter := io.Pipe()
+		u := upload{body: bodyWriter, status: make(chan int, 1)}
+		go func() {
+			resp, err := http.Post(env.uri+"?filename="+filename, "", body)
+			if err != nil {
+				u.status <- 0
+				return
+			}
+
+			resp.Body.Close()
+			u.status <- resp.StatusCode
+		}()
+
+		assert.Eventually(t, func() bool {
+			_, err := env.storage.File(context.Background(), filename)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		return u
+	}
+
+	// Both uploads take their allowances before either of them stores a batch.
+	first, second := start("b/1"), start("b/2")
+
+	_, err := first.body.Write(make([]byte, batch))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		f, err := env.storage.File(context.Background(), "b/1")
+		return err == nil && f.Size != nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, _ = second.body.Write(make([]byte, batch))
+	second.body.Close()
+	assert.Equal(t, http.StatusInsufficientStorage, <-second.status)
+
+	first.body.Close()
+	assert.Equal(t, http.StatusOK, <-first.status)
+
+	_, err = env.storage.File(context.Background(), "b/2")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+}
+
+func TestFileAdmin(t *testing.T) {
+	env := newTestEnv(t, 3)
+	content := make([]byte, 3*testFragmentSize+5)
+	rand.Read(content)
+
+	for _, name := range []string{"dir/a", "dir/b", "other"} {
+		status, _ := env.do(t, http.MethodPost, name, content)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	var files []fileResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/files?prefix=dir/", nil, nil, &files))
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "dir/a", files[0].Name)
+		assert.Equal(t, "dir/b", files[1].Name)
+	}
+
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/files?after=dir/a&limit=1", nil, nil, &files))
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "dir/b", files[0].Name)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, env.api(t, http.MethodGet, "/files?limit=many", nil, nil, nil))
+
+	var file fileResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/file/stat?filename=dir/a", nil, nil, &file))
+	assert.True(t, file.Committed)
+	assert.Equal(t, 4, *file.Fragments)
+	assert.NotEmpty(t, file.ETag)
+
+	ctx := context.Background()
+	assert.NoError(t, env.fragments.DeleteFragment(ctx, env.serverURLs[0], fss.FragmentName("dir/a", 0, 0)))
+
+	var fragments []fragmentResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/file/fragments?filename=dir/a", nil, nil, &fragments))
+	if assert.Len(t, fragments, 4) {
+		statuses := make(map[int]string)
+		for _, f := range fragments {
+			statuses[f.Index] = f.Status
+		}
+
+		assert.Equal(t, map[int]string{0: maintenance.StatusMissing, 1: maintenance.StatusOK, 2: maintenance.StatusOK, 3: maintenance.StatusOK}, statuses)
+	}
+
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodDelete, "/file?filename=dir/a", nil, nil, nil))
+	assert.Equal(t, http.StatusNotFound, env.api(t, http.MethodGet, "/file/stat?filename=dir/a", nil, nil, nil))
+	assert.Equal(t, http.StatusNotFound, env.api(t, http.MethodDelete, "/file?filename=dir/a", nil, nil, nil))
+
+	for _, uri := range env.serverURLs {
+		stored, err := env.fragments.ListFragments(ctx, uri, "dir/a_")
+		assert.NoError(t, err)
+		assert.Empty(t, stored)
+	}
+}
+
+func (e *testEnv) runJob(t *testing.T, kind string) jobResponse {
+	var job jobResponse
+	if !assert.Equal(t, http.StatusAccepted, e.api(t, http.MethodPost, "/jobs", nil, map[string]any{"kind": kind}, &job)) {
+		return job
+	}
+
+	assert.Eventually(t, func() bool {
+		e.api(t, http.MethodGet, "/jobs/"+job.ID, nil, nil, &job)
+		return job.State != jobs.StatePending && job.State != jobs.StateRunning
+	}, 3*time.Second, 10*time.Millisecond)
+
+	return job
+}
+
+func TestJobs(t *testing.T) {
+	env := newTestEnv(t, 3)
+	content := make([]byte, 6*testFragmentSize-1)
+	rand.Read(content)
+
+	status, _ := env.do(t, http.MethodPost, "file", content)
+	assert.Equal(t, http.StatusOK, status)
+
+	job := env.runJob(t, jobs.KindScrub)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+	assert.Equal(t, int64(6), job.Done)
+	assert.Zero(t, job.Failed)
+
+	ctx := context.Background()
+	stored, err := env.fragments.ListFragments(ctx, env.serverURLs[0], "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stored)
+
+	upd := map[string]any{"mode": fss.ServerModeReadOnly}
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodPatch, "/fs-servers/1", nil, upd, nil))
+
+	job = env.runJob(t, jobs.KindRebalance)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+	assert.Equal(t, int64(len(stored)), job.Total)
+	assert.Equal(t, int64(len(stored)), job.Done)
+	assert.Zero(t, job.Failed)
+
+	stored, err = env.fragments.ListFragments(ctx, env.serverURLs[0], "")
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+
+	status, got := env.do(t, http.MethodGet, "file", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, got)
+
+	fragments, err := env.storage.Fragments(ctx, "file")
+	if assert.NoError(t, err) && assert.Len(t, fragments, 6) {
+		assert.NoError(t, env.fragments.DeleteFragment(ctx, fragments[0].ServerURL, fss.FragmentName("file", 0, 0)))
+	}
+
+	job = env.runJob(t, jobs.KindScrub)
+	assert.Equal(t, int64(1), job.Failed)
+	assert.Len(t, job.Issues, 1)
+
+	var all []jobResponse
+	assert.Equal(t, http.StatusOK, env.api(t, http.MethodGet, "/jobs", nil, nil, &all))
+	assert.Len(t, all, 3)
+
+	assert.Equal(t, http.StatusBadRequest, env.api(t, http.MethodPost, "/jobs", nil, map[string]any{"kind": "unknown"}, nil))
+	assert.Equal(t, http.StatusNotFound, env.api(t, http.MethodGet, "/jobs/unknown", nil, nil, nil))
+
+	// Another replica reports jobs of the leader from the metadata storage and queues jobs for it.
+	follower := jobs.NewManager(env.storage)
+	t.Cleanup(follower.Close)
+	follower.Register(jobs.KindScrub, maintenance.New(env.server.dmService, env.storage, env.fragments).Scrub)
+
+	s, err := NewServer(Config{}, testFragmentSize, env.server.dmService, env.fragments, follower, nil)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+
+	srv := httptest.NewServer(s.s.Handler)
+	t.Cleanup(srv.Close)
+
+	replica := *env
+	replica.baseURL = srv.URL + "/api/v1"
+
+	var reported jobResponse
+	assert.Equal(t, http.StatusOK, replica.api(t, http.MethodGet, "/jobs/"+job.ID, nil, nil, &reported))
+	assert.Equal(t, job, reported)
+
+	queued := replica.runJob(t, jobs.KindScrub)
+	assert.Equal(t, jobs.StateSucceeded, queued.State)
+	assert.Equal(t, int64(1), queued.Failed)
+}
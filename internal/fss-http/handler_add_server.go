@@ -7,24 +7,42 @@ import (
 	"net/http"
 
 	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
 )
 
 type addServerRequest struct {
 	ServerURL string `json:"server_url"`
+	Capacity  int64  `json:"capacity"`
+	Weight    int    `json:"weight"`
+	Zone      string `json:"zone"`
+	Mode      string `json:"mode"`
 }
 
 func (s *Server) addServer(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := fss.LoggerFromCtx(ctx)
+	if err := s.checkJoinToken(r); err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
 	req := new(addServerRequest)
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		renderErr(ctx, logger, err, w)
+		httperr.Render(ctx, logger, fss.NewValidationError("decode request: %w", err), w)
 		return
 	}
 
 	logger.Info().Any("request", req).Msg("request body")
-	if err := s.createFileServer(ctx, req.ServerURL); err != nil {
-		renderErr(ctx, logger, err, w)
+	server := fss.Server{
+		URL:      req.ServerURL,
+		Capacity: req.Capacity,
+		Weight:   req.Weight,
+		Zone:     req.Zone,
+		Mode:     req.Mode,
+	}
+
+	if err := s.createFileServer(ctx, server); err != nil {
+		httperr.Render(ctx, logger, err, w)
 		return
 	}
 
@@ -32,9 +50,9 @@ func (s *Server) addServer(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) createFileServer(ctx context.Context, uri string) error {
-	if err := s.dmService.CreateServer(ctx, uri); err != nil {
-		return fmt.Errorf("get fragment by url '%s': %w", uri, err)
+func (s *Server) createFileServer(ctx context.Context, server fss.Server) error {
+	if err := s.dmService.CreateServer(ctx, server); err != nil {
+		return fmt.Errorf("create server '%s': %w", server.URL, err)
 	}
 
 	return nil
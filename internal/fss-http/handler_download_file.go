@@ -1,56 +1,250 @@
 package fsshttp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
+	dm "github.com/Tsapen/fss/internal/download-manager"
 	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/metrics"
+	"github.com/Tsapen/fss/internal/readcache"
 )
 
+// byteRange is a part [start, end) of the file content.
+type byteRange struct {
+	start, end int64
+}
+
 func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := fss.LoggerFromCtx(ctx)
 	filename := r.URL.Query().Get("filename")
 	if filename == "" {
-		renderErr(ctx, logger, fss.NewBadRequestError("filename is empty"), w)
+		httperr.Render(ctx, logger, httperr.WithDetails(fss.NewBadRequestError("filename is empty"), map[string]any{"parameter": "filename"}), w)
 		return
 	}
 
 	m, err := s.dmService.Metadata(ctx, filename)
 	if err != nil {
-		renderErr(ctx, logger, err, w)
+		httperr.Render(ctx, logger, err, w)
 		return
 	}
 
-	for partNumber := 0; partNumber < m.PartNum; partNumber++ {
-		uri := m.ServerURLs[partNumber%len(m.ServerURLs)]
+	if m.ETag != "" {
+		w.Header().Set("ETag", quoteETag(m.ETag))
+	}
+
+	// Files uploaded before fragment sizes were recorded are sent whole without a length.
+	size, sized := fileSize(m.Fragments)
+	part, status := byteRange{start: 0, end: size}, http.StatusOK
+	if sized {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		rng, err := parseRange(r.Header, size, m.ETag)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			httperr.Render(ctx, logger, err, w)
+			return
+		}
+
+		if rng != nil {
+			part, status = *rng, http.StatusPartialContent
+		}
+	}
+
+	// The status is sent with the first fragment, so a failure to get it is still rendered.
+	wroteHeader := false
+	writeHeader := func() {
+		wroteHeader = true
+		if sized {
+			w.Header().Set("Content-Length", strconv.FormatInt(part.end-part.start, 10))
+		}
+
+		if status == http.StatusPartialContent {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", part.start, part.end-1, size))
+		}
+
+		w.WriteHeader(status)
+	}
+
+	var offset int64
+	for _, f := range m.Fragments {
+		skip, n := int64(0), int64(-1)
+		if sized {
+			fragmentEnd := offset + *f.Size
+			if fragmentEnd <= part.start || offset >= part.end {
+				offset = fragmentEnd
+				continue
+			}
+
+			skip = max(part.start-offset, 0)
+			n = min(part.end, fragmentEnd) - offset - skip
+			offset = fragmentEnd
+		}
+
+		fragmentName := f.Name()
+		fragment, err := s.getFragment(ctx, filename, m, f)
+		if err != nil {
+			err = fmt.Errorf("get fragment '%s' by url '%s': %w", fragmentName, f.ServerURL, err)
+			if !wroteHeader {
+				httperr.Render(ctx, logger, err, w)
+				return
+			}
 
-		if err := s.writeFragment(ctx, uri, getFragmentName(filename, partNumber), w); err != nil {
 			logger.Info().Err(err).Msg("failed to get file")
-			http.Error(w, "storage error", http.StatusInternalServerError)
 
 			return
 		}
+
+		if !wroteHeader {
+			writeHeader()
+		}
+
+		if err := writeFragment(w, fragment, skip, n); err != nil {
+			logger.Info().Err(fmt.Errorf("write fragment '%s': %w", fragmentName, err)).Msg("failed to get file")
+
+			return
+		}
+	}
+
+	if !wroteHeader {
+		writeHeader()
 	}
 
 	logger.Info().Msg("finished")
 }
 
-func (s *Server) writeFragment(ctx context.Context, uri, fragmentName string, w http.ResponseWriter) (err error) {
-	fragment, err := s.fsClient.GetFragment(ctx, uri, fragmentName)
+// getFragment reads the fragment through the read cache if it is enabled. Files without
+// an etag are never cached, as their versions cannot be told apart.
+func (s *Server) getFragment(ctx context.Context, filename string, m *dm.Metadata, f fss.Fragment) (io.ReadCloser, error) {
+	fragmentName := f.Name()
+	if s.cache == nil || m.ETag == "" {
+		return s.fetchFragment(ctx, f.ServerURL, fragmentName)
+	}
+
+	key := readcache.Key{
+		File:    filename,
+		Version: m.ETag + "@" + strconv.FormatInt(m.CommittedAt.UnixNano(), 10),
+		Index:   f.Index,
+	}
+
+	data, err := s.cache.Get(ctx, key, func(ctx context.Context) ([]byte, error) {
+		fragment, err := s.fetchFragment(ctx, f.ServerURL, fragmentName)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(fragment)
+
+		return data, fss.HandleErrPair(fragment.Close(), err)
+	})
 	if err != nil {
-		return fmt.Errorf("get fragment '%s' by url '%s': %w", fragmentName, uri, err)
+		return nil, err
 	}
 
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// writeFragment writes n bytes of the fragment after skip bytes, n < 0 means the rest.
+func writeFragment(w io.Writer, fragment io.ReadCloser, skip, n int64) (err error) {
 	defer func() {
 		err = fss.HandleErrPair(err, fragment.Close())
 	}()
 
-	if _, err = io.Copy(w, fragment); err != nil {
-		return fmt.Errorf("write fragment '%s': %w", fragmentName, err)
+	if _, err := io.CopyN(io.Discard, fragment, skip); err != nil {
+		return fmt.Errorf("skip %d bytes: %w", skip, err)
+	}
+
+	var written int64
+	if n < 0 {
+		written, err = io.Copy(w, fragment)
+	} else {
+		written, err = io.CopyN(w, fragment, n)
+	}
+
+	metrics.DownloadedBytes.Add(float64(written))
+
+	return err
+}
+
+// fileSize sums fragment sizes, ok is false if any fragment has no recorded size.
+func fileSize(fragments []fss.Fragment) (size int64, ok bool) {
+	for _, f := range fragments {
+		if f.Size == nil {
+			return 0, false
+		}
+
+		size += *f.Size
+	}
+
+	return size, true
+}
+
+// parseRange parses a single byte range of the Range header. Multiple and malformed ranges are
+// ignored as well as a range whose If-Range does not match the etag, so the whole file is sent.
+func parseRange(header http.Header, size int64, etag string) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(header.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	if ifRange := header.Get("If-Range"); ifRange != "" && (etag == "" || ifRange != quoteETag(etag)) {
+		return nil, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if first == "" {
+		// A suffix range selects the last bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+
+		if n == 0 || size == 0 {
+			return nil, fss.NewRangeNotSatisfiableError("range 'bytes=%s' is empty", spec)
+		}
+
+		return &byteRange{start: max(size-n, 0), end: size}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+
+	end := size
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return nil, nil
+		}
+
+		end = min(n+1, size)
+	}
+
+	if start >= size {
+		return nil, fss.NewRangeNotSatisfiableError("range 'bytes=%s' starts after the end of %d bytes", spec, size)
+	}
+
+	return &byteRange{start: start, end: end}, nil
+}
+
+// fetchFragment gets the fragment from its file server, it fails fast if the circuit breaker
+// of the server is open.
+func (s *Server) fetchFragment(ctx context.Context, serverURL, fragmentName string) (io.ReadCloser, error) {
+	if !s.fsClient.Available(serverURL) {
+		return nil, fss.NewUnavailableError("file server '%s' is unavailable", serverURL)
 	}
 
-	return nil
+	return s.fsClient.GetFragment(ctx, serverURL, fragmentName)
 }
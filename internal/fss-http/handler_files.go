@@ -0,0 +1,184 @@
+package fsshttp
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/maintenance"
+)
+
+type fileResponse struct {
+	Name            string     `json:"name"`
+	Committed       bool       `json:"committed"`
+	Fragments       *int       `json:"fragments,omitempty"`
+	ETag            string     `json:"etag,omitempty"`
+	Placement       string     `json:"placement"`
+	LastCommittedAt *time.Time `json:"last_committed_at,omitempty"`
+}
+
+type fragmentResponse struct {
+	Index      int     `json:"index"`
+	ServerID   int64   `json:"server_id"`
+	ServerURL  string  `json:"server_url"`
+	ServerMode string  `json:"server_mode"`
+	Size       *int64  `json:"size,omitempty"`
+	Checksum   *string `json:"checksum,omitempty"`
+	State      string  `json:"state"`
+	Status     string  `json:"status"`
+}
+
+func newFileResponse(f fss.File) fileResponse {
+	resp := fileResponse{
+		Name:            f.Name,
+		Committed:       f.Fragments != nil,
+		Fragments:       f.Fragments,
+		Placement:       f.Placement,
+		LastCommittedAt: f.LastCommittedAt,
+	}
+
+	if f.ETag != nil {
+		resp.ETag = *f.ETag
+	}
+
+	return resp
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+	q := r.URL.Query()
+
+	var limit int
+	if raw := q.Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil {
+			httperr.Render(ctx, logger, httperr.WithDetails(fss.NewValidationError("parse limit: %w", err), map[string]any{"parameter": "limit"}), w)
+			return
+		}
+	}
+
+	files, err := s.dmService.Files(ctx, q.Get("prefix"), q.Get("after"), limit)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	resp := make([]fileResponse, 0, len(files))
+	for _, f := range files {
+		resp = append(resp, newFileResponse(f))
+	}
+
+	renderJSON(ctx, w, resp)
+}
+
+func (s *Server) statFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	filename, err := filenameParam(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	f, err := s.dmService.File(ctx, filename)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	renderJSON(ctx, w, newFileResponse(*f))
+}
+
+// fileFragments returns placement of the file fragments with their status on file servers.
+func (s *Server) fileFragments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	filename, err := filenameParam(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	fragments, err := s.dmService.Fragments(ctx, filename)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	resp := make([]fragmentResponse, len(fragments))
+	var wg sync.WaitGroup
+	for i, f := range fragments {
+		resp[i] = fragmentResponse{
+			Index:      f.Index,
+			ServerID:   f.ServerID,
+			ServerURL:  f.ServerURL,
+			ServerMode: f.ServerMode,
+			Size:       f.Size,
+			Checksum:   f.Checksum,
+			State:      f.State,
+		}
+
+		wg.Add(1)
+		go func(i int, f fss.Fragment) {
+			defer wg.Done()
+
+			status, err := maintenance.CheckFragment(ctx, s.fsClient, f)
+			if err != nil {
+				logger.Info().Err(err).Msgf("check fragment %d on '%s'", f.Index, f.ServerURL)
+			}
+
+			resp[i].Status = status
+		}(i, f)
+	}
+
+	wg.Wait()
+
+	renderJSON(ctx, w, resp)
+}
+
+// deleteFile deletes the file metadata and then its fragments, fragments which
+// can't be deleted now are removed by the garbage collector.
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	filename, err := filenameParam(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	fragments, err := s.dmService.DeleteFile(ctx, filename)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	if s.cache != nil {
+		s.cache.Forget(filename)
+	}
+
+	for _, f := range fragments {
+		if err := s.fsClient.DeleteFragment(ctx, f.ServerURL, f.Name()); err != nil {
+			logger.Info().Err(err).Msgf("delete fragment %d on '%s'", f.Index, f.ServerURL)
+		}
+	}
+
+	logger.Info().Msg("success")
+	w.WriteHeader(http.StatusOK)
+}
+
+func filenameParam(r *http.Request) (string, error) {
+	filename := r.URL.Query().Get("filename")
+	if filename == "" {
+		return "", httperr.WithDetails(fss.NewBadRequestError("filename is empty"), map[string]any{"parameter": "filename"})
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,81 @@
+package fsshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+type startJobRequest struct {
+	Kind string `json:"kind"`
+}
+
+type jobResponse struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	Failed     int64      `json:"failed"`
+	Issues     []string   `json:"issues,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	req := new(startJobRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httperr.Render(ctx, logger, fss.NewValidationError("decode request: %w", err), w)
+		return
+	}
+
+	job, err := s.jobs.Start(ctx, req.Kind)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	renderJSON(ctx, w, jobResponse(job))
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	all, err := s.jobs.Jobs(ctx)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	resp := make([]jobResponse, 0, len(all))
+	for _, job := range all {
+		resp = append(resp, jobResponse(job))
+	}
+
+	renderJSON(ctx, w, resp)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	job, err := s.jobs.Job(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	renderJSON(ctx, w, jobResponse(job))
+}
@@ -0,0 +1,233 @@
+package fsshttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+// Query parameters of presigned URLs.
+const (
+	paramExpires   = "expires"
+	paramMaxSize   = "max_size"
+	paramSignature = "signature"
+)
+
+// maxPresignTTL bounds the lifetime of presigned URLs.
+const maxPresignTTL = 7 * 24 * time.Hour
+
+type presignRequest struct {
+	// Method is GET to download the file or PUT to upload it.
+	Method   string `json:"method"`
+	Filename string `json:"filename"`
+	// ExpiresIn is the lifetime of the URL in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	// MaxSize limits the size of an uploaded file, 0 means no limit.
+	MaxSize int64 `json:"max_size"`
+}
+
+type presignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// presign returns a URL which allows one method on one file without credentials until it expires.
+func (s *Server) presign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	if s.cfg.PresignKey == "" {
+		httperr.Render(ctx, logger, fss.NewBadRequestError("presigned urls are disabled"), w)
+		return
+	}
+
+	req := new(presignRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httperr.Render(ctx, logger, fss.NewValidationError("decode request: %w", err), w)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	maxSize := ""
+	if req.MaxSize > 0 {
+		maxSize = strconv.FormatInt(req.MaxSize, 10)
+	}
+
+	query := url.Values{}
+	query.Set("filename", req.Filename)
+	query.Set(paramExpires, expires)
+	if maxSize != "" {
+		query.Set(paramMaxSize, maxSize)
+	}
+
+	query.Set(paramSignature, s.sign(req.Method, req.Filename, expires, maxSize))
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: "/api/v1/file", RawQuery: query.Encode()}
+	renderJSON(ctx, w, presignResponse{URL: u.String(), ExpiresAt: expiresAt.UTC()})
+}
+
+func (req *presignRequest) validate() error {
+	switch {
+	case req.Method != http.MethodGet && req.Method != http.MethodPut:
+		return httperr.WithDetails(fss.NewValidationError("method must be GET or PUT"), map[string]any{"method": req.Method})
+
+	case req.Filename == "":
+		return httperr.WithDetails(fss.NewValidationError("filename is empty"), map[string]any{"parameter": "filename"})
+
+	case req.ExpiresIn <= 0 || time.Duration(req.ExpiresIn)*time.Second > maxPresignTTL:
+		return httperr.WithDetails(fss.NewValidationError("expires_in must be in (0, %d] seconds", int64(maxPresignTTL.Seconds())), map[string]any{"expires_in": req.ExpiresIn})
+
+	case req.MaxSize < 0 || req.MaxSize > 0 && req.Method != http.MethodPut:
+		return httperr.WithDetails(fss.NewValidationError("max_size must be positive and applies only to PUT"), map[string]any{"max_size": req.MaxSize})
+
+	default:
+		return nil
+	}
+}
+
+// authMiddleware checks the API token or the signature of presigned requests.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if r.URL.Query().Has(paramSignature) {
+			err = s.verifyPresigned(w, r)
+		} else {
+			err = s.checkAPIToken(r)
+		}
+
+		if err != nil {
+			ctx := r.Context()
+			httperr.Render(ctx, fss.LoggerFromCtx(ctx), err, w)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) checkAPIToken(r *http.Request) error {
+	if s.cfg.APIToken == "" {
+		return nil
+	}
+
+	token := bearerToken(r)
+	if tokenMatches(token, s.cfg.APIToken) {
+		return nil
+	}
+
+	// File servers register themselves with the join token which is checked by the handler.
+	registration := r.Method == http.MethodPost && (r.URL.Path == "/api/v1/fs-server" || r.URL.Path == "/api/v1/fs-servers")
+	if registration && s.cfg.JoinToken != "" && tokenMatches(token, s.cfg.JoinToken) {
+		return nil
+	}
+
+	return fss.NewUnauthorizedError("invalid api token")
+}
+
+// verifyPresigned checks that the URL is signed for the method and the file and has not expired.
+// Uploads over the signed size limit fail with TooLargeError.
+func (s *Server) verifyPresigned(w http.ResponseWriter, r *http.Request) error {
+	if s.cfg.PresignKey == "" {
+		return fss.NewUnauthorizedError("presigned urls are disabled")
+	}
+
+	if r.URL.Path != "/api/v1/file" {
+		return fss.NewUnauthorizedError("only files can be accessed by presigned urls")
+	}
+
+	method := r.Method
+	switch method {
+	case http.MethodHead:
+		method = http.MethodGet
+
+	case http.MethodPost:
+		method = http.MethodPut
+	}
+
+	query := r.URL.Query()
+	expires, maxSize := query.Get(paramExpires), query.Get(paramMaxSize)
+	signature := s.sign(method, query.Get("filename"), expires, maxSize)
+	if !hmac.Equal([]byte(signature), []byte(query.Get(paramSignature))) {
+		return fss.NewUnauthorizedError("invalid signature")
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return fss.NewUnauthorizedError("presigned url expired")
+	}
+
+	if maxSize == "" {
+		return nil
+	}
+
+	limit, err := strconv.ParseInt(maxSize, 10, 64)
+	if err != nil {
+		return fss.NewUnauthorizedError("invalid signature")
+	}
+
+	if r.ContentLength > limit {
+		return fss.NewTooLargeError("file is larger than %d bytes", limit)
+	}
+
+	r.Body = maxBytesBody{http.MaxBytesReader(w, r.Body, limit)}
+
+	return nil
+}
+
+// sign returns the signature of the method on the file until expires, maxSize may be empty.
+func (s *Server) sign(method, filename, expires, maxSize string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.PresignKey))
+	_, _ = io.WriteString(mac, strings.Join([]string{method, filename, expires, maxSize}, "\n"))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// maxBytesBody reports reads over the limit as TooLargeError.
+type maxBytesBody struct {
+	io.ReadCloser
+}
+
+func (b maxBytesBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = fss.NewTooLargeError("file is larger than %d bytes", tooLarge.Limit)
+	}
+
+	return n, err
+}
+
+func bearerToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return token
+}
+
+func tokenMatches(token, want string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
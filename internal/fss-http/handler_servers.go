@@ -0,0 +1,205 @@
+package fsshttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+const (
+	serverStatusAvailable   = "available"
+	serverStatusUnavailable = "unavailable"
+
+	serverStatsTimeout = 2 * time.Second
+)
+
+type serverResponse struct {
+	ID       int64            `json:"id"`
+	URL      string           `json:"url"`
+	Capacity int64            `json:"capacity"`
+	Weight   int              `json:"weight"`
+	Zone     string           `json:"zone"`
+	Mode     string           `json:"mode"`
+	Status   string           `json:"status,omitempty"`
+	Usage    *fss.ServerStats `json:"usage,omitempty"`
+}
+
+type updateServerRequest struct {
+	URL      *string `json:"url"`
+	Capacity *int64  `json:"capacity"`
+	Weight   *int    `json:"weight"`
+	Zone     *string `json:"zone"`
+	Mode     *string `json:"mode"`
+}
+
+func newServerResponse(server fss.Server) serverResponse {
+	return serverResponse{
+		ID:       server.ID,
+		URL:      server.URL,
+		Capacity: server.Capacity,
+		Weight:   server.Weight,
+		Zone:     server.Zone,
+		Mode:     server.Mode,
+	}
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	servers, err := s.dmService.Servers(ctx)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	resp := make([]serverResponse, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server fss.Server) {
+			defer wg.Done()
+
+			resp[i] = s.serverStatus(ctx, server)
+		}(i, server)
+	}
+
+	wg.Wait()
+
+	renderJSON(ctx, w, resp)
+}
+
+func (s *Server) getServer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	id, err := serverID(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	server, err := s.dmService.Server(ctx, id)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	renderJSON(ctx, w, s.serverStatus(ctx, *server))
+}
+
+func (s *Server) updateServer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	id, err := serverID(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	req := new(updateServerRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httperr.Render(ctx, logger, fss.NewValidationError("decode request: %w", err), w)
+		return
+	}
+
+	logger.Info().Any("request", req).Msg("request body")
+	server, err := s.dmService.UpdateServer(ctx, id, dm.ServerUpdate(*req))
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	renderJSON(ctx, w, newServerResponse(*server))
+}
+
+func (s *Server) deleteServer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	id, err := serverID(r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	if err = s.dmService.DeleteServer(ctx, id); err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	logger.Info().Msg("success")
+	w.WriteHeader(http.StatusOK)
+}
+
+// serverStatus asks the file server for usage, the server is unavailable if it doesn't answer.
+func (s *Server) serverStatus(ctx context.Context, server fss.Server) serverResponse {
+	resp := newServerResponse(server)
+	resp.Status = serverStatusUnavailable
+	if !s.fsClient.Available(server.URL) {
+		return resp
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, serverStatsTimeout)
+	defer cancel()
+
+	usage, err := s.fsClient.ServerStats(ctx, server.URL)
+	if err != nil {
+		logger := fss.LoggerFromCtx(ctx)
+		logger.Info().Err(err).Msgf("get stats of server '%s'", server.URL)
+
+		return resp
+	}
+
+	resp.Status, resp.Usage = serverStatusAvailable, usage
+
+	return resp
+}
+
+// checkJoinToken allows to register servers only with the join token if it is configured,
+// administrators may use the API token instead.
+func (s *Server) checkJoinToken(r *http.Request) error {
+	if s.cfg.JoinToken == "" {
+		return nil
+	}
+
+	token := bearerToken(r)
+	if !tokenMatches(token, s.cfg.JoinToken) && (s.cfg.APIToken == "" || !tokenMatches(token, s.cfg.APIToken)) {
+		return fss.NewUnauthorizedError("invalid join token")
+	}
+
+	return nil
+}
+
+func serverID(r *http.Request) (int64, error) {
+	raw := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, httperr.WithDetails(fss.NewValidationError("parse server id: %w", err), map[string]any{"id": raw})
+	}
+
+	return id, nil
+}
+
+func renderJSON(ctx context.Context, w http.ResponseWriter, v any) {
+	logger := fss.LoggerFromCtx(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Info().Err(fmt.Errorf("encode response: %w", err)).Msg("failed to write response")
+		return
+	}
+
+	logger.Info().Msg("success")
+}
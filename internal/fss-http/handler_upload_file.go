@@ -2,89 +2,197 @@ package fsshttp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 
+	dm "github.com/Tsapen/fss/internal/download-manager"
 	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/metrics"
+	"github.com/Tsapen/fss/internal/tracing"
 )
 
+// rollbackTimeout bounds the rollback of a canceled upload.
+const rollbackTimeout = 5 * time.Second
+
 func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := fss.LoggerFromCtx(ctx)
 
-	if err := s.saveFile(ctx, logger, r); err != nil {
-		renderErr(ctx, logger, err, w)
+	etag, err := s.saveFile(ctx, logger, r)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
 
 		return
 	}
 
+	w.Header().Set("ETag", quoteETag(etag))
 	w.WriteHeader(http.StatusOK)
 	logger.Info().Msg("finished")
 }
 
-func (s *Server) saveFile(ctx context.Context, logger zerolog.Logger, r *http.Request) (err error) {
+func (s *Server) saveFile(ctx context.Context, logger zerolog.Logger, r *http.Request) (_ string, err error) {
 	filename := r.URL.Query().Get("filename")
 	if filename == "" {
-		return fss.NewBadRequestError("filename is empty")
+		return "", httperr.WithDetails(fss.NewBadRequestError("filename is empty"), map[string]any{"parameter": "filename"})
 	}
 
-	file := r.Body
 	defer func() {
-		err = fss.HandleErrPair(file.Close(), err)
+		err = fss.HandleErrPair(r.Body.Close(), err)
 	}()
 
-	serverURLs, err := s.dmService.StartSaving(ctx, filename)
+	cond, err := precondition(r)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, span := tracing.Start(ctx, "upload", attribute.String("fss.file", filename))
+	defer func() { tracing.End(span, err) }()
+
+	// The upload is registered before it takes the lease and creates the file,
+	// so the shutdown rolls it back before the metadata db is closed.
+	if err := s.startUpload(); err != nil {
+		return "", err
+	}
+
+	defer s.uploads.Done()
+
+	servers, version, err := s.dmService.StartSaving(ctx, filename, cond)
+	if err != nil {
+		return "", fmt.Errorf("start saving: %w", err)
+	}
+
+	metrics.UploadsInFlight.Inc()
+	defer metrics.UploadsInFlight.Dec()
+
+	quota, err := s.uploadQuota(ctx, filename, r.ContentLength)
+	if err != nil {
+		return "", fss.HandleErrPair(s.rollback(ctx, filename), err)
+	}
+
+	// The etag is the content hash, so the same content always has the same etag.
+	hash := sha256.New()
+	fragmentsNum, err := s.saveData(ctx, logger, dm.BatchSlots(servers), filename, version, io.TeeReader(r.Body, hash), quota)
+	if err != nil {
+		return "", fss.HandleErrPair(s.rollback(ctx, filename), err)
+	}
+
+	etag := hex.EncodeToString(hash.Sum(nil))
+	replaced, err := s.dmService.CommitFile(ctx, filename, fragmentsNum, quota.stored, etag)
 	if err != nil {
-		return fmt.Errorf("start saving: %w", err)
+		return "", fmt.Errorf("commit file: %w", err)
+	}
+
+	// Fragments of the replaced version which can't be deleted now are removed by the garbage collector.
+	for _, f := range replaced {
+		if err := s.fsClient.DeleteFragment(ctx, f.ServerURL, f.Name()); err != nil {
+			logger.Info().Err(err).Msgf("delete replaced fragment %d on '%s'", f.Index, f.ServerURL)
+		}
 	}
 
-	fragmentsNum, err := s.saveData(ctx, logger, serverURLs, filename, file)
+	return etag, nil
+}
+
+// rollback deletes the file even if the upload is canceled by the client or the shutdown.
+func (s *Server) rollback(ctx context.Context, filename string) error {
+	metrics.Rollbacks.Inc()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	return s.dmService.RollbackFile(ctx, filename)
+}
+
+// uploadQuota checks the declared size of the upload against the quota of its bucket.
+func (s *Server) uploadQuota(ctx context.Context, filename string, contentLength int64) (*uploadQuota, error) {
+	allowance, err := s.dmService.Allowance(ctx, filename)
 	if err != nil {
-		return fss.HandleErrPair(s.dmService.RollbackFile(ctx, filename), err)
+		return nil, err
 	}
 
-	if err := s.dmService.CommitFile(ctx, filename, fragmentsNum); err != nil {
-		return fmt.Errorf("commit file: %w", err)
+	if contentLength > 0 {
+		if err := allowance.Check(contentLength); err != nil {
+			return nil, err
+		}
+	}
+
+	return &uploadQuota{Allowance: allowance}, nil
+}
+
+// uploadQuota counts bytes of the upload while they stream in.
+type uploadQuota struct {
+	dm.Allowance
+	stored int64
+	warned bool
+}
+
+// add counts n more bytes, it fails once the upload exceeds the hard quota.
+func (q *uploadQuota) add(logger zerolog.Logger, n int64) error {
+	q.stored += n
+	if err := q.Check(q.stored); err != nil {
+		return err
+	}
+
+	if !q.warned && q.SoftExceeded(q.stored) {
+		q.warned = true
+		logger.Warn().Str("bucket", q.Bucket).Int64("soft_quota", q.Quota.Soft).Msg("bucket exceeds its soft quota")
 	}
 
 	return nil
 }
 
-func (s *Server) saveData(ctx context.Context, logger zerolog.Logger, serverURLs []string, filename string, file io.Reader) (int, error) {
-	var finalFragmentNum int
-	var err error
-	for fragmentNum := 0; ; fragmentNum += len(serverURLs) {
-		finalFragmentNum, err = s.storeBatch(ctx, logger, serverURLs, filename, file, fragmentNum)
+// saveData stores the version of the file in batches, slots are servers of fragments of every batch.
+func (s *Server) saveData(ctx context.Context, logger zerolog.Logger, slots []fss.Server, filename string, version int64, file io.Reader, quota *uploadQuota) (int, error) {
+	for fragmentNum := 0; ; fragmentNum += len(slots) {
+		fragments, last, err := s.saveBatch(ctx, logger, slots, filename, version, file, fragmentNum, quota)
 		if err != nil {
-			return 0, fss.HandleErrPair(s.dmService.RollbackFile(ctx, filename), err)
+			return 0, err
 		}
 
-		if finalFragmentNum > 0 {
-			break
+		if last {
+			return fragmentNum + len(fragments), nil
 		}
+	}
+}
 
-		if err := s.dmService.CommitBatch(ctx, filename); err != nil {
-			return 0, fmt.Errorf("commit batch: %w", err)
-		}
+// saveBatch stores fragments of the batch and commits their placement.
+func (s *Server) saveBatch(ctx context.Context, logger zerolog.Logger, slots []fss.Server, filename string, version int64, file io.Reader, fragmentNum int, quota *uploadQuota) (_ []fss.Fragment, _ bool, err error) {
+	ctx, span := tracing.Start(ctx, "upload.batch", attribute.Int("fss.first_fragment", fragmentNum))
+	defer func() { tracing.End(span, err) }()
+
+	fragments, last, err := s.storeBatch(ctx, logger, slots, filename, version, file, fragmentNum, quota)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.dmService.CommitBatch(ctx, filename, fragments, quota.stored); err != nil {
+		return nil, false, fmt.Errorf("commit batch: %w", err)
+	}
+
+	for _, f := range fragments {
+		metrics.UploadedBytes.Add(float64(*f.Size))
 	}
 
-	return finalFragmentNum, nil
+	return fragments, last, nil
 }
 
-func (s *Server) storeBatch(ctx context.Context, logger zerolog.Logger, serverURLs []string, filename string, file io.Reader, fragmentNum int) (int, error) {
-	successCh := make(chan bool)
-	batchStart := fragmentNum
-	var finalFragmentNum int
+func (s *Server) storeBatch(ctx context.Context, logger zerolog.Logger, slots []fss.Server, filename string, version int64, file io.Reader, fragmentNum int, quota *uploadQuota) ([]fss.Fragment, bool, error) {
+	resultCh := make(chan error, len(slots))
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	fragments := make([]fss.Fragment, 0, len(slots))
 	var last bool
-	for _, serverURL := range serverURLs {
+	for _, server := range slots {
 		buffer := make([]byte, s.maxFragmentSize)
 		n, err := io.ReadFull(file, buffer)
 		switch {
@@ -92,42 +200,86 @@ func (s *Server) storeBatch(ctx context.Context, logger zerolog.Logger, serverUR
 			last = true
 
 		case err != nil:
-			return 0, err
+			return nil, false, err
 		}
 
-		go func(ctx context.Context, uri, fragmentName string, fragment []byte, successCh chan<- bool) {
+		size := int64(n)
+		if err := quota.add(logger, size); err != nil {
+			return nil, false, err
+		}
+
+		sum := sha256.Sum256(buffer[:n])
+		checksum := hex.EncodeToString(sum[:])
+		fragment := fss.Fragment{
+			FileName:  filename,
+			Version:   version,
+			Index:     fragmentNum,
+			ServerID:  server.ID,
+			ServerURL: server.URL,
+			Size:      &size,
+			Checksum:  &checksum,
+			State:     fss.FragmentStateStored,
+		}
+		fragments = append(fragments, fragment)
+
+		go func(ctx context.Context, uri, fragmentName string, fragment []byte, resultCh chan<- error) {
 			err := s.fsClient.StoreFragment(ctx, uri, fragmentName, fragment)
 			if err != nil {
 				logger.Info().Err(err).Msgf("store fragment '%s'", fragmentName)
 			}
 
-			successCh <- (err == nil)
-		}(ctx, serverURL, getFragmentName(filename, fragmentNum), buffer[:n], successCh)
+			resultCh <- err
+		}(ctx, server.URL, fragment.Name(), buffer[:n], resultCh)
 
 		fragmentNum++
 		if last {
-			finalFragmentNum = fragmentNum
 			break
 		}
 	}
 
-	timer := time.NewTimer(5 * time.Second)
-	for i := batchStart; i < fragmentNum; i++ {
-		select {
-		case success := <-successCh:
-			if success {
+	for range fragments {
+		if err := <-resultCh; err != nil {
+			return nil, false, fmt.Errorf("store batch: %w", err)
+		}
+	}
+
+	return fragments, last, nil
+}
+
+// precondition parses If-Match and If-None-Match headers of a conditional upload.
+func precondition(r *http.Request) (dm.Precondition, error) {
+	var cond dm.Precondition
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if strings.TrimSpace(v) != "*" {
+			return cond, fss.NewBadRequestError("only 'If-None-Match: *' is supported")
+		}
+
+		cond.IfNoneMatch = true
+	}
+
+	for _, v := range r.Header.Values("If-Match") {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
 				continue
 			}
 
-		case <-timer.C:
+			// Weak etags are kept quoted, so they never match as If-Match compares strongly.
+			if !strings.HasPrefix(tag, "W/") {
+				tag = strings.Trim(tag, `"`)
+			}
+
+			cond.IfMatch = append(cond.IfMatch, tag)
 		}
+	}
 
-		return 0, fmt.Errorf("store batch")
+	if cond.IfNoneMatch && len(r.Header.Values("If-Match")) > 0 {
+		return cond, fss.NewBadRequestError("If-Match and If-None-Match can't be combined")
 	}
 
-	return finalFragmentNum, nil
+	return cond, nil
 }
 
-func getFragmentName(filename string, part int) string {
-	return fmt.Sprintf("%s_%d", filename, part)
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
 }
@@ -0,0 +1,45 @@
+package fsshttp
+
+import (
+	"net/http"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+type usageResponse struct {
+	Bucket       string `json:"bucket"`
+	Files        int64  `json:"files"`
+	Bytes        int64  `json:"bytes"`
+	SoftQuota    int64  `json:"soft_quota,omitempty"`
+	HardQuota    int64  `json:"hard_quota,omitempty"`
+	SoftExceeded bool   `json:"soft_exceeded"`
+	HardExceeded bool   `json:"hard_exceeded"`
+}
+
+// usage reports storage taken by buckets with their quotas.
+func (s *Server) usage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := fss.LoggerFromCtx(ctx)
+
+	usage, err := s.dmService.Usage(ctx)
+	if err != nil {
+		httperr.Render(ctx, logger, err, w)
+		return
+	}
+
+	resp := make([]usageResponse, 0, len(usage))
+	for _, u := range usage {
+		resp = append(resp, usageResponse{
+			Bucket:       u.Bucket,
+			Files:        u.Files,
+			Bytes:        u.Bytes,
+			SoftQuota:    u.Quota.Soft,
+			HardQuota:    u.Quota.Hard,
+			SoftExceeded: u.Quota.Soft > 0 && u.Bytes > u.Quota.Soft,
+			HardExceeded: u.Quota.Hard > 0 && u.Bytes > u.Quota.Hard,
+		})
+	}
+
+	renderJSON(ctx, w, resp)
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
+// RequestIDHeader carries the request id in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
 type cxtKey int
 
 const (
@@ -20,7 +24,9 @@ func WithReqID(ctx context.Context, reqID string) context.Context {
 
 // ReqIDFromCtx gets request id from context.
 func ReqIDFromCtx(ctx context.Context) string {
-	return ctx.Value(reqIDKey).(string)
+	id, _ := ctx.Value(reqIDKey).(string)
+
+	return id
 }
 
 // WithLogger adds logger into context.
@@ -28,7 +34,16 @@ func WithLogger(ctx context.Context, logger zerolog.Logger) context.Context {
 	return context.WithValue(ctx, loggerKey, logger)
 }
 
-// LoggerFromCtx gets logger from context.
+// LoggerFromCtx gets logger from context, the global logger with the request id is
+// returned if the context has no logger.
 func LoggerFromCtx(ctx context.Context) zerolog.Logger {
-	return ctx.Value(loggerKey).(zerolog.Logger)
+	if logger, ok := ctx.Value(loggerKey).(zerolog.Logger); ok {
+		return logger
+	}
+
+	if reqID := ReqIDFromCtx(ctx); reqID != "" {
+		return log.With().Str("request_id", reqID).Logger()
+	}
+
+	return log.Logger
 }
@@ -69,6 +69,97 @@ func NewBadRequestError(format string, a ...any) BadRequestError {
 	return BadRequestError{fmt.Errorf(format, a...)}
 }
 
+// UnavailableError implements error interface.
+type UnavailableError struct {
+	Err error
+}
+
+func (err UnavailableError) Error() string {
+	return err.Err.Error()
+}
+
+func NewUnavailableError(format string, a ...any) UnavailableError {
+	return UnavailableError{fmt.Errorf(format, a...)}
+}
+
+// UnauthorizedError implements error interface.
+type UnauthorizedError struct {
+	Err error
+}
+
+func (err UnauthorizedError) Error() string {
+	return err.Err.Error()
+}
+
+func NewUnauthorizedError(format string, a ...any) UnauthorizedError {
+	return UnauthorizedError{fmt.Errorf(format, a...)}
+}
+
+// LockedError implements error interface.
+type LockedError struct {
+	Err error
+}
+
+func (err LockedError) Error() string {
+	return err.Err.Error()
+}
+
+func NewLockedError(format string, a ...any) LockedError {
+	return LockedError{fmt.Errorf(format, a...)}
+}
+
+// PreconditionFailedError implements error interface.
+type PreconditionFailedError struct {
+	Err error
+}
+
+func (err PreconditionFailedError) Error() string {
+	return err.Err.Error()
+}
+
+func NewPreconditionFailedError(format string, a ...any) PreconditionFailedError {
+	return PreconditionFailedError{fmt.Errorf(format, a...)}
+}
+
+// RangeNotSatisfiableError implements error interface.
+type RangeNotSatisfiableError struct {
+	Err error
+}
+
+func (err RangeNotSatisfiableError) Error() string {
+	return err.Err.Error()
+}
+
+func NewRangeNotSatisfiableError(format string, a ...any) RangeNotSatisfiableError {
+	return RangeNotSatisfiableError{fmt.Errorf(format, a...)}
+}
+
+// TooLargeError implements error interface.
+type TooLargeError struct {
+	Err error
+}
+
+func (err TooLargeError) Error() string {
+	return err.Err.Error()
+}
+
+func NewTooLargeError(format string, a ...any) TooLargeError {
+	return TooLargeError{fmt.Errorf(format, a...)}
+}
+
+// QuotaExceededError implements error interface.
+type QuotaExceededError struct {
+	Err error
+}
+
+func (err QuotaExceededError) Error() string {
+	return err.Err.Error()
+}
+
+func NewQuotaExceededError(format string, a ...any) QuotaExceededError {
+	return QuotaExceededError{fmt.Errorf(format, a...)}
+}
+
 // ErrPair contains deferred and returned error.
 type ErrPair struct {
 	Def error
@@ -80,6 +171,11 @@ func (errPair ErrPair) Error() string {
 	return fmt.Sprintf("returned: %s; deferred: %s", errPair.Def, errPair.Ret)
 }
 
+// Unwrap returns returned and deferred errors, returned one goes first.
+func (errPair ErrPair) Unwrap() []error {
+	return []error{errPair.Ret, errPair.Def}
+}
+
 // HandleErrPair contains deferred and returned errors.
 func HandleErrPair(def, ret error) error {
 	if ret == nil {
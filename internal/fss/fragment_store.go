@@ -0,0 +1,19 @@
+package fss
+
+import (
+	"context"
+	"io"
+)
+
+// FragmentStore keeps file fragments on file servers.
+type FragmentStore interface {
+	GetFragment(ctx context.Context, serverURL, name string, replicas ...string) (io.ReadCloser, error)
+	StoreFragment(ctx context.Context, serverURL, name string, fragment []byte) error
+	DeleteFragment(ctx context.Context, serverURL, name string) error
+	StatFragment(ctx context.Context, serverURL, name string) (*FragmentInfo, error)
+	ListFragments(ctx context.Context, serverURL, prefix string) ([]FragmentInfo, error)
+	ServerStats(ctx context.Context, serverURL string) (*ServerStats, error)
+
+	// Available reports whether the file server is expected to accept requests.
+	Available(serverURL string) bool
+}
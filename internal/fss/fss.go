@@ -1,19 +1,150 @@
 package fss
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// FragmentStateStored is a state of a fragment which is stored on its server.
+const FragmentStateStored = "stored"
+
+// Server modes. Read-only servers get no new fragments, disabled servers are not read either.
+const (
+	ServerModeActive   = "active"
+	ServerModeReadOnly = "read_only"
+	ServerModeDisabled = "disabled"
+)
+
 type (
 	File struct {
 		Name            string     `db:"name"`
 		LastServerID    int64      `db:"last_server_id"`
 		LastCommittedAt *time.Time `db:"last_committed_at"`
 		Fragments       *int       `db:"fragments"`
+		Placement       string     `db:"placement"`
+		ETag            *string    `db:"etag"`
+		// Size is the number of stored bytes, it grows with every committed batch.
+		Size *int64 `db:"size"`
+		// Version names fragments of the file. A committed file replaced by an upload stays
+		// readable, the upload stores fragments of UploadVersion and records its progress
+		// in UploadSize and UploadCommittedAt until the commit makes it the file version.
+		Version           int64      `db:"version"`
+		UploadVersion     *int64     `db:"upload_version"`
+		UploadSize        *int64     `db:"upload_size"`
+		UploadCommittedAt *time.Time `db:"upload_committed_at"`
 	}
 
 	Server struct {
 		ID  int64  `db:"id"`
 		URL string `db:"url"`
+
+		// Capacity is the declared size of the server storage in bytes, 0 means unknown.
+		Capacity int64 `db:"capacity"`
+		// Weight scales the share of fragments placed on the server.
+		Weight int `db:"weight"`
+		// Zone is a failure domain of the server, e.g. a rack.
+		Zone string `db:"zone"`
+		Mode string `db:"mode"`
+	}
+
+	// ServerStats describes usage of a file server storage in bytes.
+	ServerStats struct {
+		Capacity  int64 `json:"capacity"`
+		Used      int64 `json:"used"`
+		Free      int64 `json:"free"`
+		Fragments int64 `json:"fragments"`
+	}
+
+	// Fragment is a placement record of one fragment of a file.
+	Fragment struct {
+		FileName   string  `db:"file_name"`
+		Version    int64   `db:"version"`
+		Index      int     `db:"idx"`
+		ServerID   int64   `db:"server_id"`
+		ServerURL  string  `db:"url"`
+		ServerMode string  `db:"mode"`
+		Size       *int64  `db:"size"`
+		Checksum   *string `db:"checksum"`
+		State      string  `db:"state"`
+	}
+
+	// Usage is the storage taken by files of a bucket.
+	Usage struct {
+		Bucket string `db:"bucket"`
+		Files  int64  `db:"files"`
+		Bytes  int64  `db:"bytes"`
+	}
+
+	// Job is a snapshot of a maintenance job started by an operator.
+	Job struct {
+		ID         string
+		Kind       string
+		State      string
+		StartedAt  time.Time
+		FinishedAt *time.Time
+		// Total is the number of items known to be processed, it grows while the job discovers items.
+		Total  int64
+		Done   int64
+		Failed int64
+		Issues []string
+		Error  string
+	}
+
+	// FragmentInfo describes a fragment stored on a file server.
+	FragmentInfo struct {
+		Name       string    `json:"name"`
+		Size       int64     `json:"size"`
+		ModifiedAt time.Time `json:"modified_at"`
 	}
 )
+
+// Bucket returns the bucket of the file, the first segment of its name. Files without
+// segments belong to the root bucket "".
+func Bucket(filename string) string {
+	bucket, _, found := strings.Cut(filename, "/")
+	if !found {
+		return ""
+	}
+
+	return bucket
+}
+
+// FragmentName returns the name of the fragment of the file version on file servers.
+// Fragments of the first version keep names without the version.
+func FragmentName(filename string, version int64, idx int) string {
+	if version == 0 {
+		return fmt.Sprintf("%s_%d", filename, idx)
+	}
+
+	return fmt.Sprintf("%s_%d.%d", filename, idx, version)
+}
+
+// Name returns the name of the fragment on its server.
+func (f Fragment) Name() string {
+	return FragmentName(f.FileName, f.Version, f.Index)
+}
+
+// ParseFragmentName splits the fragment name into the filename, the file version and the fragment index.
+func ParseFragmentName(name string) (filename string, version int64, idx int, ok bool) {
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return "", 0, 0, false
+	}
+
+	suffix, v, versioned := strings.Cut(name[i+1:], ".")
+	idx, err := strconv.Atoi(suffix)
+	if err != nil || idx < 0 || suffix != strconv.Itoa(idx) {
+		return "", 0, 0, false
+	}
+
+	if versioned {
+		version, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || version <= 0 || v != strconv.FormatInt(version, 10) {
+			return "", 0, 0, false
+		}
+	}
+
+	return name[:i], version, idx, true
+}
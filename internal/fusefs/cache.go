@@ -0,0 +1,74 @@
+package fusefs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// chunkKey identifies a chunk of one file version.
+type chunkKey struct {
+	name string
+	etag string
+	idx  int64
+}
+
+type chunk struct {
+	key  chunkKey
+	data []byte
+}
+
+// chunkCache is an LRU cache of file chunks bounded by their total size.
+type chunkCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	chunks  map[chunkKey]*list.Element
+}
+
+func newChunkCache(maxSize int64) *chunkCache {
+	return &chunkCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		chunks:  make(map[chunkKey]*list.Element),
+	}
+}
+
+func (c *chunkCache) get(key chunkKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.chunks[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+
+	return e.Value.(*chunk).data, true
+}
+
+// put adds the chunk and evicts the least recently used ones over the size limit.
+func (c *chunkCache) put(key chunkKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+
+	if e, ok := c.chunks[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.chunks[key] = c.order.PushFront(&chunk{key: key, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.maxSize {
+		e := c.order.Back()
+		old := c.order.Remove(e).(*chunk)
+		delete(c.chunks, old.key)
+		c.size -= int64(len(old.data))
+	}
+}
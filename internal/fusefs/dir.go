@@ -0,0 +1,146 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+// dirNode is a directory, path is empty for the root.
+type dirNode struct {
+	fs.Inode
+
+	fsys *FS
+	path string
+}
+
+var (
+	_ fs.NodeLookuper  = (*dirNode)(nil)
+	_ fs.NodeReaddirer = (*dirNode)(nil)
+	_ fs.NodeGetattrer = (*dirNode)(nil)
+	_ fs.NodeCreater   = (*dirNode)(nil)
+	_ fs.NodeMkdirer   = (*dirNode)(nil)
+	_ fs.NodeUnlinker  = (*dirNode)(nil)
+	_ fs.NodeRmdirer   = (*dirNode)(nil)
+)
+
+func (d *dirNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = d.fsys.dirMode()
+
+	return 0
+}
+
+// Lookup finds a file by its full name first, then a directory by the prefix.
+func (d *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	p := childPath(d.path, name)
+
+	r, err := d.fsys.client.Open(ctx, p)
+	switch {
+	case err == nil:
+		file := &fileNode{fsys: d.fsys, path: p, info: r.Info()}
+		file.fill(&out.Attr)
+
+		return d.NewInode(ctx, file, fs.StableAttr{Mode: syscall.S_IFREG}), 0
+
+	case !errors.Is(err, client.ErrNotFound) && !errors.Is(err, client.ErrConflict):
+		return nil, errno(err)
+	}
+
+	ok, err := d.fsys.isDir(ctx, p)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	out.Mode = d.fsys.dirMode()
+
+	return d.NewInode(ctx, &dirNode{fsys: d.fsys, path: p}, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+}
+
+func (d *dirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, err := d.fsys.list(ctx, d.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	list := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		mode := uint32(syscall.S_IFREG)
+		if e.dir {
+			mode = syscall.S_IFDIR
+		}
+
+		list = append(list, fuse.DirEntry{Name: e.name, Mode: mode})
+	}
+
+	return fs.NewListDirStream(list), 0
+}
+
+// Create starts a new file, it is uploaded when it is closed.
+func (d *dirNode) Create(ctx context.Context, name string, flags, _ uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if !d.fsys.cfg.Writable {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	file := &fileNode{fsys: d.fsys, path: childPath(d.path, name), info: client.Info{}}
+	h, errNo := file.openWriter(true, true)
+	if errNo != 0 {
+		return nil, nil, 0, errNo
+	}
+
+	file.fill(&out.Attr)
+
+	return d.NewInode(ctx, file, fs.StableAttr{Mode: syscall.S_IFREG}), h, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Mkdir creates a local directory, it exists on the FSS once a file is stored in it.
+func (d *dirNode) Mkdir(ctx context.Context, name string, _ uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if !d.fsys.cfg.Writable {
+		return nil, syscall.EROFS
+	}
+
+	p := childPath(d.path, name)
+	d.fsys.mkdir(p)
+	out.Mode = d.fsys.dirMode()
+
+	return d.NewInode(ctx, &dirNode{fsys: d.fsys, path: p}, fs.StableAttr{Mode: syscall.S_IFDIR}), 0
+}
+
+func (d *dirNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	if !d.fsys.cfg.Writable {
+		return syscall.EROFS
+	}
+
+	return errno(d.fsys.client.DeleteFile(ctx, childPath(d.path, name)))
+}
+
+// Rmdir removes a local directory, directories with files disappear with their last file.
+func (d *dirNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	if !d.fsys.cfg.Writable {
+		return syscall.EROFS
+	}
+
+	p := childPath(d.path, name)
+	files, err := d.fsys.client.Files(ctx, client.ListFiles{Prefix: dirPrefix(p), Limit: 1})
+	if err != nil {
+		return errno(err)
+	}
+
+	if len(files) > 0 {
+		return syscall.ENOTEMPTY
+	}
+
+	if !d.fsys.rmdir(p) {
+		return syscall.ENOENT
+	}
+
+	return 0
+}
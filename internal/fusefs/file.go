@@ -0,0 +1,343 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+// fileNode is a stored file.
+type fileNode struct {
+	fs.Inode
+
+	fsys *FS
+	path string
+
+	mu   sync.Mutex
+	info client.Info
+	// truncated is set by truncate(2) without an open file, the next writer starts empty.
+	truncated bool
+	// writer is the open writer, its size is reported until it is uploaded.
+	writer *writeHandle
+}
+
+var (
+	_ fs.NodeGetattrer = (*fileNode)(nil)
+	_ fs.NodeSetattrer = (*fileNode)(nil)
+	_ fs.NodeOpener    = (*fileNode)(nil)
+)
+
+func (n *fileNode) fill(out *fuse.Attr) {
+	n.mu.Lock()
+	size, w := n.info.Size, n.writer
+	n.mu.Unlock()
+
+	if w != nil {
+		w.mu.Lock()
+		size = w.size
+		w.mu.Unlock()
+	}
+
+	out.Mode = n.fsys.fileMode()
+	out.Size = uint64(max(size, 0))
+}
+
+// Getattr refreshes the size, so overwritten files are seen once the kernel cache expires.
+func (n *fileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.mu.Lock()
+	local := n.writer != nil || n.truncated
+	n.mu.Unlock()
+
+	if !local {
+		r, err := n.fsys.client.Open(ctx, n.path)
+		if err != nil {
+			return errno(err)
+		}
+
+		n.mu.Lock()
+		n.info = r.Info()
+		n.mu.Unlock()
+	}
+
+	n.fill(&out.Attr)
+
+	return 0
+}
+
+// Setattr supports truncation of written files, other attributes are kept.
+func (n *fileNode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if size, ok := in.GetSize(); ok {
+		if !n.fsys.cfg.Writable {
+			return syscall.EROFS
+		}
+
+		// The kernel truncates files opened with O_TRUNC without their handle.
+		h, ok := fh.(*writeHandle)
+		if !ok {
+			n.mu.Lock()
+			h = n.writer
+			n.mu.Unlock()
+		}
+
+		switch {
+		case h != nil:
+			if errNo := h.truncate(int64(size)); errNo != 0 {
+				return errNo
+			}
+
+		case size != 0:
+			return syscall.ENOTSUP
+
+		default:
+			n.mu.Lock()
+			n.truncated = true
+			n.info.Size = 0
+			n.mu.Unlock()
+		}
+	}
+
+	n.fill(&out.Attr)
+
+	return 0
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		if !n.fsys.cfg.Writable {
+			return nil, 0, syscall.EROFS
+		}
+
+		h, errNo := n.openWriter(false, flags&syscall.O_TRUNC != 0)
+
+		return h, fuse.FOPEN_DIRECT_IO, errNo
+	}
+
+	r, err := n.fsys.client.Open(n.fsys.ctx, n.path)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+
+	n.mu.Lock()
+	n.info = r.Info()
+	n.mu.Unlock()
+
+	return &readHandle{fsys: n.fsys, path: n.path, r: r}, 0, 0
+}
+
+// openWriter keeps the content in a temporary file, the existing content is downloaded unless truncated.
+func (n *fileNode) openWriter(create, truncate bool) (*writeHandle, syscall.Errno) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.writer != nil {
+		return nil, syscall.EBUSY
+	}
+
+	tmp, err := os.CreateTemp(n.fsys.cfg.TempDir, "fss-fuse-*")
+	if err != nil {
+		return nil, syscall.EIO
+	}
+
+	h := &writeHandle{node: n, tmp: tmp, create: create, etag: n.info.ETag, dirty: create}
+	if !create && !truncate && !n.truncated {
+		info, err := n.fsys.client.Download(n.fsys.ctx, n.path, tmp, client.GetOptions{})
+		if err != nil {
+			h.close()
+
+			return nil, errno(err)
+		}
+
+		stat, err := tmp.Stat()
+		if err != nil {
+			h.close()
+
+			return nil, syscall.EIO
+		}
+
+		h.etag, h.size = info.ETag, stat.Size()
+	} else if !create {
+		h.dirty = true
+	}
+
+	n.truncated = false
+	n.writer = h
+
+	return h, 0
+}
+
+// readHandle reads one version of the file through the chunk cache.
+type readHandle struct {
+	fsys *FS
+	path string
+	r    *client.RangeReader
+}
+
+var _ fs.FileReader = (*readHandle)(nil)
+
+func (h *readHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	info := h.r.Info()
+	chunkSize := h.fsys.cfg.ChunkSize
+	n := 0
+	for n < len(dest) && off+int64(n) < info.Size {
+		pos := off + int64(n)
+		idx := pos / chunkSize
+		chunk, err := h.chunk(idx)
+		if err != nil {
+			return nil, errno(err)
+		}
+
+		start := pos - idx*chunkSize
+		if start >= int64(len(chunk)) {
+			break
+		}
+
+		n += copy(dest[n:], chunk[start:])
+	}
+
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *readHandle) chunk(idx int64) ([]byte, error) {
+	info := h.r.Info()
+	key := chunkKey{name: h.path, etag: info.ETag, idx: idx}
+	if data, ok := h.fsys.cache.get(key); ok {
+		return data, nil
+	}
+
+	chunkSize := h.fsys.cfg.ChunkSize
+	data := make([]byte, min(chunkSize, info.Size-idx*chunkSize))
+	n, err := h.r.ReadAt(data, idx*chunkSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read chunk %d: %w", idx, err)
+	}
+
+	// Files without etags may change, so only their versions are cached.
+	if info.ETag != "" {
+		h.fsys.cache.put(key, data[:n])
+	}
+
+	return data[:n], nil
+}
+
+// writeHandle keeps the written content in a temporary file and uploads it on close.
+type writeHandle struct {
+	node *fileNode
+	tmp  *os.File
+
+	mu     sync.Mutex
+	size   int64
+	etag   string
+	create bool
+	dirty  bool
+}
+
+var (
+	_ fs.FileReader   = (*writeHandle)(nil)
+	_ fs.FileWriter   = (*writeHandle)(nil)
+	_ fs.FileFlusher  = (*writeHandle)(nil)
+	_ fs.FileFsyncer  = (*writeHandle)(nil)
+	_ fs.FileReleaser = (*writeHandle)(nil)
+)
+
+func (h *writeHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.tmp.ReadAt(dest, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, syscall.EIO
+	}
+
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *writeHandle) Write(_ context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err := h.tmp.WriteAt(data, off)
+	if err != nil {
+		return uint32(n), syscall.EIO
+	}
+
+	h.size = max(h.size, off+int64(n))
+	h.dirty = true
+
+	return uint32(n), 0
+}
+
+func (h *writeHandle) truncate(size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.tmp.Truncate(size); err != nil {
+		return syscall.EIO
+	}
+
+	h.size = size
+	h.dirty = true
+
+	return 0
+}
+
+// Flush uploads the content, a new file is created only if it does not exist yet
+// and an existing one is overwritten only if it has not changed since it was opened.
+func (h *writeHandle) Flush(context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.dirty {
+		return 0
+	}
+
+	if _, err := h.tmp.Seek(0, io.SeekStart); err != nil {
+		return syscall.EIO
+	}
+
+	opts := client.PutOptions{Size: h.size, IfNoneMatch: h.create}
+	if !h.create {
+		opts.IfMatch = h.etag
+		if opts.IfMatch == "" {
+			opts.IfMatch = "*"
+		}
+	}
+
+	etag, err := h.node.fsys.client.Put(h.node.fsys.ctx, h.node.path, h.tmp, opts)
+	if err != nil {
+		return errno(err)
+	}
+
+	h.etag, h.create, h.dirty = etag, false, false
+	h.node.fsys.forgetDirs(h.node.path)
+
+	h.node.mu.Lock()
+	h.node.info = client.Info{Size: h.size, ETag: etag}
+	h.node.mu.Unlock()
+
+	return 0
+}
+
+func (h *writeHandle) Fsync(ctx context.Context, _ uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *writeHandle) Release(context.Context) syscall.Errno {
+	h.node.mu.Lock()
+	h.node.writer = nil
+	h.node.mu.Unlock()
+
+	h.close()
+
+	return 0
+}
+
+func (h *writeHandle) close() {
+	_ = h.tmp.Close()
+	_ = os.Remove(h.tmp.Name())
+}
@@ -0,0 +1,286 @@
+// Package fusefs exposes the FSS namespace as a FUSE file system. Directories are derived from
+// "/" in file names, file contents are read by ranges through a local chunk cache.
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+// Defaults of Config.
+const (
+	defaultChunkSize = 1 << 20
+	defaultCacheSize = 64 << 20
+	defaultTimeout   = time.Second
+)
+
+// listPage is the page size of directory listings.
+const listPage = 1000
+
+// Config controls the file system.
+type Config struct {
+	// ChunkSize is the size of file ranges read and cached at once.
+	ChunkSize int64
+	// CacheSize bounds the cached bytes.
+	CacheSize int64
+	// Writable enables creating, overwriting and removing files. Written files are kept in
+	// TempDir and uploaded when they are closed.
+	Writable bool
+	TempDir  string
+	// Timeout is how long the kernel caches names and attributes.
+	Timeout time.Duration
+	Debug   bool
+}
+
+// FS is the FSS namespace.
+type FS struct {
+	client *client.Client
+	cfg    Config
+	cache  *chunkCache
+
+	// ctx bounds requests of open files, it is canceled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// dirs are created by mkdir and exist locally until files are stored in them.
+	mu   sync.Mutex
+	dirs map[string]struct{}
+}
+
+// New constructs the file system.
+func New(c *client.Client, cfg Config) *FS {
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = defaultCacheSize
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.TempDir == "" {
+		cfg.TempDir = os.TempDir()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &FS{
+		client: c,
+		cfg:    cfg,
+		cache:  newChunkCache(cfg.CacheSize),
+		ctx:    ctx,
+		cancel: cancel,
+		dirs:   make(map[string]struct{}),
+	}
+}
+
+// Mount mounts the file system on dir. It is served until the returned server is unmounted.
+func (f *FS) Mount(dir string) (*fuse.Server, error) {
+	opts := &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:      "fss",
+			Name:        "fss",
+			DirectMount: true,
+			Debug:       f.cfg.Debug,
+		},
+		EntryTimeout:    &f.cfg.Timeout,
+		AttrTimeout:     &f.cfg.Timeout,
+		NegativeTimeout: &f.cfg.Timeout,
+		UID:             uint32(os.Getuid()),
+		GID:             uint32(os.Getgid()),
+	}
+
+	if !f.cfg.Writable {
+		opts.MountOptions.Options = append(opts.MountOptions.Options, "ro")
+	}
+
+	return fs.Mount(dir, &dirNode{fsys: f}, opts)
+}
+
+// Close cancels reads and uploads of open files.
+func (f *FS) Close() {
+	f.cancel()
+}
+
+// entry is a child of a directory.
+type entry struct {
+	name string
+	dir  bool
+}
+
+// list returns children of the directory. A name with both a file and files under it is a file.
+func (f *FS) list(ctx context.Context, dir string) ([]entry, error) {
+	prefix := dirPrefix(dir)
+	seen := make(map[string]bool)
+	var entries []entry
+	add := func(name string, isDir bool) {
+		if name == "" || seen[name] {
+			return
+		}
+
+		seen[name] = true
+		entries = append(entries, entry{name: name, dir: isDir})
+	}
+
+	var files, dirs []string
+	for after := ""; ; {
+		page, err := f.client.Files(ctx, client.ListFiles{Prefix: prefix, After: after, Limit: listPage})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range page {
+			rest := strings.TrimPrefix(file.Name, prefix)
+			if name, _, nested := strings.Cut(rest, "/"); nested {
+				dirs = append(dirs, name)
+			} else if file.Committed {
+				files = append(files, rest)
+			}
+		}
+
+		if len(page) < listPage {
+			break
+		}
+
+		after = page[len(page)-1].Name
+	}
+
+	for _, name := range files {
+		add(name, false)
+	}
+
+	for _, name := range dirs {
+		add(name, true)
+	}
+
+	f.mu.Lock()
+	for d := range f.dirs {
+		if parent, name := path.Split(d); strings.TrimSuffix(parent, "/") == dir {
+			add(name, true)
+		}
+	}
+	f.mu.Unlock()
+
+	return entries, nil
+}
+
+// isDir reports whether the directory has files or was created locally.
+func (f *FS) isDir(ctx context.Context, dir string) (bool, error) {
+	f.mu.Lock()
+	_, ok := f.dirs[dir]
+	f.mu.Unlock()
+
+	if ok {
+		return true, nil
+	}
+
+	page, err := f.client.Files(ctx, client.ListFiles{Prefix: dirPrefix(dir), Limit: 1})
+	if err != nil {
+		return false, err
+	}
+
+	return len(page) > 0, nil
+}
+
+func (f *FS) mkdir(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.dirs[dir] = struct{}{}
+}
+
+// forgetDirs drops local directories of the stored file, they exist on the FSS now.
+func (f *FS) forgetDirs(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		delete(f.dirs, dir)
+	}
+}
+
+// rmdir removes the local directory, ok is false if it is not local.
+func (f *FS) rmdir(dir string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.dirs[dir]
+	delete(f.dirs, dir)
+
+	return ok
+}
+
+func (f *FS) fileMode() uint32 {
+	if f.cfg.Writable {
+		return syscall.S_IFREG | 0o644
+	}
+
+	return syscall.S_IFREG | 0o444
+}
+
+func (f *FS) dirMode() uint32 {
+	if f.cfg.Writable {
+		return syscall.S_IFDIR | 0o755
+	}
+
+	return syscall.S_IFDIR | 0o555
+}
+
+func dirPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	return dir + "/"
+}
+
+func childPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+
+	return dir + "/" + name
+}
+
+// errno maps client errors to errnos of file operations.
+func errno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+
+	case errors.Is(err, client.ErrNotFound):
+		return syscall.ENOENT
+
+	case errors.Is(err, client.ErrConflict), errors.Is(err, client.ErrPreconditionFailed):
+		return syscall.EEXIST
+
+	case errors.Is(err, client.ErrLocked):
+		return syscall.EBUSY
+
+	case errors.Is(err, client.ErrChanged):
+		return syscall.ESTALE
+
+	case errors.Is(err, client.ErrUnauthorized):
+		return syscall.EACCES
+
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+
+	default:
+		return syscall.EIO
+	}
+}
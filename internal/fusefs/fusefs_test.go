@@ -0,0 +1,173 @@
+package fusefs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	fsshttp "github.com/Tsapen/fss/internal/fss-http"
+	"github.com/Tsapen/fss/internal/fusefs"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+const testFragmentSize = 64
+
+// mount serves an in-memory FSS on localhost and mounts it, the test is skipped without FUSE.
+func mount(t *testing.T, cfg fusefs.Config) (*client.Client, string) {
+	t.Helper()
+
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("fuse is not available")
+	}
+
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	for _, uri := range []string{"http://file-server-a", "http://file-server-b", "http://file-server-c"} {
+		require.NoError(t, storage.CreateServer(ctx, fss.Server{URL: uri, Weight: 1}))
+	}
+
+	dmService, err := dm.New(storage, nil, dm.Config{Timeout: time.Second})
+	require.NoError(t, err)
+
+	jobManager := jobs.NewManager(storage)
+	t.Cleanup(jobManager.Close)
+
+	s, err := fsshttp.NewServer(fsshttp.Config{}, testFragmentSize, dmService, memstore.NewFragmentStore(), jobManager, nil)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(client.Config{Address: srv.URL})
+	require.NoError(t, err)
+
+	cfg.ChunkSize = 100
+	cfg.Timeout = time.Millisecond
+	cfg.TempDir = t.TempDir()
+	fsys := fusefs.New(c, cfg)
+	t.Cleanup(fsys.Close)
+
+	dir := t.TempDir()
+	server, err := fsys.Mount(dir)
+	if err != nil {
+		t.Skipf("mount fuse: %v", err)
+	}
+
+	t.Cleanup(func() { assert.NoError(t, server.Unmount()) })
+
+	return c, dir
+}
+
+func TestRead(t *testing.T) {
+	c, dir := mount(t, fusefs.Config{})
+	ctx := context.Background()
+
+	content := make([]byte, 1000)
+	rand.Read(content)
+
+	for _, name := range []string{"top", "a/b/nested", "a/c", "empty"} {
+		data := content
+		if name == "empty" {
+			data = nil
+		}
+
+		_, err := c.Put(ctx, name, bytes.NewReader(data), client.PutOptions{})
+		require.NoError(t, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make(map[string]bool)
+	for _, e := range entries {
+		names[e.Name()] = e.IsDir()
+	}
+
+	assert.Equal(t, map[string]bool{"top": false, "a": true, "empty": false}, names)
+
+	entries, err = os.ReadDir(filepath.Join(dir, "a"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "b", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "c", entries[1].Name())
+
+	got, err := os.ReadFile(filepath.Join(dir, "a", "b", "nested"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	stat, err := os.Stat(filepath.Join(dir, "top"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), stat.Size())
+
+	f, err := os.Open(filepath.Join(dir, "top"))
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	part := make([]byte, 150)
+	n, err := f.ReadAt(part, 420)
+	require.NoError(t, err)
+	assert.Equal(t, content[420:570], part[:n])
+
+	n, err = f.ReadAt(part, 900)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, content[900:], part[:n])
+
+	got, err = os.ReadFile(filepath.Join(dir, "empty"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Error(t, os.WriteFile(filepath.Join(dir, "new"), content, 0o644))
+}
+
+func TestWrite(t *testing.T) {
+	c, dir := mount(t, fusefs.Config{Writable: true})
+	ctx := context.Background()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs", "2024"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "2024", "report"), []byte("first version"), 0o644))
+
+	var buf bytes.Buffer
+	_, err := c.Download(ctx, "docs/2024/report", &buf, client.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "first version", buf.String())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "2024", "report"), []byte("second"), 0o644))
+
+	f, err := os.OpenFile(filepath.Join(dir, "docs", "2024", "report"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+
+	_, err = f.WriteString(" version")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	got, err := os.ReadFile(filepath.Join(dir, "docs", "2024", "report"))
+	require.NoError(t, err)
+	assert.Equal(t, "second version", string(got))
+
+	assert.Error(t, os.Remove(filepath.Join(dir, "docs")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "docs", "2024", "report")))
+
+	_, err = c.StatFile(ctx, "docs/2024/report")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "tmp"), 0o755))
+	require.NoError(t, os.Remove(filepath.Join(dir, "tmp")))
+}
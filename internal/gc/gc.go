@@ -0,0 +1,352 @@
+// Package gc removes leftovers of crashed uploads from metadata and file servers.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/keeper"
+)
+
+const (
+	defaultStaleAfter  = time.Hour
+	defaultOrphanGrace = time.Hour
+	defaultBatchSize   = 100
+
+	// uploadLeaseTTL bounds the time a removed upload keeps its lease if the collector crashes.
+	uploadLeaseTTL = time.Minute
+)
+
+// Config contains settings of the collector.
+type Config struct {
+	// Interval between collections, 0 disables the background loop.
+	Interval time.Duration
+	// StaleAfter is how long an upload may stay without a committed batch.
+	StaleAfter time.Duration
+	// OrphanGrace protects fragments of running uploads which are stored but not recorded yet.
+	OrphanGrace time.Duration
+	// BatchSize limits the number of stale uploads removed in one collection.
+	BatchSize int
+}
+
+func (c Config) withDefaults() Config {
+	if c.StaleAfter == 0 {
+		c.StaleAfter = defaultStaleAfter
+	}
+
+	if c.OrphanGrace == 0 {
+		c.OrphanGrace = defaultOrphanGrace
+	}
+
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultBatchSize
+	}
+
+	return c
+}
+
+// Stats contains results of one collection.
+type Stats struct {
+	StaleUploads    int
+	OrphanFragments int
+}
+
+// Collector finds stale uploads and fragments which no metadata references.
+type Collector struct {
+	cfg       Config
+	storage   dm.Storage
+	fragments fss.FragmentStore
+	holder    string
+
+	// mu keeps collections of the loop and of operator jobs apart.
+	mu sync.Mutex
+}
+
+// New creates collector.
+func New(cfg Config, storage dm.Storage, fragments fss.FragmentStore) *Collector {
+	return &Collector{
+		cfg:       cfg.withDefaults(),
+		storage:   storage,
+		fragments: fragments,
+		holder:    coordination.NewHolder(),
+	}
+}
+
+// Run collects garbage every interval until ctx is done.
+func (c *Collector) Run(ctx context.Context) {
+	if c.cfg.Interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		stats, err := c.Collect(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("collect garbage")
+		}
+
+		log.Info().Int("stale_uploads", stats.StaleUploads).Int("orphan_fragments", stats.OrphanFragments).Msg("garbage collected")
+	}
+}
+
+// Collect removes stale uploads and then orphan fragments, one collection at a time.
+func (c *Collector) Collect(ctx context.Context) (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var stats Stats
+
+	servers, err := c.servers(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.StaleUploads, err = c.collectStaleUploads(ctx, servers)
+	if err != nil {
+		return stats, fmt.Errorf("collect stale uploads: %w", err)
+	}
+
+	stats.OrphanFragments, err = c.collectOrphans(ctx, servers)
+	if err != nil {
+		return stats, fmt.Errorf("collect orphan fragments: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Job collects garbage as an operator job.
+func (c *Collector) Job(ctx context.Context, p *jobs.Progress) error {
+	stats, err := c.Collect(ctx)
+
+	removed := int64(stats.StaleUploads + stats.OrphanFragments)
+	p.AddTotal(removed)
+	p.AddDone(removed)
+
+	return err
+}
+
+// servers returns servers which can be listed now. Disabled and unavailable
+// servers are skipped, their garbage is collected when they are back.
+func (c *Collector) servers(ctx context.Context) ([]fss.Server, error) {
+	servers, err := c.storage.Servers(ctx, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("get servers: %w", err)
+	}
+
+	available := make([]fss.Server, 0, len(servers))
+	for _, server := range servers {
+		if server.Mode != fss.ServerModeDisabled && c.fragments.Available(server.URL) {
+			available = append(available, server)
+		}
+	}
+
+	return available, nil
+}
+
+// collectStaleUploads removes fragments of uploads without a committed batch
+// for StaleAfter and then their metadata. Fragments of the last batch may be
+// stored but not recorded, so every server is listed by the file prefix.
+func (c *Collector) collectStaleUploads(ctx context.Context, servers []fss.Server) (int, error) {
+	files, err := c.storage.StaleFiles(ctx, time.Now().Add(-c.cfg.StaleAfter), c.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("get stale files: %w", err)
+	}
+
+	var removed int
+	for _, f := range files {
+		if err := c.removeUpload(ctx, servers, f); err != nil {
+			log.Info().Err(err).Str("file", f.Name).Msg("failed to remove stale upload")
+			continue
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// removeUpload holds the upload lease of the file, so the upload can't be
+// restarted while its fragments are deleted.
+func (c *Collector) removeUpload(ctx context.Context, servers []fss.Server, f fss.File) (err error) {
+	lease := coordination.NewLease(c.storage, coordination.UploadLease(f.Name), c.holder, uploadLeaseTTL)
+	if err := lease.Acquire(ctx); err != nil {
+		return fmt.Errorf("acquire upload lease: %w", err)
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(lease.Release(ctx), err)
+	}()
+
+	// The upload could be restarted before the lease was taken.
+	current, err := c.storage.File(ctx, f.Name)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	// An upload of a new version of a committed file leaves the committed version in place.
+	replacing := current.UploadVersion != nil
+	switch {
+	case replacing && (f.UploadVersion == nil || *current.UploadVersion != *f.UploadVersion ||
+		!sameTime(current.UploadCommittedAt, f.UploadCommittedAt)):
+		return nil
+
+	case !replacing && (current.Fragments != nil || !sameTime(current.LastCommittedAt, f.LastCommittedAt)):
+		return nil
+	}
+
+	for _, server := range servers {
+		fragments, err := c.fragments.ListFragments(ctx, server.URL, f.Name+"_")
+		if err != nil {
+			return fmt.Errorf("list fragments on '%s': %w", server.URL, err)
+		}
+
+		for _, fragment := range fragments {
+			filename, version, _, ok := fss.ParseFragmentName(fragment.Name)
+			if !ok || filename != f.Name || replacing && version != *current.UploadVersion {
+				continue
+			}
+
+			if err := c.deleteFragment(ctx, server.URL, fragment.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if replacing {
+		current.UploadVersion, current.UploadSize, current.UploadCommittedAt = nil, nil, nil
+
+		return ignoreNotFound(c.storage.UpdateFile(ctx, current))
+	}
+
+	return ignoreNotFound(c.storage.DeleteFile(ctx, f.Name))
+}
+
+// fileRefs describes which fragments of a file are referenced by metadata.
+type fileRefs struct {
+	// keep means every fragment of the file must be kept: the upload is running
+	// or the file placement is not recorded.
+	keep bool
+	// version is the committed version of the file, fragments of other versions are orphans.
+	version int64
+	servers map[int]int64
+}
+
+// collectOrphans removes fragments older than OrphanGrace which no file references.
+func (c *Collector) collectOrphans(ctx context.Context, servers []fss.Server) (int, error) {
+	refs := make(map[string]*fileRefs)
+	before := time.Now().Add(-c.cfg.OrphanGrace)
+
+	var removed int
+	for _, server := range servers {
+		fragments, err := c.fragments.ListFragments(ctx, server.URL, "")
+		if err != nil {
+			log.Info().Err(err).Str("server", server.URL).Msg("failed to list fragments")
+			continue
+		}
+
+		for _, fragment := range fragments {
+			filename, version, idx, ok := fss.ParseFragmentName(fragment.Name)
+			if !ok || !fragment.ModifiedAt.Before(before) {
+				continue
+			}
+
+			ref, ok := refs[filename]
+			if !ok {
+				if ref, err = c.fileRefs(ctx, filename); err != nil {
+					return removed, err
+				}
+
+				refs[filename] = ref
+			}
+
+			if serverID, ok := ref.servers[idx]; ref.keep || version == ref.version && ok && serverID == server.ID {
+				continue
+			}
+
+			if err := c.deleteFragment(ctx, server.URL, fragment.Name); err != nil {
+				log.Info().Err(err).Str("server", server.URL).Str("fragment", fragment.Name).Msg("failed to delete orphan fragment")
+				continue
+			}
+
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+func (c *Collector) fileRefs(ctx context.Context, filename string) (*fileRefs, error) {
+	f, err := c.storage.File(ctx, filename)
+	switch {
+	case errors.As(err, &fss.NotFoundError{}):
+		return &fileRefs{}, nil
+
+	case err != nil:
+		return nil, fmt.Errorf("get file '%s': %w", filename, err)
+
+	case f.Fragments == nil || f.UploadVersion != nil:
+		return &fileRefs{keep: true}, nil
+	}
+
+	fragments, err := c.storage.Fragments(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("get fragments of '%s': %w", filename, err)
+	}
+
+	ref := &fileRefs{
+		keep:    len(fragments) == 0 && *f.Fragments > 0,
+		version: f.Version,
+		servers: make(map[int]int64, len(fragments)),
+	}
+
+	for _, fragment := range fragments {
+		ref.servers[fragment.Index] = fragment.ServerID
+	}
+
+	return ref, nil
+}
+
+func (c *Collector) deleteFragment(ctx context.Context, serverURL, name string) error {
+	if err := ignoreNotFound(c.fragments.DeleteFragment(ctx, serverURL, name)); err != nil {
+		return fmt.Errorf("delete fragment '%s' on '%s': %w", name, serverURL, err)
+	}
+
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	var statusErr keeper.StatusError
+	if errors.As(err, &fss.NotFoundError{}) || errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
@@ -0,0 +1,210 @@
+package gc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/gc"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+const (
+	serverA = "http://fs-a"
+	serverB = "http://fs-b"
+)
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	fragments := memstore.NewFragmentStore()
+
+	for _, uri := range []string{serverA, serverB} {
+		assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: uri, Weight: 1, Mode: fss.ServerModeActive}))
+	}
+
+	servers, err := storage.Servers(ctx, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	store := func(uri, name string) {
+		assert.NoError(t, fragments.StoreFragment(ctx, uri, name, []byte(name)))
+	}
+
+	// Committed file with one fragment also left on a wrong server.
+	_, err = storage.CreateFile(ctx, "kept", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.CreateFragments(ctx, []fss.Fragment{
+		{FileName: "kept", Index: 0, ServerID: servers[0].ID, State: fss.FragmentStateStored},
+		{FileName: "kept", Index: 1, ServerID: servers[1].ID, State: fss.FragmentStateStored},
+	}))
+
+	committed := 2
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{Name: "kept", Fragments: &committed}))
+	store(serverA, "kept_0")
+	store(serverB, "kept_1")
+	store(serverA, "kept_1")
+
+	// Fragment of a file which doesn't exist and a foreign file.
+	store(serverA, "ghost_0")
+	store(serverB, "not-a-fragment")
+
+	// Crashed upload with the last batch not recorded.
+	_, err = storage.CreateFile(ctx, "stale", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	staleAt := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{Name: "stale", LastCommittedAt: &staleAt}))
+	store(serverA, "stale_0")
+	store(serverB, "stale_1")
+
+	// Running upload.
+	_, err = storage.CreateFile(ctx, "running", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	store(serverA, "running_0")
+
+	collector := gc.New(gc.Config{StaleAfter: time.Hour, OrphanGrace: time.Nanosecond}, storage, fragments)
+	time.Sleep(time.Millisecond)
+
+	stats, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, gc.Stats{StaleUploads: 1, OrphanFragments: 2}, stats)
+
+	_, err = storage.File(ctx, "stale")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	assert.Equal(t, []string{"kept_0", "running_0"}, names(t, fragments, serverA))
+	assert.Equal(t, []string{"kept_1", "not-a-fragment"}, names(t, fragments, serverB))
+}
+
+func TestCollectVersions(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	fragments := memstore.NewFragmentStore()
+
+	assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: serverA, Weight: 1, Mode: fss.ServerModeActive}))
+
+	servers, err := storage.Servers(ctx, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	store := func(name string) {
+		assert.NoError(t, fragments.StoreFragment(ctx, serverA, name, []byte(name)))
+	}
+
+	// Committed file with a crashed upload of its next version.
+	_, err = storage.CreateFile(ctx, "replaced", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.CreateFragments(ctx, []fss.Fragment{
+		{FileName: "replaced", Index: 0, ServerID: servers[0].ID, State: fss.FragmentStateStored},
+	}))
+
+	committed, version, staleAt := 1, int64(1), time.Now().Add(-2*time.Hour)
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{
+		Name:              "replaced",
+		Fragments:         &committed,
+		UploadVersion:     &version,
+		UploadCommittedAt: &staleAt,
+	}))
+	store("replaced_0")
+	store("replaced_0.1")
+	store("replaced_1.1")
+
+	// Committed second version with a fragment of the first one left.
+	_, err = storage.CreateFile(ctx, "updated", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{Name: "updated", Fragments: &committed, Version: version}))
+	assert.NoError(t, storage.CreateFragments(ctx, []fss.Fragment{
+		{FileName: "updated", Version: version, Index: 0, ServerID: servers[0].ID, State: fss.FragmentStateStored},
+	}))
+	store("updated_0")
+	store("updated_0.1")
+
+	collector := gc.New(gc.Config{StaleAfter: time.Hour, OrphanGrace: time.Nanosecond}, storage, fragments)
+	time.Sleep(time.Millisecond)
+
+	stats, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, gc.Stats{StaleUploads: 1, OrphanFragments: 1}, stats)
+
+	f, err := storage.File(ctx, "replaced")
+	if assert.NoError(t, err) {
+		assert.Nil(t, f.UploadVersion)
+		assert.Equal(t, &committed, f.Fragments)
+	}
+
+	assert.Equal(t, []string{"replaced_0", "updated_0.1"}, names(t, fragments, serverA))
+}
+
+func TestCollectSkipsUnavailableServers(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	fragments := memstore.NewFragmentStore()
+
+	assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: serverA, Weight: 1, Mode: fss.ServerModeActive}))
+	assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: serverB, Weight: 1, Mode: fss.ServerModeDisabled}))
+	assert.NoError(t, fragments.StoreFragment(ctx, serverA, "ghost_0", nil))
+	assert.NoError(t, fragments.StoreFragment(ctx, serverB, "ghost_1", nil))
+
+	_, err := storage.CreateFile(ctx, "stale", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	staleAt := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{Name: "stale", LastCommittedAt: &staleAt}))
+	assert.NoError(t, fragments.StoreFragment(ctx, serverA, "stale_0", nil))
+
+	fragments.SetUnavailable(serverA, true)
+
+	collector := gc.New(gc.Config{StaleAfter: time.Hour, OrphanGrace: time.Nanosecond}, storage, fragments)
+	stats, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, gc.Stats{StaleUploads: 1}, stats)
+
+	fragments.SetUnavailable(serverA, false)
+	assert.Equal(t, []string{"ghost_0", "stale_0"}, names(t, fragments, serverA))
+	assert.Equal(t, []string{"ghost_1"}, names(t, fragments, serverB))
+}
+
+func TestCollectSkipsLeasedUploads(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	fragments := memstore.NewFragmentStore()
+
+	assert.NoError(t, storage.CreateServer(ctx, fss.Server{URL: serverA, Weight: 1, Mode: fss.ServerModeActive}))
+
+	_, err := storage.CreateFile(ctx, "stale", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	staleAt := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, storage.UpdateFile(ctx, &fss.File{Name: "stale", LastCommittedAt: &staleAt}))
+	assert.NoError(t, fragments.StoreFragment(ctx, serverA, "stale_0", nil))
+	assert.NoError(t, storage.AcquireLease(ctx, coordination.UploadLease("stale"), "upload", time.Minute))
+
+	collector := gc.New(gc.Config{StaleAfter: time.Hour}, storage, fragments)
+	stats, err := collector.Collect(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, gc.Stats{}, stats)
+
+	_, err = storage.File(ctx, "stale")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stale_0"}, names(t, fragments, serverA))
+}
+
+func names(t *testing.T, fragments *memstore.FragmentStore, uri string) []string {
+	infos, err := fragments.ListFragments(context.Background(), uri, "")
+	assert.NoError(t, err)
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+
+	return names
+}
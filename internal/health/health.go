@@ -0,0 +1,86 @@
+// Package health reports liveness and readiness of a server and rejects new
+// requests before the server shuts down.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+// Statuses of the health endpoints.
+const (
+	StatusOK       = "ok"
+	StatusDraining = "draining"
+)
+
+// Response is the body of the health endpoints.
+type Response struct {
+	Status string `json:"status"`
+}
+
+// State is the draining state of a server, the zero value is serving.
+type State struct {
+	draining  atomic.Bool
+	rejecting atomic.Bool
+}
+
+// Drain makes the server not ready, requests are still served until Reject.
+func (s *State) Drain() {
+	s.draining.Store(true)
+}
+
+// Reject drains the server and rejects new requests.
+func (s *State) Reject() {
+	s.draining.Store(true)
+	s.rejecting.Store(true)
+}
+
+// Draining reports whether the server drains.
+func (s *State) Draining() bool {
+	return s.draining.Load()
+}
+
+// Live answers 200 while the process serves requests, draining included.
+func (s *State) Live(w http.ResponseWriter, _ *http.Request) {
+	s.write(w, http.StatusOK)
+}
+
+// Ready answers 503 while the server drains, so load balancers stop sending requests.
+func (s *State) Ready(w http.ResponseWriter, _ *http.Request) {
+	status := http.StatusOK
+	if s.Draining() {
+		status = http.StatusServiceUnavailable
+	}
+
+	s.write(w, status)
+}
+
+// Middleware rejects requests with 503 once the server rejects them.
+func (s *State) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.rejecting.Load() {
+			ctx := r.Context()
+			w.Header().Set("Connection", "close")
+			httperr.Render(ctx, fss.LoggerFromCtx(ctx), fss.NewUnavailableError("server is shutting down"), w)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *State) write(w http.ResponseWriter, status int) {
+	resp := Response{Status: StatusOK}
+	if s.Draining() {
+		resp.Status = StatusDraining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
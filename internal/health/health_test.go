@@ -0,0 +1,61 @@
+package health_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsapen/fss/internal/health"
+)
+
+func TestState(t *testing.T) {
+	state := new(health.State)
+	api := state.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		drain      bool
+		reject     bool
+		wantStatus string
+		wantReady  int
+		wantAPI    int
+	}{
+		{name: "serving", wantStatus: health.StatusOK, wantReady: http.StatusOK, wantAPI: http.StatusOK},
+		{name: "draining", drain: true, wantStatus: health.StatusDraining, wantReady: http.StatusServiceUnavailable, wantAPI: http.StatusOK},
+		{name: "rejecting", reject: true, wantStatus: health.StatusDraining, wantReady: http.StatusServiceUnavailable, wantAPI: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.drain {
+				state.Drain()
+			}
+
+			if tt.reject {
+				state.Reject()
+			}
+
+			live := httptest.NewRecorder()
+			state.Live(live, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, live.Code)
+
+			var resp health.Response
+			require.NoError(t, json.NewDecoder(live.Body).Decode(&resp))
+			assert.Equal(t, tt.wantStatus, resp.Status)
+
+			ready := httptest.NewRecorder()
+			state.Ready(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantReady, ready.Code)
+
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/file", nil))
+			assert.Equal(t, tt.wantAPI, w.Code)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package httperr renders fss errors as JSON error responses shared by the FSS and file server APIs.
+package httperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Error codes of the response body.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeLocked              = "locked"
+	CodeRangeNotSatisfiable = "range_not_satisfiable"
+	CodeTooLarge            = "too_large"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeUnavailable         = "unavailable"
+	CodeInternal            = "internal"
+)
+
+// maxBodySize limits error bodies read from responses.
+const maxBodySize = 64 << 10
+
+// Response is the body of error responses.
+type Response struct {
+	Error Body `json:"error"`
+}
+
+// Body describes an error.
+type Body struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	RequestID string         `json:"request_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// DetailedError adds details to the error response.
+type DetailedError struct {
+	Err     error
+	Details map[string]any
+}
+
+func (err DetailedError) Error() string {
+	return err.Err.Error()
+}
+
+func (err DetailedError) Unwrap() error {
+	return err.Err
+}
+
+// WithDetails attaches details which are rendered with the error.
+func WithDetails(err error, details map[string]any) error {
+	return DetailedError{Err: err, Details: details}
+}
+
+// Status returns the http status and the code of the error.
+func Status(err error) (int, string) {
+	switch {
+	case errors.As(err, &fss.ValidationError{}), errors.As(err, &fss.BadRequestError{}):
+		return http.StatusBadRequest, CodeBadRequest
+
+	case errors.As(err, &fss.UnauthorizedError{}):
+		return http.StatusUnauthorized, CodeUnauthorized
+
+	case errors.As(err, &fss.NotFoundError{}):
+		return http.StatusNotFound, CodeNotFound
+
+	case errors.As(err, &fss.ConflictError{}):
+		return http.StatusConflict, CodeConflict
+
+	case errors.As(err, &fss.PreconditionFailedError{}):
+		return http.StatusPreconditionFailed, CodePreconditionFailed
+
+	case errors.As(err, &fss.LockedError{}):
+		return http.StatusLocked, CodeLocked
+
+	case errors.As(err, &fss.RangeNotSatisfiableError{}):
+		return http.StatusRequestedRangeNotSatisfiable, CodeRangeNotSatisfiable
+
+	case errors.As(err, &fss.TooLargeError{}):
+		return http.StatusRequestEntityTooLarge, CodeTooLarge
+
+	case errors.As(err, &fss.QuotaExceededError{}):
+		return http.StatusInsufficientStorage, CodeQuotaExceeded
+
+	case errors.As(err, &fss.UnavailableError{}):
+		return http.StatusServiceUnavailable, CodeUnavailable
+
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+// Render writes the error response. Messages of internal errors are not exposed.
+func Render(ctx context.Context, logger zerolog.Logger, err error, w http.ResponseWriter) {
+	statusCode, code := Status(err)
+
+	body := Body{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: fss.ReqIDFromCtx(ctx),
+	}
+
+	if statusCode == http.StatusInternalServerError {
+		body.Message = http.StatusText(statusCode)
+	}
+
+	var detailed DetailedError
+	if errors.As(err, &detailed) {
+		body.Details = detailed.Details
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if encodeErr := json.NewEncoder(w).Encode(Response{Error: body}); encodeErr != nil {
+		logger.Info().Err(encodeErr).Msg("failed to write error response")
+	}
+
+	logger.Info().Err(err).Int("status code", statusCode).Msg("failed to process message")
+}
+
+// Read decodes the error response, ok is false if the body is not an error response.
+func Read(r io.Reader) (body Body, ok bool) {
+	var resp Response
+	if err := json.NewDecoder(io.LimitReader(r, maxBodySize)).Decode(&resp); err != nil || resp.Error.Code == "" {
+		return Body{}, false
+	}
+
+	return resp.Error, true
+}
@@ -0,0 +1,93 @@
+package httperr_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   httperr.Body
+	}{
+		{
+			name:   "bad request with details",
+			err:    httperr.WithDetails(fss.NewBadRequestError("filename is empty"), map[string]any{"parameter": "filename"}),
+			status: http.StatusBadRequest,
+			want: httperr.Body{
+				Code:      httperr.CodeBadRequest,
+				Message:   "filename is empty",
+				RequestID: "req",
+				Details:   map[string]any{"parameter": "filename"},
+			},
+		},
+		{
+			name:   "wrapped not found",
+			err:    fmt.Errorf("get file: %w", fss.NewNotFoundError("file not found")),
+			status: http.StatusNotFound,
+			want:   httperr.Body{Code: httperr.CodeNotFound, Message: "get file: file not found", RequestID: "req"},
+		},
+		{
+			name:   "locked",
+			err:    fss.NewLockedError("file is being uploaded"),
+			status: http.StatusLocked,
+			want:   httperr.Body{Code: httperr.CodeLocked, Message: "file is being uploaded", RequestID: "req"},
+		},
+		{
+			name:   "range not satisfiable",
+			err:    fss.NewRangeNotSatisfiableError("range starts after the end"),
+			status: http.StatusRequestedRangeNotSatisfiable,
+			want:   httperr.Body{Code: httperr.CodeRangeNotSatisfiable, Message: "range starts after the end", RequestID: "req"},
+		},
+		{
+			name:   "too large",
+			err:    fss.NewTooLargeError("file is larger than 10 bytes"),
+			status: http.StatusRequestEntityTooLarge,
+			want:   httperr.Body{Code: httperr.CodeTooLarge, Message: "file is larger than 10 bytes", RequestID: "req"},
+		},
+		{
+			name:   "quota exceeded",
+			err:    fss.NewQuotaExceededError("bucket 'photos' exceeds its quota"),
+			status: http.StatusInsufficientStorage,
+			want:   httperr.Body{Code: httperr.CodeQuotaExceeded, Message: "bucket 'photos' exceeds its quota", RequestID: "req"},
+		},
+		{
+			name:   "internal error is hidden",
+			err:    errors.New("password=secret"),
+			status: http.StatusInternalServerError,
+			want:   httperr.Body{Code: httperr.CodeInternal, Message: "Internal Server Error", RequestID: "req"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			httperr.Render(fss.WithReqID(context.Background(), "req"), zerolog.Nop(), tt.err, w)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			body, ok := httperr.Read(w.Body)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, body)
+		})
+	}
+}
+
+func TestReadForeignBody(t *testing.T) {
+	_, ok := httperr.Read(bytes.NewBufferString("storage error"))
+	assert.False(t, ok)
+}
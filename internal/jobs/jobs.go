@@ -0,0 +1,431 @@
+// Package jobs runs maintenance jobs started by operators on the leader replica and keeps
+// their progress in the metadata storage, so every replica reports them. Jobs started on
+// other replicas are saved pending and claimed by the leader.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Job kinds.
+const (
+	KindGC        = "gc"
+	KindScrub     = "scrub"
+	KindRebalance = "rebalance"
+)
+
+// Job states.
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+const (
+	// maxJobs is the number of the latest jobs which are listed.
+	maxJobs = 100
+	// maxIssues bounds issues reported by one job.
+	maxIssues = 100
+
+	// saveInterval is how often progress of running jobs is saved.
+	saveInterval = time.Second
+	saveTimeout  = 5 * time.Second
+
+	// claimInterval is how often the leader looks for pending jobs.
+	claimInterval = time.Second
+)
+
+// Store keeps jobs. Job returns fss.NotFoundError for unknown jobs,
+// Jobs returns the latest jobs ordered by start time.
+type Store interface {
+	SaveJob(ctx context.Context, job fss.Job) error
+	Job(ctx context.Context, id string) (*fss.Job, error)
+	Jobs(ctx context.Context, limit int) ([]fss.Job, error)
+}
+
+// Runner does the work of a job and reports progress.
+type Runner func(ctx context.Context, p *Progress) error
+
+// Progress is updated by the runner of a job.
+type Progress struct {
+	mu  sync.Mutex
+	job fss.Job
+}
+
+// AddTotal adds discovered items.
+func (p *Progress) AddTotal(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Total += n
+}
+
+// Advance marks an item processed.
+func (p *Progress) Advance() {
+	p.AddDone(1)
+}
+
+// AddDone marks n items processed.
+func (p *Progress) AddDone(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Done += n
+}
+
+// Fail marks an item processed with the issue.
+func (p *Progress) Fail(format string, a ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Done++
+	p.job.Failed++
+	if len(p.job.Issues) < maxIssues {
+		p.job.Issues = append(p.job.Issues, fmt.Sprintf(format, a...))
+	}
+}
+
+func (p *Progress) snapshot() fss.Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	job := p.job
+	job.Issues = append([]string(nil), p.job.Issues...)
+
+	return job
+}
+
+func (p *Progress) finish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.job.FinishedAt = &now
+
+	switch {
+	case err == nil:
+		p.job.State = StateSucceeded
+
+	case ctxErr(err):
+		p.job.State, p.job.Error = StateCanceled, err.Error()
+
+	default:
+		p.job.State, p.job.Error = StateFailed, err.Error()
+	}
+}
+
+// Manager starts jobs of registered kinds, one running job per kind. Jobs run
+// only while the replica leads, see Lead.
+type Manager struct {
+	store  Store
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	runners map[string]Runner
+	leader  context.Context
+	running map[string]string
+}
+
+// NewManager creates manager which keeps jobs in the store.
+func NewManager(store Store) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		store:   store,
+		ctx:     ctx,
+		cancel:  cancel,
+		runners: make(map[string]Runner),
+		running: make(map[string]string),
+	}
+}
+
+// Register adds a job kind.
+func (m *Manager) Register(kind string, run Runner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runners[kind] = run
+}
+
+// Lead lets the manager start jobs until ctx is done, it is run by the replica
+// which holds the leader lease. Jobs left running by former leaders are marked
+// canceled first, pending jobs are claimed every claimInterval. Running jobs are
+// canceled and waited for when ctx is done.
+func (m *Manager) Lead(ctx context.Context) {
+	if err := m.cancelOrphans(ctx); err != nil {
+		log.Error().Err(err).Msg("cancel jobs of former leaders")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := context.AfterFunc(m.ctx, cancel)
+	defer stop()
+
+	m.mu.Lock()
+	m.leader = ctx
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(claimInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		if err := m.claimPending(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("claim pending jobs")
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	m.mu.Lock()
+	m.leader = nil
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+// Leading reports whether the manager starts jobs.
+func (m *Manager) Leading() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.leader != nil && m.leader.Err() == nil
+}
+
+// Start starts a job of the kind in background. Replicas which don't lead save
+// the job pending, the leader runs it once no job of the kind is running.
+func (m *Manager) Start(ctx context.Context, kind string) (fss.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.runners[kind]
+	if !ok {
+		return fss.Job{}, fss.NewValidationError("unknown job kind '%s'", kind)
+	}
+
+	if m.ctx.Err() != nil {
+		return fss.Job{}, fss.NewUnavailableError("jobs are stopped")
+	}
+
+	job := fss.Job{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		StartedAt: time.Now(),
+	}
+
+	if m.leader == nil || m.leader.Err() != nil {
+		return m.queue(ctx, job)
+	}
+
+	if id, ok := m.running[kind]; ok {
+		return fss.Job{}, fss.NewConflictError("%s job '%s' is running", kind, id)
+	}
+
+	return m.launch(ctx, job, run)
+}
+
+// queue saves the job pending unless a job of the kind is pending or running.
+func (m *Manager) queue(ctx context.Context, job fss.Job) (fss.Job, error) {
+	jobs, err := m.store.Jobs(ctx, maxJobs)
+	if err != nil {
+		return fss.Job{}, fmt.Errorf("get jobs: %w", err)
+	}
+
+	for _, j := range jobs {
+		if j.Kind == job.Kind && (j.State == StatePending || j.State == StateRunning) {
+			return fss.Job{}, fss.NewConflictError("%s job '%s' is %s", j.Kind, j.ID, j.State)
+		}
+	}
+
+	job.State = StatePending
+	if err := m.store.SaveJob(ctx, job); err != nil {
+		return fss.Job{}, fmt.Errorf("save job: %w", err)
+	}
+
+	return job, nil
+}
+
+// launch saves the job running and runs it until the leadership is lost, m.mu is held.
+func (m *Manager) launch(ctx context.Context, job fss.Job, run Runner) (fss.Job, error) {
+	job.State = StateRunning
+	p := &Progress{job: job}
+
+	job = p.snapshot()
+	if err := m.store.SaveJob(ctx, job); err != nil {
+		return fss.Job{}, fmt.Errorf("save job: %w", err)
+	}
+
+	m.running[job.Kind] = job.ID
+
+	m.wg.Add(1)
+	go m.run(m.leader, p, run)
+
+	return job, nil
+}
+
+// claimPending runs pending jobs oldest first. Jobs of a running kind stay pending
+// until it finishes, jobs of kinds unknown to the leader fail.
+func (m *Manager) claimPending(ctx context.Context) error {
+	jobs, err := m.store.Jobs(ctx, maxJobs)
+	if err != nil {
+		return fmt.Errorf("get jobs: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range jobs {
+		if job.State != StatePending {
+			continue
+		}
+
+		if m.leader == nil || m.leader.Err() != nil {
+			return nil
+		}
+
+		if _, ok := m.running[job.Kind]; ok {
+			continue
+		}
+
+		run, ok := m.runners[job.Kind]
+		if !ok {
+			now := time.Now()
+			job.State, job.FinishedAt, job.Error = StateFailed, &now, fmt.Sprintf("unknown job kind '%s'", job.Kind)
+			if err := m.store.SaveJob(ctx, job); err != nil {
+				return fmt.Errorf("save job '%s': %w", job.ID, err)
+			}
+
+			continue
+		}
+
+		if _, err := m.launch(ctx, job, run); err != nil {
+			return fmt.Errorf("claim job '%s': %w", job.ID, err)
+		}
+
+		log.Info().Str("job", job.ID).Str("kind", job.Kind).Msg("pending job claimed")
+	}
+
+	return nil
+}
+
+func (m *Manager) run(ctx context.Context, p *Progress, run Runner) {
+	defer m.wg.Done()
+
+	saveCtx, stopSaving := context.WithCancel(context.Background())
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		m.saveProgress(saveCtx, p)
+	}()
+
+	err := run(ctx, p)
+
+	stopSaving()
+	<-saved
+
+	// The kind is free once the job is seen finished.
+	p.finish(err)
+	job := p.snapshot()
+	m.save(job)
+
+	m.mu.Lock()
+	delete(m.running, job.Kind)
+	m.mu.Unlock()
+
+	log.Info().Err(err).Str("job", job.ID).Str("kind", job.Kind).Int64("done", job.Done).Int64("failed", job.Failed).Msg("job finished")
+}
+
+// saveProgress saves progress of the running job every saveInterval until ctx is done.
+func (m *Manager) saveProgress(ctx context.Context, p *Progress) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		m.save(p.snapshot())
+	}
+}
+
+// save keeps the job, it doesn't depend on the context of the job which may be canceled.
+func (m *Manager) save(job fss.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	if err := m.store.SaveJob(ctx, job); err != nil {
+		log.Error().Err(err).Str("job", job.ID).Msg("save job")
+	}
+}
+
+// cancelOrphans marks jobs which former leaders left running canceled.
+func (m *Manager) cancelOrphans(ctx context.Context) error {
+	jobs, err := m.store.Jobs(ctx, maxJobs)
+	if err != nil {
+		return fmt.Errorf("get jobs: %w", err)
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if job.State != StateRunning {
+			continue
+		}
+
+		job.State, job.FinishedAt, job.Error = StateCanceled, &now, "leader changed"
+		if err := m.store.SaveJob(ctx, job); err != nil {
+			return fmt.Errorf("save job '%s': %w", job.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Job returns the job by id.
+func (m *Manager) Job(ctx context.Context, id string) (fss.Job, error) {
+	job, err := m.store.Job(ctx, id)
+	if err != nil {
+		return fss.Job{}, fmt.Errorf("get job '%s': %w", id, err)
+	}
+
+	return *job, nil
+}
+
+// Jobs returns the latest jobs ordered by start time.
+func (m *Manager) Jobs(ctx context.Context) ([]fss.Job, error) {
+	jobs, err := m.store.Jobs(ctx, maxJobs)
+	if err != nil {
+		return nil, fmt.Errorf("get jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Close cancels running jobs and waits for them.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+func ctxErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,206 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+func wait(t *testing.T, m *jobs.Manager, id string) fss.Job {
+	t.Helper()
+
+	var job fss.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Job(context.Background(), id)
+		require.NoError(t, err)
+
+		return job.State != jobs.StatePending && job.State != jobs.StateRunning
+	}, 3*time.Second, time.Millisecond)
+
+	return job
+}
+
+// lead makes the manager lead until the returned function is called.
+func lead(t *testing.T, m *jobs.Manager) func() {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Lead(ctx)
+	}()
+
+	require.Eventually(t, m.Leading, time.Second, time.Millisecond)
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	m := jobs.NewManager(memstore.NewStorage())
+	defer m.Close()
+
+	release := make(chan struct{})
+	m.Register(jobs.KindScrub, func(ctx context.Context, p *jobs.Progress) error {
+		p.AddTotal(3)
+		p.Advance()
+		p.Fail("fragment %d is missing", 1)
+		<-release
+		p.Advance()
+
+		return nil
+	})
+
+	m.Register(jobs.KindGC, func(ctx context.Context, p *jobs.Progress) error {
+		return errors.New("no servers")
+	})
+
+	// Replicas which don't lead save jobs pending.
+	job, err := m.Start(ctx, jobs.KindScrub)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatePending, job.State)
+
+	_, err = m.Start(ctx, jobs.KindScrub)
+	assert.ErrorAs(t, err, &fss.ConflictError{}, "scrub job is pending")
+
+	resign := lead(t, m)
+	defer resign()
+
+	require.Eventually(t, func() bool {
+		claimed, err := m.Job(ctx, job.ID)
+		require.NoError(t, err)
+
+		return claimed.State == jobs.StateRunning
+	}, 3*time.Second, time.Millisecond)
+
+	_, err = m.Start(ctx, jobs.KindScrub)
+	assert.ErrorAs(t, err, &fss.ConflictError{})
+
+	_, err = m.Start(ctx, "unknown")
+	assert.ErrorAs(t, err, &fss.ValidationError{})
+
+	_, err = m.Job(ctx, "unknown")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	close(release)
+	job = wait(t, m, job.ID)
+	assert.Equal(t, jobs.StateSucceeded, job.State)
+	assert.Equal(t, int64(3), job.Total)
+	assert.Equal(t, int64(3), job.Done)
+	assert.Equal(t, int64(1), job.Failed)
+	assert.Equal(t, []string{"fragment 1 is missing"}, job.Issues)
+	assert.NotNil(t, job.FinishedAt)
+
+	failed, err := m.Start(ctx, jobs.KindGC)
+	require.NoError(t, err)
+
+	failed = wait(t, m, failed.ID)
+	assert.Equal(t, jobs.StateFailed, failed.State)
+	assert.Equal(t, "no servers", failed.Error)
+
+	_, err = m.Start(ctx, jobs.KindScrub)
+	assert.NoError(t, err)
+
+	all, err := m.Jobs(ctx)
+	require.NoError(t, err)
+	if assert.Len(t, all, 3) {
+		assert.Equal(t, job.ID, all[0].ID)
+		assert.Equal(t, failed.ID, all[1].ID)
+	}
+}
+
+func TestManagerLeadership(t *testing.T) {
+	ctx := context.Background()
+	storage := memstore.NewStorage()
+	runRebalance := func(ctx context.Context, p *jobs.Progress) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	former := jobs.NewManager(storage)
+	defer former.Close()
+	former.Register(jobs.KindRebalance, runRebalance)
+
+	resign := lead(t, former)
+	job, err := former.Start(ctx, jobs.KindRebalance)
+	require.NoError(t, err)
+
+	// The job is canceled when the leadership is lost.
+	resign()
+	job = wait(t, former, job.ID)
+	assert.Equal(t, jobs.StateCanceled, job.State)
+
+	// Jobs started while nobody leads wait for the next leader.
+	pending, err := former.Start(ctx, jobs.KindRebalance)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatePending, pending.State)
+
+	unknown := fss.Job{ID: "unknown", Kind: "unknown", State: jobs.StatePending, StartedAt: time.Now()}
+	require.NoError(t, storage.SaveJob(ctx, unknown))
+
+	// A leader which crashed leaves its job running, the next leader cancels it.
+	orphan := fss.Job{ID: "orphan", Kind: jobs.KindRebalance, State: jobs.StateRunning, StartedAt: time.Now()}
+	require.NoError(t, storage.SaveJob(ctx, orphan))
+
+	next := jobs.NewManager(storage)
+	defer next.Close()
+	next.Register(jobs.KindRebalance, runRebalance)
+
+	defer lead(t, next)()
+
+	orphan, err = next.Job(ctx, orphan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StateCanceled, orphan.State)
+	assert.NotNil(t, orphan.FinishedAt)
+
+	require.Eventually(t, func() bool {
+		pending, err = next.Job(ctx, pending.ID)
+		require.NoError(t, err)
+
+		return pending.State == jobs.StateRunning
+	}, 3*time.Second, time.Millisecond)
+
+	_, err = next.Start(ctx, jobs.KindRebalance)
+	assert.ErrorAs(t, err, &fss.ConflictError{}, "the claimed job is running")
+
+	unknown = wait(t, next, unknown.ID)
+	assert.Equal(t, jobs.StateFailed, unknown.State)
+	assert.Equal(t, "unknown job kind 'unknown'", unknown.Error)
+}
+
+func TestManagerClose(t *testing.T) {
+	ctx := context.Background()
+	m := jobs.NewManager(memstore.NewStorage())
+	m.Register(jobs.KindRebalance, func(ctx context.Context, p *jobs.Progress) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	resign := lead(t, m)
+	defer resign()
+
+	job, err := m.Start(ctx, jobs.KindRebalance)
+	require.NoError(t, err)
+
+	m.Close()
+
+	job, err = m.Job(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StateCanceled, job.State)
+
+	_, err = m.Start(ctx, jobs.KindRebalance)
+	assert.ErrorAs(t, err, &fss.UnavailableError{})
+}
@@ -0,0 +1,183 @@
+package keeper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBreakerFailures       = 5
+	defaultBreakerOpenTimeout    = 10 * time.Second
+	defaultBreakerHalfOpenProbes = 1
+)
+
+// BreakerState is a state of the file server circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+
+	case BreakerOpen:
+		return "open"
+
+	case BreakerHalfOpen:
+		return "half-open"
+
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// breaker tracks request outcomes of one file server.
+type breaker struct {
+	uri         string
+	failures    int
+	openTimeout time.Duration
+	probes      int
+
+	mu             sync.Mutex
+	state          BreakerState
+	consecutive    int
+	openedAt       time.Time
+	probesInFlight int
+}
+
+func newBreaker(uri string, failures int, openTimeout time.Duration, probes int) *breaker {
+	return &breaker{
+		uri:         uri,
+		failures:    failures,
+		openTimeout: openTimeout,
+		probes:      probes,
+	}
+}
+
+// allow reports whether a request may be sent to the server.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+
+		b.setState(BreakerHalfOpen)
+		fallthrough
+
+	case BreakerHalfOpen:
+		if b.probesInFlight >= b.probes {
+			return false
+		}
+
+		b.probesInFlight++
+	}
+
+	return true
+}
+
+// record feeds the request outcome into the breaker.
+func (b *breaker) record(success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probesInFlight > 0 {
+		b.probesInFlight--
+	}
+
+	if success {
+		b.consecutive = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+
+		return
+	}
+
+	b.consecutive++
+	if b.state == BreakerHalfOpen || b.consecutive >= b.failures {
+		b.openedAt = now
+		b.setState(BreakerOpen)
+	}
+}
+
+// release frees the probe slot taken by a request that was cancelled by the caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probesInFlight > 0 {
+		b.probesInFlight--
+	}
+}
+
+// rejects reports whether the breaker is open and the open timeout has not expired yet.
+func (b *breaker) rejects(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == BreakerOpen && now.Sub(b.openedAt) < b.openTimeout
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+
+	log.Info().Str("server", b.uri).Stringer("from", b.state).Stringer("to", state).Msg("circuit breaker state changed")
+	b.state = state
+	b.probesInFlight = 0
+}
+
+func (k *Keeper) breaker(uri string) *breaker {
+	k.breakersMu.Lock()
+	defer k.breakersMu.Unlock()
+
+	b, ok := k.breakers[uri]
+	if !ok {
+		b = newBreaker(uri, k.cfg.BreakerFailures, k.cfg.BreakerOpenTimeout, k.cfg.BreakerHalfOpenProbes)
+		k.breakers[uri] = b
+	}
+
+	return b
+}
+
+// Available reports whether requests to the server are allowed by its circuit breaker.
+func (k *Keeper) Available(uri string) bool {
+	return !k.breaker(uri).rejects(time.Now())
+}
+
+// BreakerStates returns circuit breaker state of every known file server.
+func (k *Keeper) BreakerStates() map[string]BreakerState {
+	k.breakersMu.Lock()
+	defer k.breakersMu.Unlock()
+
+	states := make(map[string]BreakerState, len(k.breakers))
+	for uri, b := range k.breakers {
+		states[uri] = b.current()
+	}
+
+	return states
+}
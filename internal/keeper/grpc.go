@@ -0,0 +1,298 @@
+package keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/Tsapen/fss/internal/fspb"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/tracing"
+)
+
+const grpcChunkSize = 64 << 10
+
+// grpcTransport talks to file servers registered with grpc:// urls.
+type grpcTransport struct {
+	unixSockets map[string]string
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func newGRPCTransport(cfg Config) *grpcTransport {
+	return &grpcTransport{
+		unixSockets: cfg.UnixSockets,
+		conns:       make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (t *grpcTransport) Get(ctx context.Context, serverURL, name string) (io.ReadCloser, int64, error) {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.Get(ctx, &fspb.GetRequest{Name: name})
+	if err != nil {
+		cancel()
+		return nil, 0, statusErr(err)
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return nil, 0, statusErr(err)
+	}
+
+	return &getReader{stream: stream, buf: first.GetChunk(), cancel: cancel}, first.GetSize(), nil
+}
+
+// getReader adapts server stream of chunks to io.ReadCloser.
+type getReader struct {
+	stream fspb.FileServer_GetClient
+	buf    []byte
+	cancel context.CancelFunc
+}
+
+func (r *getReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.EOF
+			}
+
+			return 0, statusErr(err)
+		}
+
+		r.buf = msg.GetChunk()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *getReader) Close() error {
+	r.cancel()
+
+	return nil
+}
+
+func (t *grpcTransport) Store(ctx context.Context, serverURL, name string, fragment []byte) error {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return err
+	}
+
+	stream, err := client.Put(ctx)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	msg := &fspb.PutRequest{Name: name}
+	for first := true; first || len(fragment) > 0; first = false {
+		n := min(len(fragment), grpcChunkSize)
+		msg.Chunk, fragment = fragment[:n], fragment[n:]
+
+		if err := stream.Send(msg); err != nil && !errors.Is(err, io.EOF) {
+			return statusErr(err)
+		}
+
+		msg = &fspb.PutRequest{}
+	}
+
+	if _, err = stream.CloseAndRecv(); err != nil {
+		return statusErr(err)
+	}
+
+	return nil
+}
+
+func (t *grpcTransport) Delete(ctx context.Context, serverURL, name string) error {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return err
+	}
+
+	if _, err = client.Delete(ctx, &fspb.DeleteRequest{Name: name}); err != nil {
+		return statusErr(err)
+	}
+
+	return nil
+}
+
+func (t *grpcTransport) Stat(ctx context.Context, serverURL, name string) (*fss.FragmentInfo, error) {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Stat(ctx, &fspb.StatRequest{Name: name})
+	if err != nil {
+		return nil, statusErr(err)
+	}
+
+	return &fss.FragmentInfo{
+		Name:       resp.GetName(),
+		Size:       resp.GetSize(),
+		ModifiedAt: resp.GetModifiedAt().AsTime(),
+	}, nil
+}
+
+func (t *grpcTransport) Exists(ctx context.Context, serverURL string, names []string) ([]bool, error) {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Exists(ctx, &fspb.ExistsRequest{Names: names})
+	if err != nil {
+		return nil, statusErr(err)
+	}
+
+	return resp.GetExists(), nil
+}
+
+func (t *grpcTransport) List(ctx context.Context, serverURL, prefix string) ([]fss.FragmentInfo, error) {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := client.List(ctx, &fspb.ListRequest{Prefix: prefix})
+	if err != nil {
+		return nil, statusErr(err)
+	}
+
+	var fragments []fss.FragmentInfo
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return fragments, nil
+		}
+
+		if err != nil {
+			return nil, statusErr(err)
+		}
+
+		for _, info := range msg.GetFragments() {
+			fragments = append(fragments, fss.FragmentInfo{
+				Name:       info.GetName(),
+				Size:       info.GetSize(),
+				ModifiedAt: info.GetModifiedAt().AsTime(),
+			})
+		}
+	}
+}
+
+func (t *grpcTransport) Stats(ctx context.Context, serverURL string) (*fss.ServerStats, error) {
+	client, err := t.client(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Stats(ctx, &fspb.StatsRequest{})
+	if err != nil {
+		return nil, statusErr(err)
+	}
+
+	return &fss.ServerStats{
+		Capacity:  resp.GetCapacity(),
+		Used:      resp.GetUsed(),
+		Free:      resp.GetFree(),
+		Fragments: resp.GetFragments(),
+	}, nil
+}
+
+func (t *grpcTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs error
+	for target, conn := range t.conns {
+		errs = errors.Join(errs, conn.Close())
+		delete(t.conns, target)
+	}
+
+	return errs
+}
+
+// client returns a client on the shared connection to the server.
+func (t *grpcTransport) client(serverURL string) (fspb.FileServerClient, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	target := parsed.Host
+	if socket, ok := t.unixSockets[target]; ok {
+		target = "unix://" + socket
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conn, ok := t.conns[target]
+	if !ok {
+		conn, err = grpc.Dial(target,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor),
+			grpc.WithStreamInterceptor(tracing.StreamClientInterceptor),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %w", target, err)
+		}
+
+		t.conns[target] = conn
+	}
+
+	return fspb.NewFileServerClient(conn), nil
+}
+
+// statusErr converts grpc status into StatusError so that retries and
+// circuit breaking work the same way for every transport.
+func statusErr(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	var code int
+	switch st.Code() {
+	case codes.Canceled:
+		return context.Canceled
+
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+
+	case codes.NotFound:
+		code = http.StatusNotFound
+
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+
+	default:
+		code = http.StatusInternalServerError
+	}
+
+	return fmt.Errorf("%s: %w", st.Message(), StatusError{Code: code})
+}
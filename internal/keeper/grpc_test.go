@@ -0,0 +1,127 @@
+package keeper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Tsapen/fss/internal/fspb"
+)
+
+type memFileServer struct {
+	fspb.UnimplementedFileServerServer
+
+	mu        sync.Mutex
+	fragments map[string][]byte
+}
+
+func (m *memFileServer) Put(stream fspb.FileServer_PutServer) error {
+	var name string
+	data := new(bytes.Buffer)
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msg.GetName() != "" {
+			name = msg.GetName()
+		}
+
+		data.Write(msg.GetChunk())
+	}
+
+	m.mu.Lock()
+	m.fragments[name] = data.Bytes()
+	m.mu.Unlock()
+
+	return stream.SendAndClose(&fspb.PutResponse{Size: int64(data.Len())})
+}
+
+func (m *memFileServer) Get(req *fspb.GetRequest, stream fspb.FileServer_GetServer) error {
+	m.mu.Lock()
+	data, ok := m.fragments[req.GetName()]
+	m.mu.Unlock()
+
+	if !ok {
+		return status.Error(codes.NotFound, "not found")
+	}
+
+	return stream.Send(&fspb.GetResponse{Size: int64(len(data)), Chunk: data})
+}
+
+func (m *memFileServer) Delete(_ context.Context, req *fspb.DeleteRequest) (*fspb.DeleteResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.fragments, req.GetName())
+
+	return &fspb.DeleteResponse{}, nil
+}
+
+func (m *memFileServer) Exists(_ context.Context, req *fspb.ExistsRequest) (*fspb.ExistsResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resp := new(fspb.ExistsResponse)
+	for _, name := range req.GetNames() {
+		_, ok := m.fragments[name]
+		resp.Exists = append(resp.Exists, ok)
+	}
+
+	return resp, nil
+}
+
+func TestGRPCTransport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	fspb.RegisterFileServerServer(srv, &memFileServer{fragments: make(map[string][]byte)})
+	go srv.Serve(listener)
+	defer srv.Stop()
+
+	k := New(testConfig())
+	defer k.Close()
+
+	ctx := context.Background()
+	uri := "grpc://" + listener.Addr().String()
+	fragment := bytes.Repeat([]byte("fragment"), grpcChunkSize/4)
+
+	assert.NoError(t, k.StoreFragment(ctx, uri, "fragment_0", fragment))
+
+	body, err := k.GetFragment(ctx, uri, "fragment_0")
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.Equal(t, fragment, data)
+		assert.NoError(t, body.Close())
+	}
+
+	exists, err := k.FragmentsExist(ctx, uri, []string{"fragment_0", "fragment_1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, exists)
+
+	assert.NoError(t, k.DeleteFragment(ctx, uri, "fragment_0"))
+
+	_, err = k.GetFragment(ctx, uri, "fragment_0")
+	statusErr := StatusError{}
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.Code)
+}
@@ -0,0 +1,217 @@
+package keeper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/httperr"
+	"github.com/Tsapen/fss/internal/tracing"
+)
+
+// httpTransport talks to file servers with plain HTTP requests.
+type httpTransport struct {
+	httpClient *http.Client
+}
+
+func (t *httpTransport) Get(ctx context.Context, serverURL, name string) (io.ReadCloser, int64, error) {
+	resp, err := t.do(ctx, http.MethodGet, serverURL, name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (t *httpTransport) Store(ctx context.Context, serverURL, name string, fragment []byte) error {
+	resp, err := t.do(ctx, http.MethodPost, serverURL, name, bytes.NewReader(fragment))
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) Delete(ctx context.Context, serverURL, name string) error {
+	resp, err := t.do(ctx, http.MethodDelete, serverURL, name, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) Stat(ctx context.Context, serverURL, name string) (*fss.FragmentInfo, error) {
+	resp, err := t.do(ctx, http.MethodHead, serverURL, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = resp.Body.Close(); err != nil {
+		return nil, fmt.Errorf("close body: %w", err)
+	}
+
+	modifiedAt, err := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, fmt.Errorf("parse modification time: %w", err)
+	}
+
+	return &fss.FragmentInfo{
+		Name:       name,
+		Size:       resp.ContentLength,
+		ModifiedAt: modifiedAt,
+	}, nil
+}
+
+type existsRequest struct {
+	Names []string `json:"names"`
+}
+
+type existsResponse struct {
+	Exists []bool `json:"exists"`
+}
+
+func (t *httpTransport) Exists(ctx context.Context, serverURL string, names []string) (exists []bool, err error) {
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(existsRequest{Names: names}); err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	uri, err := url.JoinPath(serverURL, "exists")
+	if err != nil {
+		return nil, fmt.Errorf("construct url: %w", err)
+	}
+
+	resp, err := t.send(ctx, http.MethodPost, uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(resp.Body.Close(), err)
+	}()
+
+	res := new(existsResponse)
+	if err = json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return res.Exists, nil
+}
+
+func (t *httpTransport) List(ctx context.Context, serverURL, prefix string) (fragments []fss.FragmentInfo, err error) {
+	uri, err := url.JoinPath(serverURL, "list")
+	if err != nil {
+		return nil, fmt.Errorf("construct url: %w", err)
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	q := parsed.Query()
+	q.Set("prefix", prefix)
+	parsed.RawQuery = q.Encode()
+
+	resp, err := t.send(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(resp.Body.Close(), err)
+	}()
+
+	if err = json.NewDecoder(resp.Body).Decode(&fragments); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return fragments, nil
+}
+
+func (t *httpTransport) Stats(ctx context.Context, serverURL string) (stats *fss.ServerStats, err error) {
+	uri, err := url.JoinPath(serverURL, "stats")
+	if err != nil {
+		return nil, fmt.Errorf("construct url: %w", err)
+	}
+
+	resp, err := t.send(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(resp.Body.Close(), err)
+	}()
+
+	stats = new(fss.ServerStats)
+	if err = json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (t *httpTransport) Close() error {
+	t.httpClient.CloseIdleConnections()
+
+	return nil
+}
+
+func (t *httpTransport) do(ctx context.Context, method, serverURL, name string, body io.Reader) (*http.Response, error) {
+	uri, err := withFilename(serverURL, name)
+	if err != nil {
+		return nil, fmt.Errorf("add filename into url: %w", err)
+	}
+
+	return t.send(ctx, method, uri, body)
+}
+
+func (t *httpTransport) send(ctx context.Context, method, uri string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, fmt.Errorf("construct a request: %w", err)
+	}
+
+	tracing.Inject(ctx, req.Header)
+	if reqID := fss.ReqIDFromCtx(ctx); reqID != "" {
+		req.Header.Set(fss.RequestIDHeader, reqID)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		if body, ok := httperr.Read(resp.Body); ok {
+			return nil, fmt.Errorf("%s: %w", body.Message, StatusError{Code: resp.StatusCode})
+		}
+
+		return nil, StatusError{Code: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+func withFilename(uri, filename string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+
+	q := parsed.Query()
+	q.Set("filename", filename)
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String(), nil
+}
@@ -1,85 +1,537 @@
 package keeper
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/metrics"
+	"github.com/Tsapen/fss/internal/tracing"
+)
+
+const (
+	defaultMaxAttempts   = 3
+	defaultBaseBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff    = 2 * time.Second
+	defaultJitter        = 0.5
+	defaultBaseTimeout   = 2 * time.Second
+	defaultMinThroughput = 1 << 20
+	defaultMaxTimeout    = time.Minute
 )
 
+var defaultRetryableStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Config contains retry, timeout, hedging, breaker and transport settings.
+type Config struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Jitter is the share of the backoff which is randomly cut, nil means the default.
+	Jitter            *float64
+	RetryableStatuses []int
+
+	BaseTimeout   time.Duration
+	MinThroughput int64
+	MaxTimeout    time.Duration
+
+	HedgeDelay time.Duration
+
+	BreakerFailures       int
+	BreakerOpenTimeout    time.Duration
+	BreakerHalfOpenProbes int
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	// H2C speaks cleartext HTTP/2 to http:// servers, https:// servers keep TLS.
+	H2C         bool
+	UnixSockets map[string]string
+}
+
+// StatusError is returned when a file server responds with unexpected status.
+type StatusError struct {
+	Code int
+}
+
+func (err StatusError) Error() string {
+	return fmt.Sprintf("got '%d' response http status", err.Code)
+}
+
+var _ fss.FragmentStore = (*Keeper)(nil)
+
+// Keeper is the FragmentStore that keeps fragments on remote file servers.
 type Keeper struct {
-	httpClient *http.Client
+	cfg        Config
+	retryable  map[int]struct{}
+	transports map[string]Transport
+
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker
 }
 
-func New() *Keeper {
+func New(cfg Config) *Keeper {
+	cfg = cfg.withDefaults()
+
+	retryable := make(map[int]struct{}, len(cfg.RetryableStatuses))
+	for _, code := range cfg.RetryableStatuses {
+		retryable[code] = struct{}{}
+	}
+
+	httpTransport := &httpTransport{httpClient: newHTTPClient(cfg)}
+
 	return &Keeper{
-		httpClient: &http.Client{},
+		cfg:       cfg,
+		retryable: retryable,
+		transports: map[string]Transport{
+			"http":  httpTransport,
+			"https": httpTransport,
+			"grpc":  newGRPCTransport(cfg),
+		},
+		breakers: make(map[string]*breaker),
 	}
 }
 
-func (k *Keeper) GetFragment(ctx context.Context, uri, fragmentName string) (res io.ReadCloser, err error) {
-	uri, err = k.withFilename(uri, fragmentName)
-	if err != nil {
-		return nil, fmt.Errorf("add filename into url: %w", err)
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
-	if err != nil {
-		return nil, fmt.Errorf("construct a request: %w", err)
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = defaultBaseBackoff
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+
+	if c.Jitter == nil || *c.Jitter < 0 || *c.Jitter > 1 {
+		jitter := defaultJitter
+		c.Jitter = &jitter
+	}
+
+	if len(c.RetryableStatuses) == 0 {
+		c.RetryableStatuses = defaultRetryableStatuses
+	}
+
+	if c.BaseTimeout <= 0 {
+		c.BaseTimeout = defaultBaseTimeout
+	}
+
+	if c.MinThroughput <= 0 {
+		c.MinThroughput = defaultMinThroughput
+	}
+
+	if c.MaxTimeout <= 0 {
+		c.MaxTimeout = defaultMaxTimeout
+	}
+
+	if c.BreakerFailures <= 0 {
+		c.BreakerFailures = defaultBreakerFailures
+	}
+
+	if c.BreakerOpenTimeout <= 0 {
+		c.BreakerOpenTimeout = defaultBreakerOpenTimeout
 	}
 
-	resp, err := k.httpClient.Do(req)
+	if c.BreakerHalfOpenProbes <= 0 {
+		c.BreakerHalfOpenProbes = defaultBreakerHalfOpenProbes
+	}
+
+	if c.MaxIdleConns <= 0 {
+		c.MaxIdleConns = defaultMaxIdleConns
+	}
+
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = defaultIdleConnTimeout
+	}
+
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = defaultDialTimeout
+	}
+
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = defaultKeepAlive
+	}
+
+	return c
+}
+
+// GetFragment gets fragment from the file server. If replicas are passed and the
+// primary server does not respond within the hedge delay, the same request is sent
+// to the next replica and the first successful response wins.
+func (k *Keeper) GetFragment(ctx context.Context, uri, fragmentName string, replicas ...string) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "fragment.get", fragmentAttrs(uri, fragmentName)...)
+	defer func(start time.Time) {
+		metrics.ObserveFragment(uri, "get", start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	uris := append([]string{uri}, replicas...)
+	if len(uris) == 1 || k.cfg.HedgeDelay <= 0 {
+		return k.getWithRetry(ctx, uri, fragmentName)
+	}
+
+	return k.hedgedGet(ctx, uris, fragmentName)
+}
+
+func (k *Keeper) getWithRetry(ctx context.Context, serverURL, fragmentName string) (res io.ReadCloser, err error) {
+	t, err := k.transport(serverURL)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("got '%d' response http status", resp.StatusCode)
+	err = k.withRetry(ctx, serverURL, func(ctx context.Context) error {
+		res, err = k.get(ctx, t, serverURL, fragmentName)
+
+		return err
+	})
+
+	return res, err
+}
+
+type hedgeResult struct {
+	idx  int
+	body io.ReadCloser
+	err  error
+}
+
+func (k *Keeper) hedgedGet(ctx context.Context, uris []string, fragmentName string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	resultCh := make(chan hedgeResult, len(uris))
+	cancels := make([]context.CancelFunc, 0, len(uris))
+	launch := func(uri string) {
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		idx := len(cancels)
+		cancels = append(cancels, attemptCancel)
+
+		go func() {
+			body, err := k.getWithRetry(attemptCtx, uri, fragmentName)
+			if err != nil {
+				err = fmt.Errorf("get from '%s': %w", uri, err)
+			}
+
+			resultCh <- hedgeResult{idx: idx, body: body, err: err}
+		}()
+	}
+
+	launch(uris[0])
+	launched, received := 1, 0
+
+	timer := time.NewTimer(k.cfg.HedgeDelay)
+	defer timer.Stop()
+
+	var errs error
+	for received < launched {
+		select {
+		case <-timer.C:
+			if launched < len(uris) {
+				launch(uris[launched])
+				launched++
+				timer.Reset(k.cfg.HedgeDelay)
+			}
+
+			continue
+
+		case res := <-resultCh:
+			received++
+			if res.err != nil {
+				errs = errors.Join(errs, res.err)
+				if launched < len(uris) {
+					launch(uris[launched])
+					launched++
+				}
+
+				continue
+			}
+
+			for i, attemptCancel := range cancels {
+				if i != res.idx {
+					attemptCancel()
+				}
+			}
+
+			go k.drainHedges(resultCh, launched-received)
+
+			return cancelOnClose{ReadCloser: res.body, stop: cancel}, nil
+		}
 	}
 
-	return resp.Body, nil
+	cancel()
+
+	return nil, errs
 }
 
-func (k *Keeper) StoreFragment(ctx context.Context, uri, fragmentName string, fragment []byte) (err error) {
-	uri, err = k.withFilename(uri, fragmentName)
+// drainHedges closes responses of the requests that lost the race.
+func (*Keeper) drainHedges(resultCh <-chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if res := <-resultCh; res.err == nil {
+			res.body.Close()
+		}
+	}
+}
+
+// get gets fragment with the timeout that is extended by the fragment size once it is known.
+func (k *Keeper) get(ctx context.Context, t Transport, serverURL, fragmentName string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(k.cfg.BaseTimeout, cancel)
+	stop := func() {
+		timer.Stop()
+		cancel()
+	}
+
+	body, size, err := t.Get(ctx, serverURL, fragmentName)
 	if err != nil {
-		return fmt.Errorf("add filename into url: %w", err)
+		stop()
+		return nil, err
+	}
+
+	timer.Reset(k.timeout(size))
+
+	return cancelOnClose{ReadCloser: body, stop: stop}, nil
+}
+
+func (k *Keeper) StoreFragment(ctx context.Context, serverURL, fragmentName string, fragment []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "fragment.store", fragmentAttrs(serverURL, fragmentName)...)
+	defer func(start time.Time) {
+		metrics.ObserveFragment(serverURL, "store", start, err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	return k.do(ctx, serverURL, int64(len(fragment)), func(ctx context.Context, t Transport) error {
+		return t.Store(ctx, serverURL, fragmentName, fragment)
+	})
+}
+
+func fragmentAttrs(serverURL, fragmentName string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("fss.server", serverURL),
+		attribute.String("fss.fragment", fragmentName),
+	}
+}
+
+// DeleteFragment removes fragment from the file server.
+func (k *Keeper) DeleteFragment(ctx context.Context, serverURL, fragmentName string) error {
+	return k.do(ctx, serverURL, 0, func(ctx context.Context, t Transport) error {
+		return t.Delete(ctx, serverURL, fragmentName)
+	})
+}
+
+// StatFragment returns fragment info from the file server.
+func (k *Keeper) StatFragment(ctx context.Context, serverURL, fragmentName string) (info *fss.FragmentInfo, err error) {
+	err = k.do(ctx, serverURL, 0, func(ctx context.Context, t Transport) error {
+		info, err = t.Stat(ctx, serverURL, fragmentName)
+
+		return err
+	})
+
+	return info, err
+}
+
+// FragmentsExist reports presence of every fragment on the file server in one request.
+func (k *Keeper) FragmentsExist(ctx context.Context, serverURL string, fragmentNames []string) (exists []bool, err error) {
+	err = k.do(ctx, serverURL, 0, func(ctx context.Context, t Transport) error {
+		exists, err = t.Exists(ctx, serverURL, fragmentNames)
+
+		return err
+	})
+
+	return exists, err
+}
+
+// ListFragments returns info of the fragments stored on the file server which names start with prefix.
+func (k *Keeper) ListFragments(ctx context.Context, serverURL, prefix string) (fragments []fss.FragmentInfo, err error) {
+	err = k.do(ctx, serverURL, 0, func(ctx context.Context, t Transport) error {
+		fragments, err = t.List(ctx, serverURL, prefix)
+
+		return err
+	})
+
+	return fragments, err
+}
+
+// ServerStats returns capacity and usage of the file server storage.
+func (k *Keeper) ServerStats(ctx context.Context, serverURL string) (stats *fss.ServerStats, err error) {
+	err = k.do(ctx, serverURL, 0, func(ctx context.Context, t Transport) error {
+		stats, err = t.Stats(ctx, serverURL)
+
+		return err
+	})
+
+	return stats, err
+}
+
+// Close closes connections to file servers.
+func (k *Keeper) Close() error {
+	var errs error
+	for scheme, t := range k.transports {
+		if scheme != "https" {
+			errs = errors.Join(errs, t.Close())
+		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(fragment))
+	return errs
+}
+
+// do runs op with retries and the timeout scaled by size.
+func (k *Keeper) do(ctx context.Context, serverURL string, size int64, op func(context.Context, Transport) error) error {
+	t, err := k.transport(serverURL)
 	if err != nil {
-		return fmt.Errorf("construct a request: %w", err)
+		return err
 	}
 
-	resp, err := k.httpClient.Do(req)
+	return k.withRetry(ctx, serverURL, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, k.timeout(size))
+		defer cancel()
+
+		return op(ctx, t)
+	})
+}
+
+func (k *Keeper) transport(serverURL string) (Transport, error) {
+	parsed, err := url.Parse(serverURL)
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		return nil, fmt.Errorf("parse url: %w", err)
 	}
 
-	defer func() {
-		err = fss.HandleErrPair(resp.Body.Close(), err)
-	}()
+	t, ok := k.transports[parsed.Scheme]
+	if !ok {
+		return nil, fss.NewValidationError("unsupported file server scheme '%s'", parsed.Scheme)
+	}
+
+	return t, nil
+}
+
+// withRetry runs op until it succeeds, fails with a non-retryable error or runs out of attempts.
+// Every attempt goes through the circuit breaker of the server.
+func (k *Keeper) withRetry(ctx context.Context, serverURL string, op func(context.Context) error) error {
+	b := k.breaker(serverURL)
+
+	var err error
+	for attempt := 0; attempt < k.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleep(ctx, k.backoff(attempt)); sleepErr != nil {
+				return fss.HandleErrPair(sleepErr, err)
+			}
+		}
+
+		if !b.allow(time.Now()) {
+			return fss.HandleErrPair(fss.NewUnavailableError("circuit breaker of server '%s' is open", serverURL), err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("got '%d' response http status", resp.StatusCode)
+		err = op(ctx)
+		retryable := err != nil && k.isRetryable(ctx, err)
+		if ctx.Err() != nil {
+			b.release()
+		} else {
+			b.record(!failed(err, retryable), time.Now())
+		}
+
+		if err == nil || !retryable {
+			return err
+		}
 	}
 
-	return nil
+	return fmt.Errorf("give up after %d attempts: %w", k.cfg.MaxAttempts, err)
 }
 
-func (*Keeper) withFilename(uri, filename string) (string, error) {
-	parsed, err := url.Parse(uri)
-	if err != nil {
-		return "", fmt.Errorf("parse url: %w", err)
+func (k *Keeper) isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.As(err, &fss.UnavailableError{}) {
+		return false
+	}
+
+	statusErr := StatusError{}
+	if errors.As(err, &statusErr) {
+		_, ok := k.retryable[statusErr.Code]
+
+		return ok
+	}
+
+	return true
+}
+
+// failed tells whether the error of a request counts against the breaker: transport errors
+// and retryable 5xx do, other answers such as 404 of a missing fragment are handled requests.
+func failed(err error, retryable bool) bool {
+	if err == nil {
+		return false
+	}
+
+	statusErr := StatusError{}
+	if !errors.As(err, &statusErr) {
+		return true
 	}
 
-	q := parsed.Query()
-	q.Set("filename", filename)
-	parsed.RawQuery = q.Encode()
+	return retryable && statusErr.Code >= http.StatusInternalServerError
+}
+
+// backoff returns exponential delay with jitter for the given attempt.
+func (k *Keeper) backoff(attempt int) time.Duration {
+	delay := k.cfg.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > k.cfg.MaxBackoff {
+		delay = k.cfg.MaxBackoff
+	}
+
+	return delay - time.Duration(*k.cfg.Jitter*rand.Float64()*float64(delay))
+}
+
+// timeout returns request timeout scaled by the size of the fragment.
+func (k *Keeper) timeout(size int64) time.Duration {
+	timeout := k.cfg.BaseTimeout
+	if size > 0 {
+		timeout += time.Duration(float64(size) / float64(k.cfg.MinThroughput) * float64(time.Second))
+	}
+
+	if timeout > k.cfg.MaxTimeout {
+		timeout = k.cfg.MaxTimeout
+	}
+
+	return timeout
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-timer.C:
+		return nil
+	}
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	stop func()
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.stop()
 
-	return parsed.String(), nil
+	return c.ReadCloser.Close()
 }
@@ -0,0 +1,103 @@
+package keeper
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const benchFragmentSize = 64 << 10
+
+// BenchmarkStoreFragment compares fragment upload throughput of the default
+// http client with the tuned transports. Run with:
+//
+//	go test -run=^$ -bench=StoreFragment -cpu=16 ./internal/keeper/
+func BenchmarkStoreFragment(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+
+	benchmarks := []struct {
+		name  string
+		setup func(b *testing.B) (*Keeper, string)
+	}{
+		{
+			name: "default transport",
+			setup: func(b *testing.B) (*Keeper, string) {
+				srv := startBenchServer(b, handler)
+				k := New(Config{})
+				k.transports["http"] = &httpTransport{httpClient: &http.Client{}}
+
+				return k, srv.URL
+			},
+		},
+		{
+			name: "pooled transport",
+			setup: func(b *testing.B) (*Keeper, string) {
+				srv := startBenchServer(b, handler)
+
+				return New(Config{}), srv.URL
+			},
+		},
+		{
+			name: "h2c",
+			setup: func(b *testing.B) (*Keeper, string) {
+				srv := startBenchServer(b, h2c.NewHandler(handler, &http2.Server{}))
+
+				return New(Config{H2C: true}), srv.URL
+			},
+		},
+		{
+			name: "unix socket",
+			setup: func(b *testing.B) (*Keeper, string) {
+				socket := filepath.Join(b.TempDir(), "fs.sock")
+				listener, err := net.Listen("unix", socket)
+				if err != nil {
+					b.Fatalf("listen unix socket: %v", err)
+				}
+
+				srv := httptest.NewUnstartedServer(handler)
+				srv.Listener = listener
+				srv.Start()
+				b.Cleanup(srv.Close)
+
+				const host = "file-server:43000"
+
+				return New(Config{UnixSockets: map[string]string{host: socket}}), (&url.URL{Scheme: "http", Host: host}).String()
+			},
+		},
+	}
+
+	fragment := make([]byte, benchFragmentSize)
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			k, uri := bm.setup(b)
+			defer k.Close()
+
+			b.SetBytes(benchFragmentSize)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := k.StoreFragment(context.Background(), uri, "fragment", fragment); err != nil {
+						b.Errorf("store fragment: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func startBenchServer(b *testing.B, handler http.Handler) *httptest.Server {
+	srv := httptest.NewServer(handler)
+	b.Cleanup(srv.Close)
+
+	return srv
+}
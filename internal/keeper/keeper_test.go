@@ -0,0 +1,190 @@
+package keeper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+func testConfig() Config {
+	return Config{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		BaseTimeout: time.Second,
+	}
+}
+
+func TestStoreFragmentRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "transient failure", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantCalls: 2},
+		{name: "non-retryable status", statuses: []int{http.StatusNotFound}, wantCalls: 1, wantErr: true},
+		{name: "out of attempts", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, wantCalls: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.statuses[call-1])
+			}))
+			defer srv.Close()
+
+			err := New(testConfig()).StoreFragment(context.Background(), srv.URL, "fragment", []byte("data"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestGetFragmentHedged(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	cfg := testConfig()
+	cfg.HedgeDelay = 10 * time.Millisecond
+
+	body, err := New(cfg).GetFragment(context.Background(), slow.URL, "fragment", fast.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", string(data))
+}
+
+func TestJitterDefault(t *testing.T) {
+	noJitter, tooLarge := 0.0, 2.0
+
+	assert.Equal(t, defaultJitter, *Config{}.withDefaults().Jitter)
+	assert.Equal(t, defaultJitter, *Config{Jitter: &tooLarge}.withDefaults().Jitter)
+	assert.Equal(t, noJitter, *Config{Jitter: &noJitter}.withDefaults().Jitter)
+}
+
+func TestStatusErrorIsTyped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := New(testConfig()).GetFragment(context.Background(), srv.URL, "fragment")
+	assert.True(t, errors.As(err, &StatusError{}))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxAttempts = 1
+	cfg.BreakerFailures = 2
+	cfg.BreakerOpenTimeout = 50 * time.Millisecond
+	k := New(cfg)
+	ctx := context.Background()
+
+	for i := 0; i < cfg.BreakerFailures; i++ {
+		assert.Error(t, k.StoreFragment(ctx, srv.URL, "fragment", nil))
+	}
+
+	assert.Equal(t, BreakerOpen, k.BreakerStates()[srv.URL])
+	assert.False(t, k.Available(srv.URL))
+	assert.True(t, errors.As(k.StoreFragment(ctx, srv.URL, "fragment", nil), &fss.UnavailableError{}))
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(cfg.BreakerOpenTimeout)
+
+	assert.True(t, k.Available(srv.URL))
+	assert.NoError(t, k.StoreFragment(ctx, srv.URL, "fragment", nil))
+	assert.Equal(t, BreakerClosed, k.BreakerStates()[srv.URL])
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.BreakerFailures = 2
+	k := New(cfg)
+
+	// Scrub and GC get 404 for every missing fragment of a healthy server.
+	for i := 0; i < 2*cfg.BreakerFailures; i++ {
+		_, err := k.StatFragment(context.Background(), srv.URL, "fragment")
+		assert.True(t, errors.As(err, &StatusError{}))
+	}
+
+	assert.Equal(t, BreakerClosed, k.BreakerStates()[srv.URL])
+	assert.True(t, k.Available(srv.URL))
+}
+
+func TestH2CKeepsTLS(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	plain := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	cfg := testConfig()
+	cfg.H2C = true
+	client := newHTTPClient(cfg.withDefaults())
+	client.Transport.(*http.Transport).TLSClientConfig = secure.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+
+	for _, tt := range []struct {
+		url   string
+		proto string
+	}{
+		{url: plain.URL, proto: "HTTP/2.0"},
+		{url: secure.URL, proto: "HTTP/1.1"},
+	} {
+		resp, err := client.Get(tt.url)
+		if !assert.NoError(t, err, tt.url) {
+			continue
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.proto, string(data), tt.url)
+	}
+}
@@ -0,0 +1,78 @@
+package keeper
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+const (
+	defaultMaxIdleConns        = 256
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+)
+
+// Transport sends fragment requests to file servers over one protocol.
+// Keeper picks a transport for every server by the scheme of its url.
+type Transport interface {
+	Get(ctx context.Context, serverURL, name string) (io.ReadCloser, int64, error)
+	Store(ctx context.Context, serverURL, name string, fragment []byte) error
+	Delete(ctx context.Context, serverURL, name string) error
+	Stat(ctx context.Context, serverURL, name string) (*fss.FragmentInfo, error)
+	Exists(ctx context.Context, serverURL string, names []string) ([]bool, error)
+	List(ctx context.Context, serverURL, prefix string) ([]fss.FragmentInfo, error)
+	Stats(ctx context.Context, serverURL string) (*fss.ServerStats, error)
+	Close() error
+}
+
+// newHTTPClient constructs http client with connection pool tuned for many
+// concurrent fragment requests to a small number of file servers.
+func newHTTPClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket, ok := cfg.UnixSockets[addr]; ok {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dial,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		TLSHandshakeTimeout: cfg.DialTimeout,
+	}
+
+	// h2c is plaintext, so only http:// servers get it, https:// servers keep TLS.
+	if cfg.H2C {
+		transport.RegisterProtocol("http", &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+			ReadIdleTimeout: cfg.KeepAlive,
+		})
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
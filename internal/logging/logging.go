@@ -0,0 +1,128 @@
+// Package logging configures the global logger and writes access logs of HTTP APIs.
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Log formats.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// maxRequestIDLen limits request ids accepted from clients.
+const maxRequestIDLen = 128
+
+// Config contains settings of the global logger.
+type Config struct {
+	// Level is a zerolog level name, info by default.
+	Level string
+	// Format is json (default) or console.
+	Format string
+}
+
+// Setup configures the global logger.
+func Setup(cfg Config) error {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = zerolog.ParseLevel(cfg.Level); err != nil {
+			return fmt.Errorf("parse log level: %w", err)
+		}
+	}
+
+	zerolog.SetGlobalLevel(level)
+
+	switch cfg.Format {
+	case "", FormatJSON:
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	case FormatConsole:
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+
+	default:
+		return fmt.Errorf("unknown log format '%s'", cfg.Format)
+	}
+
+	return nil
+}
+
+// Middleware takes the request id from the request header or generates a new one,
+// echoes it in the response, adds the request logger into the context and writes
+// an access log line when the request is served.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		reqID := r.Header.Get(fss.RequestIDHeader)
+		if !validRequestID(reqID) {
+			reqID = uuid.NewString()
+		}
+
+		w.Header().Set(fss.RequestIDHeader, reqID)
+
+		logger := log.With().Str("request_id", reqID).Logger()
+		ctx := fss.WithLogger(fss.WithReqID(r.Context(), reqID), logger)
+
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r.WithContext(ctx))
+
+		logger.Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", aw.status).
+			Int64("bytes", aw.bytes).
+			Dur("duration", time.Since(start)).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("access")
+	})
+}
+
+// validRequestID accepts short ids of visible ASCII characters, so clients can't
+// break log lines with the header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accessWriter remembers the status and size of the response.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,93 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/logging"
+)
+
+func TestMiddleware(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger := log.Logger
+	log.Logger = zerolog.New(out)
+	t.Cleanup(func() { log.Logger = logger })
+
+	handler := logging.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := fss.LoggerFromCtx(r.Context())
+		logger.Info().Msg("handled")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(fss.ReqIDFromCtx(r.Context())))
+	}))
+
+	tests := []struct {
+		name   string
+		reqID  string
+		keepID bool
+	}{
+		{name: "client id", reqID: "client-id", keepID: true},
+		{name: "missing id"},
+		{name: "invalid id", reqID: "bad id\n"},
+		{name: "long id", reqID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+
+			req := httptest.NewRequest(http.MethodPost, "/file?filename=a", nil)
+			req.Header.Set(fss.RequestIDHeader, tt.reqID)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			reqID := w.Header().Get(fss.RequestIDHeader)
+			assert.Equal(t, reqID, w.Body.String())
+			if tt.keepID {
+				assert.Equal(t, tt.reqID, reqID)
+			} else {
+				assert.NotEqual(t, tt.reqID, reqID)
+				assert.NotEmpty(t, reqID)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			require.Len(t, lines, 2)
+
+			var access map[string]any
+			require.NoError(t, json.Unmarshal([]byte(lines[1]), &access))
+			assert.Equal(t, reqID, access["request_id"])
+			assert.Equal(t, http.MethodPost, access["method"])
+			assert.Equal(t, "/file", access["path"])
+			assert.EqualValues(t, http.StatusCreated, access["status"])
+			assert.EqualValues(t, len(reqID), access["bytes"])
+			assert.Equal(t, req.RemoteAddr, access["remote_addr"])
+			assert.Contains(t, access, "duration")
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	logger, level := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+	})
+
+	require.NoError(t, logging.Setup(logging.Config{Level: "debug", Format: logging.FormatConsole}))
+	assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+
+	require.NoError(t, logging.Setup(logging.Config{}))
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+
+	assert.Error(t, logging.Setup(logging.Config{Level: "loud"}))
+	assert.Error(t, logging.Setup(logging.Config{Format: "xml"}))
+}
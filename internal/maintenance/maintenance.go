@@ -0,0 +1,302 @@
+// Package maintenance checks and moves fragments of committed files on operator request.
+package maintenance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Tsapen/fss/internal/coordination"
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/jobs"
+	"github.com/Tsapen/fss/internal/keeper"
+)
+
+// Fragment statuses.
+const (
+	StatusOK           = "ok"
+	StatusMissing      = "missing"
+	StatusSizeMismatch = "size_mismatch"
+	StatusUnavailable  = "unavailable"
+	StatusDisabled     = "disabled"
+	StatusError        = "error"
+)
+
+const (
+	// filesPage is the number of files processed between listings.
+	filesPage = 100
+	// moveLeaseTTL bounds the time a file keeps its lease if rebalancing crashes.
+	moveLeaseTTL = time.Minute
+)
+
+// Service scrubs and rebalances fragments.
+type Service struct {
+	dm        *dm.Service
+	storage   dm.Storage
+	fragments fss.FragmentStore
+	holder    string
+}
+
+// New creates service.
+func New(dmService *dm.Service, storage dm.Storage, fragments fss.FragmentStore) *Service {
+	return &Service{
+		dm:        dmService,
+		storage:   storage,
+		fragments: fragments,
+		holder:    coordination.NewHolder(),
+	}
+}
+
+// CheckFragment reports whether the fragment is stored on its server with the recorded size.
+func CheckFragment(ctx context.Context, fragments fss.FragmentStore, f fss.Fragment) (string, error) {
+	if f.ServerMode == fss.ServerModeDisabled {
+		return StatusDisabled, nil
+	}
+
+	if !fragments.Available(f.ServerURL) {
+		return StatusUnavailable, nil
+	}
+
+	info, err := fragments.StatFragment(ctx, f.ServerURL, f.Name())
+	switch {
+	case isNotFound(err):
+		return StatusMissing, nil
+
+	case err != nil:
+		return StatusError, err
+
+	case f.Size != nil && *f.Size != info.Size:
+		return StatusSizeMismatch, nil
+
+	default:
+		return StatusOK, nil
+	}
+}
+
+// Scrub checks every fragment of committed files.
+func (s *Service) Scrub(ctx context.Context, p *jobs.Progress) error {
+	return s.eachFile(ctx, func(f fss.File) error {
+		fragments, err := s.dm.Fragments(ctx, f.Name)
+		if err != nil {
+			p.AddTotal(1)
+			p.Fail("file '%s': %v", f.Name, err)
+
+			return nil
+		}
+
+		p.AddTotal(int64(len(fragments)))
+		for _, fragment := range fragments {
+			status, err := CheckFragment(ctx, s.fragments, fragment)
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+
+			case err != nil:
+				p.Fail("fragment %d of '%s' on '%s': %v", fragment.Index, f.Name, fragment.ServerURL, err)
+
+			case status != StatusOK:
+				p.Fail("fragment %d of '%s' on '%s': %s", fragment.Index, f.Name, fragment.ServerURL, status)
+
+			default:
+				p.Advance()
+			}
+		}
+
+		return nil
+	})
+}
+
+// Rebalance moves fragments off read-only servers onto active servers chosen
+// by the placement of the file, so read-only servers can be removed.
+func (s *Service) Rebalance(ctx context.Context, p *jobs.Progress) error {
+	return s.eachFile(ctx, func(f fss.File) error {
+		return s.rebalanceFile(ctx, p, f)
+	})
+}
+
+func (s *Service) rebalanceFile(ctx context.Context, p *jobs.Progress, f fss.File) (err error) {
+	fragments, err := s.dm.Fragments(ctx, f.Name)
+	if err != nil {
+		p.AddTotal(1)
+		p.Fail("file '%s': %v", f.Name, err)
+
+		return nil
+	}
+
+	var moving int64
+	for _, fragment := range fragments {
+		if !active(fragment.ServerMode) {
+			moving++
+		}
+	}
+
+	if moving == 0 {
+		return nil
+	}
+
+	p.AddTotal(moving)
+
+	// The lease keeps the file from being replaced or deleted while fragments move.
+	lease := coordination.NewLease(s.storage, coordination.UploadLease(f.Name), s.holder, moveLeaseTTL)
+	if err := lease.Acquire(ctx); err != nil {
+		for i := int64(0); i < moving; i++ {
+			p.Fail("file '%s': %v", f.Name, err)
+		}
+
+		return nil
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(lease.Release(ctx), err)
+	}()
+
+	targets, err := s.targets(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	var moved []fss.Fragment
+	for i, fragment := range fragments {
+		if active(fragment.ServerMode) {
+			continue
+		}
+
+		target := targets[fragment.Index%len(targets)]
+		if err := s.copyFragment(ctx, fragment, target); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			p.Fail("fragment %d of '%s' on '%s': %v", fragment.Index, f.Name, fragment.ServerURL, err)
+
+			continue
+		}
+
+		moved = append(moved, fragment)
+		fragments[i].ServerID, fragments[i].ServerURL, fragments[i].ServerMode = target.ID, target.URL, target.Mode
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	// Every fragment is recorded, files of the legacy placement get records of the whole placement.
+	if err := s.storage.CreateFragments(ctx, fragments); err != nil {
+		for range moved {
+			p.Fail("fragments of '%s': record placement: %v", f.Name, err)
+		}
+
+		return nil
+	}
+
+	for _, fragment := range moved {
+		// Copies left on the old server are orphans and removed by the garbage collector.
+		_ = s.fragments.DeleteFragment(ctx, fragment.ServerURL, fragment.Name())
+		p.Advance()
+	}
+
+	return nil
+}
+
+// targets returns active servers in the placement order of the file.
+func (s *Service) targets(ctx context.Context, f fss.File) ([]fss.Server, error) {
+	placement, err := dm.Strategy(f.Placement)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := s.storage.Servers(ctx, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("get servers: %w", err)
+	}
+
+	targets := make([]fss.Server, 0, len(servers))
+	for _, server := range servers {
+		if active(server.Mode) && s.fragments.Available(server.URL) {
+			targets = append(targets, server)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fss.NewUnavailableError("no active servers")
+	}
+
+	return placement.Place(f.Name, targets), nil
+}
+
+func (s *Service) copyFragment(ctx context.Context, fragment fss.Fragment, target fss.Server) (err error) {
+	if fragment.ServerMode == fss.ServerModeDisabled {
+		return fmt.Errorf("server is disabled")
+	}
+
+	name := fragment.Name()
+	body, err := s.fragments.GetFragment(ctx, fragment.ServerURL, name)
+	if err != nil {
+		return fmt.Errorf("get fragment: %w", err)
+	}
+
+	defer func() {
+		err = fss.HandleErrPair(body.Close(), err)
+	}()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("read fragment: %w", err)
+	}
+
+	if fragment.Checksum != nil {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != *fragment.Checksum {
+			return fmt.Errorf("checksum mismatch")
+		}
+	}
+
+	if err := s.fragments.StoreFragment(ctx, target.URL, name, data); err != nil {
+		return fmt.Errorf("store fragment on '%s': %w", target.URL, err)
+	}
+
+	return nil
+}
+
+// eachFile calls fn for every committed file.
+func (s *Service) eachFile(ctx context.Context, fn func(f fss.File) error) error {
+	var after string
+	for {
+		files, err := s.dm.Files(ctx, "", after, filesPage)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.Fragments == nil {
+				continue
+			}
+
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+
+		if len(files) < filesPage {
+			return nil
+		}
+
+		after = files[len(files)-1].Name
+	}
+}
+
+func active(mode string) bool {
+	return mode == fss.ServerModeActive || mode == ""
+}
+
+func isNotFound(err error) bool {
+	var statusErr keeper.StatusError
+	return errors.As(err, &fss.NotFoundError{}) || errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,208 @@
+// Package memstore provides in-process implementations of the FSS storages.
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+var _ fss.FragmentStore = (*FragmentStore)(nil)
+
+type fragment struct {
+	data       []byte
+	modifiedAt time.Time
+}
+
+// FragmentStore keeps fragments of every file server in memory.
+type FragmentStore struct {
+	mu          sync.RWMutex
+	servers     map[string]map[string]fragment
+	unavailable map[string]bool
+	capacity    map[string]int64
+}
+
+// NewFragmentStore creates empty in-memory fragment store.
+func NewFragmentStore() *FragmentStore {
+	return &FragmentStore{
+		servers:     make(map[string]map[string]fragment),
+		unavailable: make(map[string]bool),
+		capacity:    make(map[string]int64),
+	}
+}
+
+// SetCapacity sets the capacity reported by the server stats.
+func (s *FragmentStore) SetCapacity(serverURL string, capacity int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.capacity[serverURL] = capacity
+}
+
+// SetUnavailable makes every request to the server fail.
+func (s *FragmentStore) SetUnavailable(serverURL string, unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unavailable[serverURL] = unavailable
+}
+
+// GetFragment gets fragment from the first server that has it.
+func (s *FragmentStore) GetFragment(ctx context.Context, serverURL, name string, replicas ...string) (io.ReadCloser, error) {
+	var err error
+	for _, uri := range append([]string{serverURL}, replicas...) {
+		var f fragment
+		if f, err = s.fragment(ctx, uri, name); err == nil {
+			return io.NopCloser(bytes.NewReader(f.data)), nil
+		}
+	}
+
+	return nil, err
+}
+
+// StoreFragment stores fragment.
+func (s *FragmentStore) StoreFragment(ctx context.Context, serverURL, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(ctx, serverURL); err != nil {
+		return err
+	}
+
+	fragments, ok := s.servers[serverURL]
+	if !ok {
+		fragments = make(map[string]fragment)
+		s.servers[serverURL] = fragments
+	}
+
+	fragments[name] = fragment{
+		data:       bytes.Clone(data),
+		modifiedAt: time.Now(),
+	}
+
+	return nil
+}
+
+// DeleteFragment removes fragment.
+func (s *FragmentStore) DeleteFragment(ctx context.Context, serverURL, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(ctx, serverURL); err != nil {
+		return err
+	}
+
+	if _, ok := s.servers[serverURL][name]; !ok {
+		return fss.NewNotFoundError("fragment '%s' not found", name)
+	}
+
+	delete(s.servers[serverURL], name)
+
+	return nil
+}
+
+// StatFragment returns fragment info.
+func (s *FragmentStore) StatFragment(ctx context.Context, serverURL, name string) (*fss.FragmentInfo, error) {
+	f, err := s.fragment(ctx, serverURL, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fss.FragmentInfo{
+		Name:       name,
+		Size:       int64(len(f.data)),
+		ModifiedAt: f.modifiedAt,
+	}, nil
+}
+
+// ListFragments returns info of the fragments which names start with prefix ordered by name.
+func (s *FragmentStore) ListFragments(ctx context.Context, serverURL, prefix string) ([]fss.FragmentInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.check(ctx, serverURL); err != nil {
+		return nil, err
+	}
+
+	var fragments []fss.FragmentInfo
+	for name, f := range s.servers[serverURL] {
+		if strings.HasPrefix(name, prefix) {
+			fragments = append(fragments, fss.FragmentInfo{
+				Name:       name,
+				Size:       int64(len(f.data)),
+				ModifiedAt: f.modifiedAt,
+			})
+		}
+	}
+
+	sort.Slice(fragments, func(i, j int) bool {
+		return fragments[i].Name < fragments[j].Name
+	})
+
+	return fragments, nil
+}
+
+// ServerStats returns usage of the server, free space is 0 if the capacity is not set.
+func (s *FragmentStore) ServerStats(ctx context.Context, serverURL string) (*fss.ServerStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.check(ctx, serverURL); err != nil {
+		return nil, err
+	}
+
+	stats := &fss.ServerStats{
+		Capacity:  s.capacity[serverURL],
+		Fragments: int64(len(s.servers[serverURL])),
+	}
+
+	for _, f := range s.servers[serverURL] {
+		stats.Used += int64(len(f.data))
+	}
+
+	stats.Free = max(stats.Capacity-stats.Used, 0)
+
+	return stats, nil
+}
+
+// Available reports whether the server was not made unavailable.
+func (s *FragmentStore) Available(serverURL string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.unavailable[serverURL]
+}
+
+func (s *FragmentStore) fragment(ctx context.Context, serverURL, name string) (fragment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.check(ctx, serverURL); err != nil {
+		return fragment{}, err
+	}
+
+	f, ok := s.servers[serverURL][name]
+	if !ok {
+		return fragment{}, fss.NewNotFoundError("fragment '%s' not found", name)
+	}
+
+	return f, nil
+}
+
+func (s *FragmentStore) check(ctx context.Context, serverURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.unavailable[serverURL] {
+		return fss.NewUnavailableError("file server '%s' is unavailable", serverURL)
+	}
+
+	return nil
+}
@@ -0,0 +1,489 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+var _ dm.Storage = (*Storage)(nil)
+
+// Storage is the in-memory reference implementation of dm.Storage.
+type Storage struct {
+	mu        sync.RWMutex
+	files     map[string]fss.File
+	fragments map[string]map[fragmentKey]fss.Fragment
+	servers   []fss.Server
+	leases    map[string]lease
+	jobs      map[string]fss.Job
+}
+
+// fragmentKey identifies a fragment of a file, versions of a file are stored side by side.
+type fragmentKey struct {
+	version int64
+	idx     int
+}
+
+type lease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// NewStorage creates empty in-memory storage.
+func NewStorage() *Storage {
+	return &Storage{
+		files:     make(map[string]fss.File),
+		fragments: make(map[string]map[fragmentKey]fss.Fragment),
+		leases:    make(map[string]lease),
+		jobs:      make(map[string]fss.Job),
+	}
+}
+
+// CreateFile creates file in system.
+func (s *Storage) CreateFile(_ context.Context, filename, placement string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[filename]; ok {
+		return 0, fss.NewConflictError("file '%s' exists", filename)
+	}
+
+	if len(s.servers) == 0 {
+		return 0, fss.NewInternalError("insert file: no servers")
+	}
+
+	now := time.Now()
+	lastServerID := s.servers[len(s.servers)-1].ID
+	s.files[filename] = fss.File{
+		Name:            filename,
+		LastServerID:    lastServerID,
+		LastCommittedAt: &now,
+		Placement:       placement,
+	}
+
+	return lastServerID, nil
+}
+
+// File gets a file by name.
+func (s *Storage) File(_ context.Context, name string) (*fss.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil, fss.NewNotFoundError("file '%s' not found", name)
+	}
+
+	return &f, nil
+}
+
+// UpdateFile updates a file.
+func (s *Storage) UpdateFile(_ context.Context, f *fss.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.files[f.Name]
+	if !ok {
+		return fss.NewNotFoundError("file with name '%s' not found", f.Name)
+	}
+
+	stored.LastCommittedAt = f.LastCommittedAt
+	stored.Fragments = f.Fragments
+	stored.ETag = f.ETag
+	stored.Size = f.Size
+	stored.Version = f.Version
+	stored.UploadVersion = f.UploadVersion
+	stored.UploadSize = f.UploadSize
+	stored.UploadCommittedAt = f.UploadCommittedAt
+	s.files[f.Name] = stored
+
+	// Placement of versions which are neither committed nor uploaded is dropped.
+	for key := range s.fragments[f.Name] {
+		if key.version != f.Version && (f.UploadVersion == nil || key.version != *f.UploadVersion) {
+			delete(s.fragments[f.Name], key)
+		}
+	}
+
+	return nil
+}
+
+// DeleteFile deletes file by name.
+func (s *Storage) DeleteFile(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		return fss.NewNotFoundError("file '%s' not found", name)
+	}
+
+	delete(s.files, name)
+	delete(s.fragments, name)
+
+	return nil
+}
+
+// StaleFiles gets uncommitted files and files with uploads of new versions which were not touched since committedBefore.
+func (s *Storage) StaleFiles(_ context.Context, committedBefore time.Time, limit int) ([]fss.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []fss.File
+	for _, f := range s.files {
+		if touched := uploadTouchedAt(f); touched != nil && touched.Before(committedBefore) {
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return uploadTouchedAt(files[i]).Before(*uploadTouchedAt(files[j]))
+	})
+
+	if len(files) > limit {
+		files = files[:limit]
+	}
+
+	return files, nil
+}
+
+// Files gets files which names start with prefix and follow after ordered by name.
+func (s *Storage) Files(_ context.Context, prefix, after string, limit int) ([]fss.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []fss.File
+	for _, f := range s.files {
+		if strings.HasPrefix(f.Name, prefix) && f.Name > after {
+			files = append(files, f)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	if len(files) > limit {
+		files = files[:limit]
+	}
+
+	return files, nil
+}
+
+// BucketUsage sums sizes of files of the bucket, running uploads included.
+func (s *Storage) BucketUsage(_ context.Context, bucket string) (*fss.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usage := &fss.Usage{Bucket: bucket}
+	for _, f := range s.files {
+		if fss.Bucket(f.Name) == bucket {
+			addUsage(usage, f)
+		}
+	}
+
+	return usage, nil
+}
+
+// Usage sums sizes of files by bucket, running uploads included.
+func (s *Storage) Usage(_ context.Context) ([]fss.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make(map[string]*fss.Usage)
+	for _, f := range s.files {
+		bucket := fss.Bucket(f.Name)
+		if buckets[bucket] == nil {
+			buckets[bucket] = &fss.Usage{Bucket: bucket}
+		}
+
+		addUsage(buckets[bucket], f)
+	}
+
+	usage := make([]fss.Usage, 0, len(buckets))
+	for _, u := range buckets {
+		usage = append(usage, *u)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Bucket < usage[j].Bucket
+	})
+
+	return usage, nil
+}
+
+// Servers gets servers by last server id ordered by id.
+func (s *Storage) Servers(_ context.Context, lastServerID int64) ([]fss.Server, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var servers []fss.Server
+	for _, server := range s.servers {
+		if server.ID <= lastServerID {
+			servers = append(servers, server)
+		}
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID < servers[j].ID
+	})
+
+	return servers, nil
+}
+
+// CreateServer creates server in system.
+func (s *Storage) CreateServer(_ context.Context, server fss.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.servers {
+		if stored.URL == server.URL {
+			return fss.NewConflictError("server '%s' exists", server.URL)
+		}
+	}
+
+	server.ID = int64(len(s.servers) + 1)
+	s.servers = append(s.servers, server)
+
+	return nil
+}
+
+// Server gets a server by id.
+func (s *Storage) Server(_ context.Context, id int64) (*fss.Server, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	server := s.server(id)
+	if server == nil {
+		return nil, fss.NewNotFoundError("server %d not found", id)
+	}
+
+	stored := *server
+
+	return &stored, nil
+}
+
+// UpdateServer updates url, labels and mode of a server.
+func (s *Storage) UpdateServer(_ context.Context, server fss.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.server(server.ID)
+	if stored == nil {
+		return fss.NewNotFoundError("server %d not found", server.ID)
+	}
+
+	for _, other := range s.servers {
+		if other.URL == server.URL && other.ID != server.ID {
+			return fss.NewConflictError("server '%s' exists", server.URL)
+		}
+	}
+
+	*stored = server
+
+	return nil
+}
+
+// DeleteServer deletes a server which keeps no fragments.
+func (s *Storage) DeleteServer(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, fragments := range s.fragments {
+		for _, f := range fragments {
+			if f.ServerID == id {
+				return fss.NewConflictError("server %d keeps fragments", id)
+			}
+		}
+	}
+
+	for i, server := range s.servers {
+		if server.ID == id {
+			s.servers = append(s.servers[:i], s.servers[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return fss.NewNotFoundError("server %d not found", id)
+}
+
+// CreateFragments stores placement of fragments, existing fragments are replaced.
+func (s *Storage) CreateFragments(_ context.Context, fragments []fss.Fragment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range fragments {
+		if _, ok := s.files[f.FileName]; !ok {
+			return fss.NewNotFoundError("file '%s' not found", f.FileName)
+		}
+
+		if s.server(f.ServerID) == nil {
+			return fss.NewInternalError("insert fragment: server %d not found", f.ServerID)
+		}
+	}
+
+	for _, f := range fragments {
+		if s.fragments[f.FileName] == nil {
+			s.fragments[f.FileName] = make(map[fragmentKey]fss.Fragment)
+		}
+
+		f.ServerURL, f.ServerMode = "", ""
+		s.fragments[f.FileName][fragmentKey{version: f.Version, idx: f.Index}] = f
+	}
+
+	return nil
+}
+
+// Fragments gets fragments of the committed version of the file ordered by index.
+func (s *Storage) Fragments(_ context.Context, filename string) ([]fss.Fragment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok := s.files[filename]
+	if !ok {
+		return []fss.Fragment{}, nil
+	}
+
+	fragments := make([]fss.Fragment, 0, len(s.fragments[filename]))
+	for _, f := range s.fragments[filename] {
+		if f.Version != file.Version {
+			continue
+		}
+
+		server := s.server(f.ServerID)
+		f.ServerURL, f.ServerMode = server.URL, server.Mode
+		fragments = append(fragments, f)
+	}
+
+	sort.Slice(fragments, func(i, j int) bool {
+		return fragments[i].Index < fragments[j].Index
+	})
+
+	return fragments, nil
+}
+
+// AcquireLease takes or prolongs the lease, expired leases are taken over.
+func (s *Storage) AcquireLease(_ context.Context, name, holder string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expiresAt) {
+		return fss.NewConflictError("lease '%s' is held", name)
+	}
+
+	s.leases[name] = lease{
+		holder:    holder,
+		expiresAt: now.Add(ttl),
+	}
+
+	return nil
+}
+
+// ReleaseLease removes the lease if it is held by the holder.
+func (s *Storage) ReleaseLease(_ context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.leases[name]; ok && l.holder == holder {
+		delete(s.leases, name)
+	}
+
+	return nil
+}
+
+// SaveJob creates or replaces the job.
+func (s *Storage) SaveJob(_ context.Context, job fss.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = copyJob(job)
+
+	return nil
+}
+
+// Job gets a job by id.
+func (s *Storage) Job(_ context.Context, id string) (*fss.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fss.NewNotFoundError("job '%s' not found", id)
+	}
+
+	job = copyJob(job)
+
+	return &job, nil
+}
+
+// Jobs gets the latest jobs ordered by start time.
+func (s *Storage) Jobs(_ context.Context, limit int) ([]fss.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]fss.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, copyJob(job))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+
+	if len(jobs) > limit {
+		jobs = jobs[len(jobs)-limit:]
+	}
+
+	return jobs, nil
+}
+
+func copyJob(job fss.Job) fss.Job {
+	job.Issues = append([]string(nil), job.Issues...)
+
+	return job
+}
+
+// uploadTouchedAt returns when the running upload of the file committed a batch, nil if the file is committed.
+func uploadTouchedAt(f fss.File) *time.Time {
+	switch {
+	case f.UploadVersion != nil:
+		return f.UploadCommittedAt
+
+	case f.Fragments == nil:
+		return f.LastCommittedAt
+
+	default:
+		return nil
+	}
+}
+
+func addUsage(usage *fss.Usage, f fss.File) {
+	usage.Files++
+	// A file replaced by an upload counts with the bytes of the upload.
+	if f.UploadVersion != nil {
+		if f.UploadSize != nil {
+			usage.Bytes += *f.UploadSize
+		}
+
+		return
+	}
+
+	if f.Size != nil {
+		usage.Bytes += *f.Size
+	}
+}
+
+func (s *Storage) server(id int64) *fss.Server {
+	for i := range s.servers {
+		if s.servers[i].ID == id {
+			return &s.servers[i]
+		}
+	}
+
+	return nil
+}
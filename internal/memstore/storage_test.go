@@ -0,0 +1,15 @@
+package memstore_test
+
+import (
+	"testing"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/internal/storagetest"
+)
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) dm.Storage {
+		return memstore.NewStorage()
+	})
+}
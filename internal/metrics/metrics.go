@@ -0,0 +1,177 @@
+// Package metrics contains Prometheus metrics of the FSS and file servers.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "fss"
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// UploadedBytes counts bytes of uploaded files.
+	UploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes received in file uploads.",
+	})
+
+	// DownloadedBytes counts bytes of downloaded files.
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes sent in file downloads.",
+	})
+
+	// UploadsInFlight is the number of running uploads.
+	UploadsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "uploads_in_flight",
+		Help:      "Number of running uploads.",
+	})
+
+	// Rollbacks counts uploads rolled back after a failure.
+	Rollbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_rollbacks_total",
+		Help:      "Number of rolled back uploads.",
+	})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "read_cache_lookups_total",
+		Help:      "Lookups of fragments in the read cache by result: hit or miss.",
+	}, []string{"result"})
+
+	// CacheBytes is the size of fragments kept in the read cache.
+	CacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "read_cache_bytes",
+		Help:      "Bytes of fragments kept in the read cache.",
+	})
+
+	// CacheEvictions counts fragments evicted from the read cache.
+	CacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "read_cache_evictions_total",
+		Help:      "Number of fragments evicted from the read cache.",
+	})
+
+	fragmentDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fragment_operation_duration_seconds",
+		Help:      "Latency of fragment operations on file servers including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "operation", "result"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_query_duration_seconds",
+		Help:      "Latency of metadata storage queries.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"driver", "query", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		requests,
+		requestDuration,
+		UploadedBytes,
+		DownloadedBytes,
+		UploadsInFlight,
+		Rollbacks,
+		cacheLookups,
+		CacheBytes,
+		CacheEvictions,
+		fragmentDuration,
+		queryDuration,
+	)
+}
+
+// Handler serves the registered metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records count and latency of requests by the route template,
+// so path parameters don't grow the number of series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		status := strconv.Itoa(sw.status)
+		requests.WithLabelValues(route, r.Method, status).Inc()
+		requestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveFragment records latency of the fragment operation on the server.
+func ObserveFragment(server, operation string, start time.Time, err error) {
+	fragmentDuration.WithLabelValues(server, operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCacheLookup records a hit or a miss of the read cache.
+func ObserveCacheLookup(hit bool) {
+	if hit {
+		cacheLookups.WithLabelValues("hit").Inc()
+		return
+	}
+
+	cacheLookups.WithLabelValues("miss").Inc()
+}
+
+// ObserveQuery records latency of the metadata storage query.
+func ObserveQuery(driver, query string, start time.Time, err error) {
+	queryDuration.WithLabelValues(driver, query, result(err)).Observe(time.Since(start).Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
+
+// statusWriter remembers the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+)
+
+func TestMiddlewareUsesRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/fs-servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, id := range []string{"1", "2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fs-servers/"+id, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(requests.WithLabelValues("/fs-servers/{id}", http.MethodGet, "404")))
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := InstrumentStorage("memory", memstore.NewStorage())
+
+	_, err := storage.File(ctx, "missing")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+	assert.NoError(t, storage.AcquireLease(ctx, "lease", "holder", time.Minute))
+
+	// One series for every query and result.
+	assert.Equal(t, 2, testutil.CollectAndCount(queryDuration))
+}
+
+func TestServerStats(t *testing.T) {
+	c := statsCollector{stats: func() (*fss.ServerStats, error) {
+		return &fss.ServerStats{Capacity: 100, Used: 40, Free: 60, Fragments: 3}, nil
+	}}
+
+	assert.Equal(t, 4, testutil.CollectAndCount(c))
+}
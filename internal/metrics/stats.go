@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+var (
+	capacityDesc  = prometheus.NewDesc(namespace+"_file_server_capacity_bytes", "Capacity of the file server storage.", nil, nil)
+	usedDesc      = prometheus.NewDesc(namespace+"_file_server_used_bytes", "Bytes taken by fragments.", nil, nil)
+	freeDesc      = prometheus.NewDesc(namespace+"_file_server_free_bytes", "Bytes available for new fragments.", nil, nil)
+	fragmentsDesc = prometheus.NewDesc(namespace+"_file_server_fragments", "Number of stored fragments.", nil, nil)
+)
+
+// statsCollector reports the file server storage usage on every scrape.
+type statsCollector struct {
+	stats func() (*fss.ServerStats, error)
+}
+
+// RegisterServerStats registers disk usage metrics of the file server.
+func RegisterServerStats(stats func() (*fss.ServerStats, error)) {
+	prometheus.MustRegister(statsCollector{stats: stats})
+}
+
+func (c statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- capacityDesc
+	ch <- usedDesc
+	ch <- freeDesc
+	ch <- fragmentsDesc
+}
+
+func (c statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.stats()
+	if err != nil {
+		log.Error().Err(err).Msg("collect server stats")
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(capacityDesc, prometheus.GaugeValue, float64(stats.Capacity))
+	ch <- prometheus.MustNewConstMetric(usedDesc, prometheus.GaugeValue, float64(stats.Used))
+	ch <- prometheus.MustNewConstMetric(freeDesc, prometheus.GaugeValue, float64(stats.Free))
+	ch <- prometheus.MustNewConstMetric(fragmentsDesc, prometheus.GaugeValue, float64(stats.Fragments))
+}
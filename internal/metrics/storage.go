@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Storage records latency of every query of the wrapped metadata storage.
+type Storage struct {
+	storage dm.Storage
+	driver  string
+}
+
+var _ dm.Storage = (*Storage)(nil)
+
+// InstrumentStorage wraps the storage of the driver.
+func InstrumentStorage(driver string, storage dm.Storage) *Storage {
+	return &Storage{
+		storage: storage,
+		driver:  driver,
+	}
+}
+
+func (s *Storage) CreateFile(ctx context.Context, filename, placement string) (_ int64, err error) {
+	defer s.observe("CreateFile", time.Now(), &err)
+
+	return s.storage.CreateFile(ctx, filename, placement)
+}
+
+func (s *Storage) File(ctx context.Context, name string) (_ *fss.File, err error) {
+	defer s.observe("File", time.Now(), &err)
+
+	return s.storage.File(ctx, name)
+}
+
+func (s *Storage) UpdateFile(ctx context.Context, f *fss.File) (err error) {
+	defer s.observe("UpdateFile", time.Now(), &err)
+
+	return s.storage.UpdateFile(ctx, f)
+}
+
+func (s *Storage) DeleteFile(ctx context.Context, name string) (err error) {
+	defer s.observe("DeleteFile", time.Now(), &err)
+
+	return s.storage.DeleteFile(ctx, name)
+}
+
+func (s *Storage) StaleFiles(ctx context.Context, committedBefore time.Time, limit int) (_ []fss.File, err error) {
+	defer s.observe("StaleFiles", time.Now(), &err)
+
+	return s.storage.StaleFiles(ctx, committedBefore, limit)
+}
+
+func (s *Storage) Files(ctx context.Context, prefix, after string, limit int) (_ []fss.File, err error) {
+	defer s.observe("Files", time.Now(), &err)
+
+	return s.storage.Files(ctx, prefix, after, limit)
+}
+
+func (s *Storage) BucketUsage(ctx context.Context, bucket string) (_ *fss.Usage, err error) {
+	defer s.observe("BucketUsage", time.Now(), &err)
+
+	return s.storage.BucketUsage(ctx, bucket)
+}
+
+func (s *Storage) Usage(ctx context.Context) (_ []fss.Usage, err error) {
+	defer s.observe("Usage", time.Now(), &err)
+
+	return s.storage.Usage(ctx)
+}
+
+func (s *Storage) Servers(ctx context.Context, last int64) (_ []fss.Server, err error) {
+	defer s.observe("Servers", time.Now(), &err)
+
+	return s.storage.Servers(ctx, last)
+}
+
+func (s *Storage) CreateServer(ctx context.Context, server fss.Server) (err error) {
+	defer s.observe("CreateServer", time.Now(), &err)
+
+	return s.storage.CreateServer(ctx, server)
+}
+
+func (s *Storage) Server(ctx context.Context, id int64) (_ *fss.Server, err error) {
+	defer s.observe("Server", time.Now(), &err)
+
+	return s.storage.Server(ctx, id)
+}
+
+func (s *Storage) UpdateServer(ctx context.Context, server fss.Server) (err error) {
+	defer s.observe("UpdateServer", time.Now(), &err)
+
+	return s.storage.UpdateServer(ctx, server)
+}
+
+func (s *Storage) DeleteServer(ctx context.Context, id int64) (err error) {
+	defer s.observe("DeleteServer", time.Now(), &err)
+
+	return s.storage.DeleteServer(ctx, id)
+}
+
+func (s *Storage) CreateFragments(ctx context.Context, fragments []fss.Fragment) (err error) {
+	defer s.observe("CreateFragments", time.Now(), &err)
+
+	return s.storage.CreateFragments(ctx, fragments)
+}
+
+func (s *Storage) Fragments(ctx context.Context, filename string) (_ []fss.Fragment, err error) {
+	defer s.observe("Fragments", time.Now(), &err)
+
+	return s.storage.Fragments(ctx, filename)
+}
+
+func (s *Storage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (err error) {
+	defer s.observe("AcquireLease", time.Now(), &err)
+
+	return s.storage.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) (err error) {
+	defer s.observe("ReleaseLease", time.Now(), &err)
+
+	return s.storage.ReleaseLease(ctx, name, holder)
+}
+
+func (s *Storage) SaveJob(ctx context.Context, job fss.Job) (err error) {
+	defer s.observe("SaveJob", time.Now(), &err)
+
+	return s.storage.SaveJob(ctx, job)
+}
+
+func (s *Storage) Job(ctx context.Context, id string) (_ *fss.Job, err error) {
+	defer s.observe("Job", time.Now(), &err)
+
+	return s.storage.Job(ctx, id)
+}
+
+func (s *Storage) Jobs(ctx context.Context, limit int) (_ []fss.Job, err error) {
+	defer s.observe("Jobs", time.Now(), &err)
+
+	return s.storage.Jobs(ctx, limit)
+}
+
+func (s *Storage) observe(query string, start time.Time, err *error) {
+	ObserveQuery(s.driver, query, start, *err)
+}
@@ -6,20 +6,25 @@ import (
 	"fmt"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
 )
 
-func ApplyMigrations(migrationsPath string, db *sql.DB) error {
-	driver, err := postgres.WithInstance(db, &postgres.Config{
-		SchemaName: "public",
-	})
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+func ApplyMigrations(driverName, migrationsPath string, db *sql.DB) error {
+	driver, err := instance(driverName, db)
 	if err != nil {
 		return fmt.Errorf("init instance: %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://"+migrationsPath, "postgres", driver)
+	m, err := migrate.NewWithDatabaseInstance("file://"+migrationsPath, driverName, driver)
 	if err != nil {
 		return fmt.Errorf("init migrate: %w", err)
 	}
@@ -30,3 +35,18 @@ func ApplyMigrations(migrationsPath string, db *sql.DB) error {
 
 	return nil
 }
+
+func instance(driverName string, db *sql.DB) (database.Driver, error) {
+	switch driverName {
+	case DriverPostgres:
+		return postgres.WithInstance(db, &postgres.Config{
+			SchemaName: "public",
+		})
+
+	case DriverSQLite:
+		return sqlite.WithInstance(db, &sqlite.Config{})
+
+	default:
+		return nil, fmt.Errorf("unknown driver '%s'", driverName)
+	}
+}
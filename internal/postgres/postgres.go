@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -15,6 +16,7 @@ import (
 
 const (
 	constraintViolationCode = "23505"
+	foreignKeyViolationCode = "23503"
 )
 
 // Config contains settings for db.
@@ -68,14 +70,14 @@ func New(c Config) (*DB, error) {
 }
 
 // CreateFile creates file in system.
-func (s *DB) CreateFile(ctx context.Context, filename string) (int64, error) {
+func (s *DB) CreateFile(ctx context.Context, filename, placement string) (int64, error) {
 	query :=
-		`INSERT INTO files (name, last_server_id, last_committed_at) 
-			VALUES ($1, (SELECT id FROM servers ORDER by id DESC LIMIT 1), CURRENT_TIMESTAMP)
+		`INSERT INTO files (name, last_server_id, last_committed_at, placement, bucket)
+			VALUES ($1, (SELECT id FROM servers ORDER by id DESC LIMIT 1), CURRENT_TIMESTAMP, $2, $3)
 			RETURNING last_server_id
 	`
 	var lastServerID int64
-	err := s.QueryRowContext(ctx, query, filename).Scan(&lastServerID)
+	err := s.QueryRowContext(ctx, query, filename, placement, fss.Bucket(filename)).Scan(&lastServerID)
 	pqErr := new(pq.Error)
 	if ok := errors.As(err, &pqErr); ok && pqErr.Code == constraintViolationCode {
 		return 0, fss.NewConflictError("file exists: %w", err)
@@ -89,7 +91,8 @@ func (s *DB) CreateFile(ctx context.Context, filename string) (int64, error) {
 
 // File gets a file by name.
 func (s *DB) File(ctx context.Context, name string) (*fss.File, error) {
-	q := `SELECT name, last_server_id, last_committed_at, fragments FROM files f WHERE name=$1`
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files f WHERE name=$1`
 	file := new(fss.File)
 	err := s.GetContext(ctx, file, q, name)
 	switch {
@@ -106,10 +109,22 @@ func (s *DB) File(ctx context.Context, name string) (*fss.File, error) {
 
 // UpdateFile updates a file.
 func (s *DB) UpdateFile(ctx context.Context, f *fss.File) (err error) {
-	params := []any{f.LastCommittedAt, f.Fragments, f.Name}
-	q := `UPDATE files f SET last_committed_at = $1, fragments = $2 WHERE name = $3`
+	tx, err := s.BeginTxx(ctx, nil)
+	if err != nil {
+		return fss.NewInternalError("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fss.HandleErrPair(tx.Rollback(), err)
+		}
+	}()
+
+	params := []any{f.LastCommittedAt, f.Fragments, f.ETag, f.Size, f.Version, f.UploadVersion, f.UploadSize, f.UploadCommittedAt, f.Name}
+	q := `UPDATE files f SET last_committed_at = $1, fragments = $2, etag = $3, size = $4,
+		version = $5, upload_version = $6, upload_size = $7, upload_committed_at = $8 WHERE name = $9`
 
-	result, err := s.DB.ExecContext(ctx, q, params...)
+	result, err := tx.ExecContext(ctx, q, params...)
 	if err != nil {
 		return fss.NewInternalError("update file: %w", err)
 	}
@@ -123,6 +138,16 @@ func (s *DB) UpdateFile(ctx context.Context, f *fss.File) (err error) {
 		return fss.NewNotFoundError("file with name '%s' not found", f.Name)
 	}
 
+	// Placement of versions which are neither committed nor uploaded is dropped.
+	q = `DELETE FROM fragments WHERE file_name = $1 AND version <> $2 AND version IS DISTINCT FROM $3`
+	if _, err = tx.ExecContext(ctx, q, f.Name, f.Version, f.UploadVersion); err != nil {
+		return fss.NewInternalError("delete fragments of replaced versions: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fss.NewInternalError("commit transaction: %w", err)
+	}
+
 	return nil
 }
 
@@ -146,9 +171,61 @@ func (s *DB) DeleteFile(ctx context.Context, name string) error {
 	return nil
 }
 
+// StaleFiles gets uncommitted files and files with uploads of new versions which were not touched since committedBefore.
+func (s *DB) StaleFiles(ctx context.Context, committedBefore time.Time, limit int) ([]fss.File, error) {
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files
+		WHERE fragments IS NULL AND last_committed_at < $1 OR upload_committed_at < $1
+		ORDER BY COALESCE(upload_committed_at, last_committed_at) LIMIT $2`
+
+	var files []fss.File
+	if err := s.SelectContext(ctx, &files, q, committedBefore, limit); err != nil {
+		return nil, fss.NewInternalError("select stale files: %w", err)
+	}
+
+	return files, nil
+}
+
+// Files gets files which names start with prefix and follow after ordered by name.
+func (s *DB) Files(ctx context.Context, prefix, after string, limit int) ([]fss.File, error) {
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files
+		WHERE left(name, length($1)) = $1 AND name > $2 ORDER BY name LIMIT $3`
+
+	var files []fss.File
+	if err := s.SelectContext(ctx, &files, q, prefix, after, limit); err != nil {
+		return nil, fss.NewInternalError("select files: %w", err)
+	}
+
+	return files, nil
+}
+
+// BucketUsage sums sizes of files of the bucket, running uploads included.
+func (s *DB) BucketUsage(ctx context.Context, bucket string) (*fss.Usage, error) {
+	q := `SELECT COUNT(*) AS files, COALESCE(SUM(CASE WHEN upload_version IS NULL THEN size ELSE upload_size END), 0) AS bytes FROM files WHERE bucket = $1`
+	usage := &fss.Usage{Bucket: bucket}
+	if err := s.GetContext(ctx, usage, q, bucket); err != nil {
+		return nil, fss.NewInternalError("select bucket usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Usage sums sizes of files by bucket, running uploads included.
+func (s *DB) Usage(ctx context.Context) ([]fss.Usage, error) {
+	q := `SELECT bucket, COUNT(*) AS files, COALESCE(SUM(CASE WHEN upload_version IS NULL THEN size ELSE upload_size END), 0) AS bytes FROM files GROUP BY bucket ORDER BY bucket`
+
+	var usage []fss.Usage
+	if err := s.SelectContext(ctx, &usage, q); err != nil {
+		return nil, fss.NewInternalError("select usage: %w", err)
+	}
+
+	return usage, nil
+}
+
 // Servers gets servers by last server id.
 func (s *DB) Servers(ctx context.Context, lastServerID int64) ([]fss.Server, error) {
-	q := "SELECT s.id, s.url FROM servers s WHERE s.id <= $1 ORDER BY id"
+	q := "SELECT s.id, s.url, s.capacity, s.weight, s.zone, s.mode FROM servers s WHERE s.id <= $1 ORDER BY id"
 	rows, err := s.QueryContext(ctx, q, lastServerID)
 	if err != nil {
 		return nil, fss.NewInternalError("select servers: %w", err)
@@ -163,9 +240,9 @@ func (s *DB) Servers(ctx context.Context, lastServerID int64) ([]fss.Server, err
 }
 
 // CreateServer creates server in system.
-func (s *DB) CreateServer(ctx context.Context, uri string) error {
-	query := "INSERT INTO servers (url) VALUES ($1)"
-	_, err := s.DB.ExecContext(ctx, query, uri)
+func (s *DB) CreateServer(ctx context.Context, server fss.Server) error {
+	query := "INSERT INTO servers (url, capacity, weight, zone, mode) VALUES ($1, $2, $3, $4, $5)"
+	_, err := s.DB.ExecContext(ctx, query, server.URL, server.Capacity, server.Weight, server.Zone, server.Mode)
 	pqErr := new(pq.Error)
 	if ok := errors.As(err, &pqErr); ok && pqErr.Code == constraintViolationCode {
 		return fss.NewConflictError("insert server: %w", err)
@@ -177,3 +254,282 @@ func (s *DB) CreateServer(ctx context.Context, uri string) error {
 
 	return nil
 }
+
+// Server gets a server by id.
+func (s *DB) Server(ctx context.Context, id int64) (*fss.Server, error) {
+	q := "SELECT s.id, s.url, s.capacity, s.weight, s.zone, s.mode FROM servers s WHERE s.id = $1"
+	server := new(fss.Server)
+	err := s.GetContext(ctx, server, q, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fss.NewNotFoundError("server %d not found", id)
+
+	case err != nil:
+		return nil, fss.NewInternalError("select server: %w", err)
+
+	default:
+		return server, nil
+	}
+}
+
+// UpdateServer updates url, labels and mode of a server.
+func (s *DB) UpdateServer(ctx context.Context, server fss.Server) error {
+	q := `UPDATE servers SET url = $1, capacity = $2, weight = $3, zone = $4, mode = $5 WHERE id = $6`
+	result, err := s.DB.ExecContext(ctx, q, server.URL, server.Capacity, server.Weight, server.Zone, server.Mode, server.ID)
+	pqErr := new(pq.Error)
+	if ok := errors.As(err, &pqErr); ok && pqErr.Code == constraintViolationCode {
+		return fss.NewConflictError("update server: %w", err)
+	}
+	if err != nil {
+		return fss.NewInternalError("update server: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("server %d not found", server.ID)
+	}
+
+	return nil
+}
+
+// DeleteServer deletes a server which keeps no fragments.
+func (s *DB) DeleteServer(ctx context.Context, id int64) error {
+	q := `DELETE FROM servers WHERE id = $1`
+	result, err := s.ExecContext(ctx, q, id)
+	pqErr := new(pq.Error)
+	if ok := errors.As(err, &pqErr); ok && pqErr.Code == foreignKeyViolationCode {
+		return fss.NewConflictError("server %d keeps fragments: %w", id, err)
+	}
+	if err != nil {
+		return fss.NewInternalError("remove server: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("server %d not found", id)
+	}
+
+	return nil
+}
+
+// CreateFragments stores placement of fragments, existing fragments are replaced.
+func (s *DB) CreateFragments(ctx context.Context, fragments []fss.Fragment) (err error) {
+	tx, err := s.BeginTxx(ctx, nil)
+	if err != nil {
+		return fss.NewInternalError("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fss.HandleErrPair(tx.Rollback(), err)
+		}
+	}()
+
+	q := `INSERT INTO fragments (file_name, version, idx, server_id, size, checksum, state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (file_name, version, idx) DO UPDATE
+		SET server_id = excluded.server_id, size = excluded.size, checksum = excluded.checksum, state = excluded.state`
+	for _, f := range fragments {
+		_, err = tx.ExecContext(ctx, q, f.FileName, f.Version, f.Index, f.ServerID, f.Size, f.Checksum, f.State)
+		pqErr := new(pq.Error)
+		if ok := errors.As(err, &pqErr); ok && pqErr.Code == foreignKeyViolationCode {
+			return fss.NewNotFoundError("file '%s' not found: %w", f.FileName, err)
+		}
+		if err != nil {
+			return fss.NewInternalError("insert fragment: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fss.NewInternalError("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Fragments gets fragments of the committed version of the file ordered by index.
+func (s *DB) Fragments(ctx context.Context, filename string) ([]fss.Fragment, error) {
+	q := `SELECT fr.file_name, fr.version, fr.idx, fr.server_id, s.url, s.mode, fr.size, fr.checksum, fr.state
+		FROM fragments fr JOIN servers s ON s.id = fr.server_id
+		JOIN files f ON f.name = fr.file_name AND f.version = fr.version
+		WHERE fr.file_name = $1 ORDER BY fr.idx`
+
+	var fragments []fss.Fragment
+	if err := s.SelectContext(ctx, &fragments, q, filename); err != nil {
+		return nil, fss.NewInternalError("select fragments: %w", err)
+	}
+
+	return fragments, nil
+}
+
+// AcquireLease takes or prolongs the lease, expired leases are taken over.
+func (s *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) error {
+	q := `INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < CURRENT_TIMESTAMP`
+
+	result, err := s.DB.ExecContext(ctx, q, name, holder, ttl.Seconds())
+	if err != nil {
+		return fss.NewInternalError("upsert lease: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewConflictError("lease '%s' is held", name)
+	}
+
+	return nil
+}
+
+// ReleaseLease removes the lease if it is held by the holder.
+func (s *DB) ReleaseLease(ctx context.Context, name, holder string) error {
+	q := "DELETE FROM leases WHERE name = $1 AND holder = $2"
+	if _, err := s.DB.ExecContext(ctx, q, name, holder); err != nil {
+		return fss.NewInternalError("delete lease: %w", err)
+	}
+
+	return nil
+}
+
+// SaveJob creates or replaces the job.
+func (s *DB) SaveJob(ctx context.Context, job fss.Job) error {
+	row, err := newJobRow(job)
+	if err != nil {
+		return fss.NewInternalError("convert job: %w", err)
+	}
+
+	q := `INSERT INTO jobs (id, kind, state, started_at, finished_at, total, done, failed, issues, error)
+		VALUES (:id, :kind, :state, :started_at, :finished_at, :total, :done, :failed, :issues, :error)
+		ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state, finished_at = EXCLUDED.finished_at,
+			total = EXCLUDED.total, done = EXCLUDED.done, failed = EXCLUDED.failed, issues = EXCLUDED.issues, error = EXCLUDED.error`
+
+	if _, err := s.NamedExecContext(ctx, q, row); err != nil {
+		return fss.NewInternalError("upsert job: %w", err)
+	}
+
+	return nil
+}
+
+// Job gets a job by id.
+func (s *DB) Job(ctx context.Context, id string) (*fss.Job, error) {
+	q := `SELECT id, kind, state, started_at, finished_at, total, done, failed, issues, error FROM jobs WHERE id = $1`
+
+	var row jobRow
+	err := s.GetContext(ctx, &row, q, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fss.NewNotFoundError("job '%s' not found", id)
+
+	case err != nil:
+		return nil, fss.NewInternalError("select job: %w", err)
+	}
+
+	job, err := row.job()
+	if err != nil {
+		return nil, fss.NewInternalError("convert job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Jobs gets the latest jobs ordered by start time.
+func (s *DB) Jobs(ctx context.Context, limit int) ([]fss.Job, error) {
+	q := `SELECT * FROM (
+			SELECT id, kind, state, started_at, finished_at, total, done, failed, issues, error
+			FROM jobs ORDER BY started_at DESC LIMIT $1
+		) j ORDER BY started_at`
+
+	var rows []jobRow
+	if err := s.SelectContext(ctx, &rows, q, limit); err != nil {
+		return nil, fss.NewInternalError("select jobs: %w", err)
+	}
+
+	jobs := make([]fss.Job, 0, len(rows))
+	for _, row := range rows {
+		job, err := row.job()
+		if err != nil {
+			return nil, fss.NewInternalError("convert job '%s': %w", row.ID, err)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// jobRow is a job as it is kept in the db, issues are encoded as a JSON array.
+type jobRow struct {
+	ID         string     `db:"id"`
+	Kind       string     `db:"kind"`
+	State      string     `db:"state"`
+	StartedAt  time.Time  `db:"started_at"`
+	FinishedAt *time.Time `db:"finished_at"`
+	Total      int64      `db:"total"`
+	Done       int64      `db:"done"`
+	Failed     int64      `db:"failed"`
+	Issues     string     `db:"issues"`
+	Error      string     `db:"error"`
+}
+
+// newJobRow keeps times in UTC, so jobs are ordered regardless of the zone of the replica.
+func newJobRow(job fss.Job) (jobRow, error) {
+	issues, err := json.Marshal(append([]string{}, job.Issues...))
+	if err != nil {
+		return jobRow{}, fmt.Errorf("encode issues: %w", err)
+	}
+
+	row := jobRow{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		State:     job.State,
+		StartedAt: job.StartedAt.UTC(),
+		Total:     job.Total,
+		Done:      job.Done,
+		Failed:    job.Failed,
+		Issues:    string(issues),
+		Error:     job.Error,
+	}
+
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.UTC()
+		row.FinishedAt = &finishedAt
+	}
+
+	return row, nil
+}
+
+func (r jobRow) job() (fss.Job, error) {
+	job := fss.Job{
+		ID:         r.ID,
+		Kind:       r.Kind,
+		State:      r.State,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Total:      r.Total,
+		Done:       r.Done,
+		Failed:     r.Failed,
+		Error:      r.Error,
+	}
+
+	if err := json.Unmarshal([]byte(r.Issues), &job.Issues); err != nil {
+		return fss.Job{}, fmt.Errorf("decode issues: %w", err)
+	}
+
+	if len(job.Issues) == 0 {
+		job.Issues = nil
+	}
+
+	return job, nil
+}
@@ -0,0 +1,45 @@
+package postgres_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Tsapen/fss/internal/config"
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/postgres"
+	"github.com/Tsapen/fss/internal/storagetest"
+)
+
+// TestStorageContract truncates the tables of the db from FSS_CONFIG,
+// so it runs only when FSS_STORAGE_CONTRACT is set.
+func TestStorageContract(t *testing.T) {
+	if os.Getenv("FSS_STORAGE_CONTRACT") == "" {
+		t.Skip("FSS_STORAGE_CONTRACT is not set")
+	}
+
+	cfg, err := config.GetForFSS()
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+
+	db, err := postgres.New(postgres.Config{
+		UserName:    cfg.DB.UserName,
+		Password:    cfg.DB.Password,
+		Port:        cfg.DB.Port,
+		VirtualHost: cfg.DB.VirtualHost,
+		HostName:    cfg.DB.HostName,
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	defer db.Close()
+
+	storagetest.Run(t, func(t *testing.T) dm.Storage {
+		if _, err := db.Exec(`TRUNCATE fragments, files, servers, leases, jobs RESTART IDENTITY`); err != nil {
+			t.Fatalf("truncate tables: %v", err)
+		}
+
+		return db
+	})
+}
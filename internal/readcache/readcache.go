@@ -0,0 +1,377 @@
+// Package readcache keeps fragments of hot files in memory or on the local disk, so they
+// are not fetched from file servers on every download. Fragments are keyed by the file
+// version, an overwritten file is never served from the cache.
+package readcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/Tsapen/fss/internal/metrics"
+)
+
+// Eviction policies.
+const (
+	// PolicyLRU evicts the least recently used fragments.
+	PolicyLRU = "lru"
+	// PolicyTinyLFU evicts like LRU but admits a fragment only if it was requested more often
+	// than the fragments it would evict, so a scan of cold files doesn't flush hot ones.
+	PolicyTinyLFU = "tinylfu"
+)
+
+// fileSuffix marks cached fragments in Config.Dir.
+const fileSuffix = ".fragment"
+
+// Config controls the cache.
+type Config struct {
+	// Size bounds the cached bytes.
+	Size int64
+	// Dir keeps fragments on the local disk, empty means memory.
+	Dir string
+	// Policy is lru or tinylfu, tinylfu by default.
+	Policy string
+}
+
+// Key identifies a fragment of one version of the file.
+type Key struct {
+	File string
+	// Version changes when the file is overwritten, e.g. the etag with the commit time.
+	Version string
+	Index   int
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s\x00%s\x00%d", k.File, k.Version, k.Index)
+}
+
+// Cache is a bounded cache of fragments.
+type Cache struct {
+	cfg   Config
+	group singleflight.Group
+
+	mu     sync.Mutex
+	size   int64
+	order  *list.List
+	files  map[string]*fileEntries
+	sketch *sketch
+}
+
+// fileEntries are cached fragments of the file, only one version of a file is kept.
+type fileEntries struct {
+	version   string
+	fragments map[int]*list.Element
+}
+
+type entry struct {
+	key  Key
+	size int64
+	// data is nil if the fragment is kept on the disk.
+	data []byte
+}
+
+// New constructs the cache. Fragments left in the cache directory by a previous run are removed.
+func New(cfg Config) (*Cache, error) {
+	if cfg.Size <= 0 {
+		return nil, fmt.Errorf("cache size must be positive, got %d", cfg.Size)
+	}
+
+	c := &Cache{
+		cfg:   cfg,
+		order: list.New(),
+		files: make(map[string]*fileEntries),
+	}
+
+	switch cfg.Policy {
+	case "", PolicyTinyLFU:
+		c.sketch = newSketch(cfg.Size)
+
+	case PolicyLRU:
+
+	default:
+		return nil, fmt.Errorf("unknown cache policy '%s'", cfg.Policy)
+	}
+
+	if cfg.Dir != "" {
+		if err := clearDir(cfg.Dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Get returns the cached fragment or fetches and caches it. Concurrent misses of the same
+// fragment share one fetch, which is not canceled when one of the waiting requests goes away.
+func (c *Cache) Get(ctx context.Context, key Key, fetch func(context.Context) ([]byte, error)) ([]byte, error) {
+	data, ok := c.lookup(key)
+	metrics.ObserveCacheLookup(ok)
+	if ok {
+		return data, nil
+	}
+
+	ch := c.group.DoChan(key.String(), func() (any, error) {
+		data, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		c.add(key, data)
+
+		return data, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.([]byte), nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Forget drops cached fragments of the file.
+func (c *Cache) Forget(file string) {
+	c.mu.Lock()
+	removed := c.removeFile(file)
+	c.mu.Unlock()
+
+	c.removeFiles(removed)
+}
+
+// Size returns the cached bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+func (c *Cache) lookup(key Key) ([]byte, bool) {
+	c.mu.Lock()
+	if c.sketch != nil {
+		c.sketch.increment(key)
+	}
+
+	e := c.element(key)
+	if e == nil {
+		c.mu.Unlock()
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+	data := e.Value.(*entry).data
+	c.mu.Unlock()
+
+	if c.cfg.Dir == "" {
+		return data, true
+	}
+
+	// The fragment may be evicted meanwhile, then it's fetched again.
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (c *Cache) element(key Key) *list.Element {
+	files, ok := c.files[key.File]
+	if !ok || files.version != key.Version {
+		return nil
+	}
+
+	return files.fragments[key.Index]
+}
+
+func (c *Cache) add(key Key, data []byte) {
+	size := int64(len(data))
+	if size > c.cfg.Size {
+		return
+	}
+
+	if c.cfg.Dir != "" {
+		if err := writeFile(c.path(key), data); err != nil {
+			log.Error().Err(err).Msgf("cache fragment %d of '%s'", key.Index, key.File)
+			return
+		}
+
+		data = nil
+	}
+
+	c.mu.Lock()
+	removed, admitted := c.insert(key, size, data)
+	c.mu.Unlock()
+
+	if !admitted && c.cfg.Dir != "" {
+		removed = append(removed, key)
+	}
+
+	c.removeFiles(removed)
+}
+
+// insert adds the fragment and returns evicted keys, admitted is false if TinyLFU rejected it.
+func (c *Cache) insert(key Key, size int64, data []byte) (removed []Key, admitted bool) {
+	files, ok := c.files[key.File]
+	if ok && files.version != key.Version {
+		// A new version of the file replaces the cached one.
+		removed = c.removeFile(key.File)
+		ok = false
+	}
+
+	if ok {
+		if e, ok := files.fragments[key.Index]; ok {
+			c.order.MoveToFront(e)
+
+			return removed, true
+		}
+	}
+
+	var victims []*list.Element
+	free := c.cfg.Size - c.size
+	for e := c.order.Back(); free < size && e != nil; e = e.Prev() {
+		victims = append(victims, e)
+		free += e.Value.(*entry).size
+	}
+
+	if c.sketch != nil && len(victims) > 0 {
+		freq := c.sketch.estimate(key)
+		for _, e := range victims {
+			if c.sketch.estimate(e.Value.(*entry).key) >= freq {
+				return removed, false
+			}
+		}
+	}
+
+	for _, e := range victims {
+		removed = append(removed, c.remove(e))
+		metrics.CacheEvictions.Inc()
+	}
+
+	if files, ok = c.files[key.File]; !ok {
+		files = &fileEntries{version: key.Version, fragments: make(map[int]*list.Element)}
+		c.files[key.File] = files
+	}
+
+	files.fragments[key.Index] = c.order.PushFront(&entry{key: key, size: size, data: data})
+	c.size += size
+	metrics.CacheBytes.Add(float64(size))
+
+	return removed, true
+}
+
+func (c *Cache) removeFile(file string) []Key {
+	files, ok := c.files[file]
+	if !ok {
+		return nil
+	}
+
+	removed := make([]Key, 0, len(files.fragments))
+	for _, e := range files.fragments {
+		removed = append(removed, c.remove(e))
+	}
+
+	return removed
+}
+
+func (c *Cache) remove(e *list.Element) Key {
+	ent := c.order.Remove(e).(*entry)
+	files := c.files[ent.key.File]
+	delete(files.fragments, ent.key.Index)
+	if len(files.fragments) == 0 {
+		delete(c.files, ent.key.File)
+	}
+
+	c.size -= ent.size
+	metrics.CacheBytes.Sub(float64(ent.size))
+
+	return ent.key
+}
+
+// removeFiles deletes evicted fragments from the disk.
+func (c *Cache) removeFiles(keys []Key) {
+	if c.cfg.Dir == "" {
+		return
+	}
+
+	for _, key := range keys {
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Msgf("remove cached fragment %d of '%s'", key.Index, key.File)
+		}
+	}
+}
+
+func (c *Cache) path(key Key) string {
+	sum := sha256.Sum256([]byte(key.String()))
+
+	return filepath.Join(c.cfg.Dir, hex.EncodeToString(sum[:])+fileSuffix)
+}
+
+// writeFile replaces the file atomically, so readers never see a partial fragment.
+func writeFile(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("write temporary file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename temporary file: %w", err)
+	}
+
+	return nil
+}
+
+func clearDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read cache directory: %w", err)
+	}
+
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), fileSuffix) && !strings.HasPrefix(e.Name(), "tmp-") {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("remove cached fragment: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package readcache_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsapen/fss/internal/readcache"
+)
+
+// fetcher counts fetches of fragments.
+type fetcher struct {
+	calls atomic.Int64
+	size  int
+}
+
+func (f *fetcher) fetch(context.Context) ([]byte, error) {
+	f.calls.Add(1)
+
+	return make([]byte, f.size), nil
+}
+
+func get(t *testing.T, c *readcache.Cache, f *fetcher, file string, idx int) {
+	t.Helper()
+
+	data, err := c.Get(context.Background(), readcache.Key{File: file, Version: "v1", Index: idx}, f.fetch)
+	require.NoError(t, err)
+	assert.Len(t, data, f.size)
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// calls of the scan is the number of fetches after the hot fragments were requested again.
+		calls int64
+	}{
+		{name: "lru flushes hot fragments", policy: readcache.PolicyLRU, calls: 6},
+		{name: "tinylfu keeps hot fragments", policy: readcache.PolicyTinyLFU, calls: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := readcache.New(readcache.Config{Size: 20, Policy: tt.policy})
+			require.NoError(t, err)
+
+			f := &fetcher{size: 10}
+			for i := 0; i < 3; i++ {
+				get(t, c, f, "hot", 0)
+				get(t, c, f, "hot", 1)
+			}
+
+			assert.Equal(t, int64(2), f.calls.Load())
+
+			get(t, c, f, "cold", 0)
+			get(t, c, f, "cold", 1)
+			get(t, c, f, "hot", 0)
+			get(t, c, f, "hot", 1)
+			assert.Equal(t, tt.calls, f.calls.Load())
+			assert.LessOrEqual(t, c.Size(), int64(20))
+		})
+	}
+}
+
+func TestVersions(t *testing.T) {
+	c, err := readcache.New(readcache.Config{Size: 100})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	f := &fetcher{size: 10}
+	for _, version := range []string{"v1", "v1", "v2", "v2"} {
+		_, err := c.Get(ctx, readcache.Key{File: "file", Version: version}, f.fetch)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(2), f.calls.Load())
+	assert.Equal(t, int64(10), c.Size())
+
+	c.Forget("file")
+	assert.Zero(t, c.Size())
+
+	_, err = c.Get(ctx, readcache.Key{File: "file", Version: "v3"}, func(context.Context) ([]byte, error) {
+		return nil, errors.New("unavailable")
+	})
+	assert.Error(t, err)
+	assert.Zero(t, c.Size())
+}
+
+func TestSingleFlight(t *testing.T) {
+	c, err := readcache.New(readcache.Config{Size: 100})
+	require.NoError(t, err)
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	fetch := func(context.Context) ([]byte, error) {
+		calls.Add(1)
+		<-release
+
+		return []byte("fragment"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			data, err := c.Get(context.Background(), readcache.Key{File: "file"}, fetch)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("fragment"), data)
+		}()
+	}
+
+	// A waiting request goes away without canceling the shared fetch.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Get(ctx, readcache.Key{File: "file"}, fetch)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	wg.Wait()
+	assert.LessOrEqual(t, calls.Load(), int64(2))
+}
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/stale.fragment", nil, 0o644))
+
+	c, err := readcache.New(readcache.Config{Size: 20, Dir: dir, Policy: readcache.PolicyLRU})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	f := &fetcher{size: 10}
+	for i := 0; i < 3; i++ {
+		get(t, c, f, "file", i)
+	}
+
+	get(t, c, f, "file", 2)
+	assert.Equal(t, int64(3), f.calls.Load())
+
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	c.Forget("file")
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := readcache.New(readcache.Config{})
+	assert.Error(t, err)
+
+	_, err = readcache.New(readcache.Config{Size: 1, Policy: "fifo"})
+	assert.Error(t, err)
+}
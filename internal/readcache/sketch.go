@@ -0,0 +1,82 @@
+package readcache
+
+import "hash/maphash"
+
+const (
+	sketchDepth = 4
+	maxCount    = 15
+
+	// sketchEntrySize is the smallest expected fragment, it sizes the sketch by the cache size.
+	sketchEntrySize = 4 << 10
+	minSketchWidth  = 1 << 10
+	maxSketchWidth  = 1 << 20
+)
+
+// sketch is a count-min sketch of key frequencies. Counters are halved periodically,
+// so the popularity of fragments which are no longer requested fades.
+type sketch struct {
+	seed    maphash.Seed
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	added   int
+	resetAt int
+}
+
+func newSketch(cacheSize int64) *sketch {
+	width := minSketchWidth
+	for width < maxSketchWidth && int64(width) < cacheSize/sketchEntrySize {
+		width <<= 1
+	}
+
+	s := &sketch{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: 10 * width,
+	}
+
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+func (s *sketch) increment(key Key) {
+	h1, h2 := s.hash(key)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+		}
+	}
+
+	if s.added++; s.added >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key Key) uint8 {
+	h1, h2 := s.hash(key)
+	est := uint8(maxCount)
+	for i := range s.rows {
+		est = min(est, s.rows[i][(h1+uint64(i)*h2)&s.mask])
+	}
+
+	return est
+}
+
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+
+	s.added /= 2
+}
+
+func (s *sketch) hash(key Key) (uint64, uint64) {
+	h := maphash.String(s.seed, key.String())
+
+	return h, h>>32 | h<<32 | 1
+}
@@ -0,0 +1,525 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	fss "github.com/Tsapen/fss/internal/fss"
+)
+
+// Config contains settings for db.
+type Config struct {
+	Path string
+}
+
+// DB contains db connection.
+type DB struct {
+	*sqlx.DB
+}
+
+func (c *Config) dbAddr() string {
+	return fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite", c.Path)
+}
+
+// New creates new storage.
+func New(c Config) (*DB, error) {
+	dbAddr := c.dbAddr()
+	db, err := sqlx.Open("sqlite", dbAddr)
+	if err != nil {
+		return nil, fmt.Errorf("open connection %s: %w", dbAddr, err)
+	}
+
+	// SQLite allows one writer at a time, a single connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		return nil, fmt.Errorf("ping with connection %s: %w", dbAddr, err)
+	}
+
+	return &DB{
+		db,
+	}, nil
+}
+
+// CreateFile creates file in system.
+func (s *DB) CreateFile(ctx context.Context, filename, placement string) (int64, error) {
+	query :=
+		`INSERT INTO files (name, last_server_id, last_committed_at, placement, bucket)
+			VALUES (?, (SELECT id FROM servers ORDER BY id DESC LIMIT 1), CURRENT_TIMESTAMP, ?, ?)
+			RETURNING last_server_id
+	`
+	var lastServerID int64
+	err := s.QueryRowContext(ctx, query, filename, placement, fss.Bucket(filename)).Scan(&lastServerID)
+	if isConstraintViolation(err) {
+		return 0, fss.NewConflictError("file exists: %w", err)
+	}
+	if err != nil {
+		return 0, fss.NewInternalError("insert file: %w", err)
+	}
+
+	return lastServerID, nil
+}
+
+// File gets a file by name.
+func (s *DB) File(ctx context.Context, name string) (*fss.File, error) {
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files f WHERE name=?`
+	file := new(fss.File)
+	err := s.GetContext(ctx, file, q, name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fss.NewNotFoundError("file not found: %w", err)
+
+	case err != nil:
+		return nil, fss.NewInternalError("select file: %w", err)
+
+	default:
+		return file, nil
+	}
+}
+
+// UpdateFile updates a file.
+func (s *DB) UpdateFile(ctx context.Context, f *fss.File) (err error) {
+	tx, err := s.BeginTxx(ctx, nil)
+	if err != nil {
+		return fss.NewInternalError("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fss.HandleErrPair(tx.Rollback(), err)
+		}
+	}()
+
+	params := []any{f.LastCommittedAt, f.Fragments, f.ETag, f.Size, f.Version, f.UploadVersion, f.UploadSize, f.UploadCommittedAt, f.Name}
+	q := `UPDATE files SET last_committed_at = ?, fragments = ?, etag = ?, size = ?,
+		version = ?, upload_version = ?, upload_size = ?, upload_committed_at = ? WHERE name = ?`
+
+	result, err := tx.ExecContext(ctx, q, params...)
+	if err != nil {
+		return fss.NewInternalError("update file: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("file with name '%s' not found", f.Name)
+	}
+
+	// Placement of versions which are neither committed nor uploaded is dropped.
+	q = `DELETE FROM fragments WHERE file_name = ? AND version <> ? AND version IS NOT ?`
+	if _, err = tx.ExecContext(ctx, q, f.Name, f.Version, f.UploadVersion); err != nil {
+		return fss.NewInternalError("delete fragments of replaced versions: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fss.NewInternalError("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFile deletes file by name.
+func (s *DB) DeleteFile(ctx context.Context, name string) error {
+	q := `DELETE FROM files WHERE name = ?`
+	result, err := s.ExecContext(ctx, q, name)
+	if err != nil {
+		return fss.NewInternalError("remove file: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("file '%s' not found ", name)
+	}
+
+	return nil
+}
+
+// StaleFiles gets uncommitted files and files with uploads of new versions which were not touched since committedBefore.
+func (s *DB) StaleFiles(ctx context.Context, committedBefore time.Time, limit int) ([]fss.File, error) {
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files
+		WHERE fragments IS NULL AND julianday(last_committed_at) < julianday(?) OR julianday(upload_committed_at) < julianday(?)
+		ORDER BY julianday(COALESCE(upload_committed_at, last_committed_at)) LIMIT ?`
+
+	// Times are compared as julian days since stored strings may have different time zones.
+	var files []fss.File
+	if err := s.SelectContext(ctx, &files, q, committedBefore, committedBefore, limit); err != nil {
+		return nil, fss.NewInternalError("select stale files: %w", err)
+	}
+
+	return files, nil
+}
+
+// Files gets files which names start with prefix and follow after ordered by name.
+func (s *DB) Files(ctx context.Context, prefix, after string, limit int) ([]fss.File, error) {
+	q := `SELECT name, last_server_id, last_committed_at, fragments, placement, etag, size,
+		version, upload_version, upload_size, upload_committed_at FROM files
+		WHERE substr(name, 1, length(?)) = ? AND name > ? ORDER BY name LIMIT ?`
+
+	var files []fss.File
+	if err := s.SelectContext(ctx, &files, q, prefix, prefix, after, limit); err != nil {
+		return nil, fss.NewInternalError("select files: %w", err)
+	}
+
+	return files, nil
+}
+
+// BucketUsage sums sizes of files of the bucket, running uploads included.
+func (s *DB) BucketUsage(ctx context.Context, bucket string) (*fss.Usage, error) {
+	q := `SELECT COUNT(*) AS files, COALESCE(SUM(CASE WHEN upload_version IS NULL THEN size ELSE upload_size END), 0) AS bytes FROM files WHERE bucket = ?`
+	usage := &fss.Usage{Bucket: bucket}
+	if err := s.GetContext(ctx, usage, q, bucket); err != nil {
+		return nil, fss.NewInternalError("select bucket usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Usage sums sizes of files by bucket, running uploads included.
+func (s *DB) Usage(ctx context.Context) ([]fss.Usage, error) {
+	q := `SELECT bucket, COUNT(*) AS files, COALESCE(SUM(CASE WHEN upload_version IS NULL THEN size ELSE upload_size END), 0) AS bytes FROM files GROUP BY bucket ORDER BY bucket`
+
+	var usage []fss.Usage
+	if err := s.SelectContext(ctx, &usage, q); err != nil {
+		return nil, fss.NewInternalError("select usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Servers gets servers by last server id.
+func (s *DB) Servers(ctx context.Context, lastServerID int64) ([]fss.Server, error) {
+	q := "SELECT s.id, s.url, s.capacity, s.weight, s.zone, s.mode FROM servers s WHERE s.id <= ? ORDER BY id"
+	rows, err := s.QueryxContext(ctx, q, lastServerID)
+	if err != nil {
+		return nil, fss.NewInternalError("select servers: %w", err)
+	}
+
+	var servers []fss.Server
+	if err = sqlx.StructScan(rows, &servers); err != nil {
+		return nil, fss.NewInternalError("copy data into struct: %w", err)
+	}
+
+	return servers, nil
+}
+
+// CreateServer creates server in system.
+func (s *DB) CreateServer(ctx context.Context, server fss.Server) error {
+	query := "INSERT INTO servers (url, capacity, weight, zone, mode) VALUES (?, ?, ?, ?, ?)"
+	_, err := s.DB.ExecContext(ctx, query, server.URL, server.Capacity, server.Weight, server.Zone, server.Mode)
+	if isConstraintViolation(err) {
+		return fss.NewConflictError("insert server: %w", err)
+	}
+
+	if err != nil {
+		return fss.NewInternalError("insert server: %w", err)
+	}
+
+	return nil
+}
+
+// Server gets a server by id.
+func (s *DB) Server(ctx context.Context, id int64) (*fss.Server, error) {
+	q := "SELECT s.id, s.url, s.capacity, s.weight, s.zone, s.mode FROM servers s WHERE s.id = ?"
+	server := new(fss.Server)
+	err := s.GetContext(ctx, server, q, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fss.NewNotFoundError("server %d not found", id)
+
+	case err != nil:
+		return nil, fss.NewInternalError("select server: %w", err)
+
+	default:
+		return server, nil
+	}
+}
+
+// UpdateServer updates url, labels and mode of a server.
+func (s *DB) UpdateServer(ctx context.Context, server fss.Server) error {
+	q := `UPDATE servers SET url = ?, capacity = ?, weight = ?, zone = ?, mode = ? WHERE id = ?`
+	result, err := s.DB.ExecContext(ctx, q, server.URL, server.Capacity, server.Weight, server.Zone, server.Mode, server.ID)
+	if isConstraintViolation(err) {
+		return fss.NewConflictError("update server: %w", err)
+	}
+	if err != nil {
+		return fss.NewInternalError("update server: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("server %d not found", server.ID)
+	}
+
+	return nil
+}
+
+// DeleteServer deletes a server which keeps no fragments.
+func (s *DB) DeleteServer(ctx context.Context, id int64) error {
+	q := `DELETE FROM servers WHERE id = ?`
+	result, err := s.ExecContext(ctx, q, id)
+	if isForeignKeyViolation(err) {
+		return fss.NewConflictError("server %d keeps fragments: %w", id, err)
+	}
+	if err != nil {
+		return fss.NewInternalError("remove server: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewNotFoundError("server %d not found", id)
+	}
+
+	return nil
+}
+
+// CreateFragments stores placement of fragments, existing fragments are replaced.
+func (s *DB) CreateFragments(ctx context.Context, fragments []fss.Fragment) (err error) {
+	tx, err := s.BeginTxx(ctx, nil)
+	if err != nil {
+		return fss.NewInternalError("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fss.HandleErrPair(tx.Rollback(), err)
+		}
+	}()
+
+	q := `INSERT INTO fragments (file_name, version, idx, server_id, size, checksum, state)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (file_name, version, idx) DO UPDATE
+		SET server_id = excluded.server_id, size = excluded.size, checksum = excluded.checksum, state = excluded.state`
+	for _, f := range fragments {
+		_, err = tx.ExecContext(ctx, q, f.FileName, f.Version, f.Index, f.ServerID, f.Size, f.Checksum, f.State)
+		if isForeignKeyViolation(err) {
+			return fss.NewNotFoundError("file '%s' not found: %w", f.FileName, err)
+		}
+		if err != nil {
+			return fss.NewInternalError("insert fragment: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fss.NewInternalError("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Fragments gets fragments of the committed version of the file ordered by index.
+func (s *DB) Fragments(ctx context.Context, filename string) ([]fss.Fragment, error) {
+	q := `SELECT fr.file_name, fr.version, fr.idx, fr.server_id, s.url, s.mode, fr.size, fr.checksum, fr.state
+		FROM fragments fr JOIN servers s ON s.id = fr.server_id
+		JOIN files f ON f.name = fr.file_name AND f.version = fr.version
+		WHERE fr.file_name = ? ORDER BY fr.idx`
+
+	var fragments []fss.Fragment
+	if err := s.SelectContext(ctx, &fragments, q, filename); err != nil {
+		return nil, fss.NewInternalError("select fragments: %w", err)
+	}
+
+	return fragments, nil
+}
+
+// AcquireLease takes or prolongs the lease, expired leases are taken over.
+func (s *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) error {
+	q := `INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?`
+
+	// Expiration is kept in unix milliseconds to compare it as a number.
+	now := time.Now()
+	result, err := s.DB.ExecContext(ctx, q, name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return fss.NewInternalError("upsert lease: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fss.NewInternalError("get the number of affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fss.NewConflictError("lease '%s' is held", name)
+	}
+
+	return nil
+}
+
+// ReleaseLease removes the lease if it is held by the holder.
+func (s *DB) ReleaseLease(ctx context.Context, name, holder string) error {
+	q := "DELETE FROM leases WHERE name = ? AND holder = ?"
+	if _, err := s.DB.ExecContext(ctx, q, name, holder); err != nil {
+		return fss.NewInternalError("delete lease: %w", err)
+	}
+
+	return nil
+}
+
+// SaveJob creates or replaces the job.
+func (s *DB) SaveJob(ctx context.Context, job fss.Job) error {
+	row, err := newJobRow(job)
+	if err != nil {
+		return fss.NewInternalError("convert job: %w", err)
+	}
+
+	q := `INSERT INTO jobs (id, kind, state, started_at, finished_at, total, done, failed, issues, error)
+		VALUES (:id, :kind, :state, :started_at, :finished_at, :total, :done, :failed, :issues, :error)
+		ON CONFLICT (id) DO UPDATE SET state = excluded.state, finished_at = excluded.finished_at,
+			total = excluded.total, done = excluded.done, failed = excluded.failed, issues = excluded.issues, error = excluded.error`
+
+	if _, err := s.NamedExecContext(ctx, q, row); err != nil {
+		return fss.NewInternalError("upsert job: %w", err)
+	}
+
+	return nil
+}
+
+// Job gets a job by id.
+func (s *DB) Job(ctx context.Context, id string) (*fss.Job, error) {
+	q := `SELECT id, kind, state, started_at, finished_at, total, done, failed, issues, error FROM jobs WHERE id = ?`
+
+	var row jobRow
+	err := s.GetContext(ctx, &row, q, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fss.NewNotFoundError("job '%s' not found", id)
+
+	case err != nil:
+		return nil, fss.NewInternalError("select job: %w", err)
+	}
+
+	job, err := row.job()
+	if err != nil {
+		return nil, fss.NewInternalError("convert job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Jobs gets the latest jobs ordered by start time.
+func (s *DB) Jobs(ctx context.Context, limit int) ([]fss.Job, error) {
+	q := `SELECT * FROM (
+			SELECT id, kind, state, started_at, finished_at, total, done, failed, issues, error
+			FROM jobs ORDER BY started_at DESC LIMIT ?
+		) j ORDER BY started_at`
+
+	var rows []jobRow
+	if err := s.SelectContext(ctx, &rows, q, limit); err != nil {
+		return nil, fss.NewInternalError("select jobs: %w", err)
+	}
+
+	jobs := make([]fss.Job, 0, len(rows))
+	for _, row := range rows {
+		job, err := row.job()
+		if err != nil {
+			return nil, fss.NewInternalError("convert job '%s': %w", row.ID, err)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// jobRow is a job as it is kept in the db, issues are encoded as a JSON array.
+type jobRow struct {
+	ID         string     `db:"id"`
+	Kind       string     `db:"kind"`
+	State      string     `db:"state"`
+	StartedAt  time.Time  `db:"started_at"`
+	FinishedAt *time.Time `db:"finished_at"`
+	Total      int64      `db:"total"`
+	Done       int64      `db:"done"`
+	Failed     int64      `db:"failed"`
+	Issues     string     `db:"issues"`
+	Error      string     `db:"error"`
+}
+
+// newJobRow keeps times in UTC, so jobs are ordered regardless of the zone of the replica.
+func newJobRow(job fss.Job) (jobRow, error) {
+	issues, err := json.Marshal(append([]string{}, job.Issues...))
+	if err != nil {
+		return jobRow{}, fmt.Errorf("encode issues: %w", err)
+	}
+
+	row := jobRow{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		State:     job.State,
+		StartedAt: job.StartedAt.UTC(),
+		Total:     job.Total,
+		Done:      job.Done,
+		Failed:    job.Failed,
+		Issues:    string(issues),
+		Error:     job.Error,
+	}
+
+	if job.FinishedAt != nil {
+		finishedAt := job.FinishedAt.UTC()
+		row.FinishedAt = &finishedAt
+	}
+
+	return row, nil
+}
+
+func (r jobRow) job() (fss.Job, error) {
+	job := fss.Job{
+		ID:         r.ID,
+		Kind:       r.Kind,
+		State:      r.State,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Total:      r.Total,
+		Done:       r.Done,
+		Failed:     r.Failed,
+		Error:      r.Error,
+	}
+
+	if err := json.Unmarshal([]byte(r.Issues), &job.Issues); err != nil {
+		return fss.Job{}, fmt.Errorf("decode issues: %w", err)
+	}
+
+	if len(job.Issues) == 0 {
+		job.Issues = nil
+	}
+
+	return job, nil
+}
+
+func isConstraintViolation(err error) bool {
+	sqliteErr := new(sqlite.Error)
+
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+func isForeignKeyViolation(err error) bool {
+	sqliteErr := new(sqlite.Error)
+
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
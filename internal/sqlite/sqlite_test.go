@@ -0,0 +1,28 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/migrator"
+	"github.com/Tsapen/fss/internal/sqlite"
+	"github.com/Tsapen/fss/internal/storagetest"
+)
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) dm.Storage {
+		db, err := sqlite.New(sqlite.Config{Path: filepath.Join(t.TempDir(), "fss.db")})
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+
+		t.Cleanup(func() { db.Close() })
+
+		if err = migrator.ApplyMigrations(migrator.DriverSQLite, "../../migrations/sqlite", db.DB.DB); err != nil {
+			t.Fatalf("apply migrations: %v", err)
+		}
+
+		return db
+	})
+}
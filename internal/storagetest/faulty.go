@@ -0,0 +1,231 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// FaultyStorage wraps dm.Storage and returns injected errors instead of calling it.
+type FaultyStorage struct {
+	dm.Storage
+
+	mu     sync.Mutex
+	faults map[string]fault
+}
+
+type fault struct {
+	err   error
+	after int
+}
+
+// NewFaultyStorage wraps the storage.
+func NewFaultyStorage(s dm.Storage) *FaultyStorage {
+	return &FaultyStorage{
+		Storage: s,
+		faults:  make(map[string]fault),
+	}
+}
+
+// Fail makes every call of the method return err.
+func (f *FaultyStorage) Fail(method string, err error) {
+	f.FailAfter(method, 0, err)
+}
+
+// FailAfter lets n calls of the method pass and makes the following ones return err.
+func (f *FaultyStorage) FailAfter(method string, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults[method] = fault{err: err, after: n}
+}
+
+// Heal removes the fault of the method.
+func (f *FaultyStorage) Heal(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.faults, method)
+}
+
+func (f *FaultyStorage) fault(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	flt, ok := f.faults[method]
+	if !ok {
+		return nil
+	}
+
+	if flt.after > 0 {
+		flt.after--
+		f.faults[method] = flt
+
+		return nil
+	}
+
+	return flt.err
+}
+
+func (f *FaultyStorage) CreateFile(ctx context.Context, filename, placement string) (int64, error) {
+	if err := f.fault("CreateFile"); err != nil {
+		return 0, err
+	}
+
+	return f.Storage.CreateFile(ctx, filename, placement)
+}
+
+func (f *FaultyStorage) File(ctx context.Context, name string) (*fss.File, error) {
+	if err := f.fault("File"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.File(ctx, name)
+}
+
+func (f *FaultyStorage) UpdateFile(ctx context.Context, file *fss.File) error {
+	if err := f.fault("UpdateFile"); err != nil {
+		return err
+	}
+
+	return f.Storage.UpdateFile(ctx, file)
+}
+
+func (f *FaultyStorage) DeleteFile(ctx context.Context, name string) error {
+	if err := f.fault("DeleteFile"); err != nil {
+		return err
+	}
+
+	return f.Storage.DeleteFile(ctx, name)
+}
+
+func (f *FaultyStorage) StaleFiles(ctx context.Context, committedBefore time.Time, limit int) ([]fss.File, error) {
+	if err := f.fault("StaleFiles"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.StaleFiles(ctx, committedBefore, limit)
+}
+
+func (f *FaultyStorage) Files(ctx context.Context, prefix, after string, limit int) ([]fss.File, error) {
+	if err := f.fault("Files"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Files(ctx, prefix, after, limit)
+}
+
+func (f *FaultyStorage) BucketUsage(ctx context.Context, bucket string) (*fss.Usage, error) {
+	if err := f.fault("BucketUsage"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.BucketUsage(ctx, bucket)
+}
+
+func (f *FaultyStorage) Usage(ctx context.Context) ([]fss.Usage, error) {
+	if err := f.fault("Usage"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Usage(ctx)
+}
+
+func (f *FaultyStorage) Servers(ctx context.Context, last int64) ([]fss.Server, error) {
+	if err := f.fault("Servers"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Servers(ctx, last)
+}
+
+func (f *FaultyStorage) CreateServer(ctx context.Context, server fss.Server) error {
+	if err := f.fault("CreateServer"); err != nil {
+		return err
+	}
+
+	return f.Storage.CreateServer(ctx, server)
+}
+
+func (f *FaultyStorage) Server(ctx context.Context, id int64) (*fss.Server, error) {
+	if err := f.fault("Server"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Server(ctx, id)
+}
+
+func (f *FaultyStorage) UpdateServer(ctx context.Context, server fss.Server) error {
+	if err := f.fault("UpdateServer"); err != nil {
+		return err
+	}
+
+	return f.Storage.UpdateServer(ctx, server)
+}
+
+func (f *FaultyStorage) DeleteServer(ctx context.Context, id int64) error {
+	if err := f.fault("DeleteServer"); err != nil {
+		return err
+	}
+
+	return f.Storage.DeleteServer(ctx, id)
+}
+
+func (f *FaultyStorage) CreateFragments(ctx context.Context, fragments []fss.Fragment) error {
+	if err := f.fault("CreateFragments"); err != nil {
+		return err
+	}
+
+	return f.Storage.CreateFragments(ctx, fragments)
+}
+
+func (f *FaultyStorage) Fragments(ctx context.Context, filename string) ([]fss.Fragment, error) {
+	if err := f.fault("Fragments"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Fragments(ctx, filename)
+}
+
+func (f *FaultyStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) error {
+	if err := f.fault("AcquireLease"); err != nil {
+		return err
+	}
+
+	return f.Storage.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (f *FaultyStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	if err := f.fault("ReleaseLease"); err != nil {
+		return err
+	}
+
+	return f.Storage.ReleaseLease(ctx, name, holder)
+}
+
+func (f *FaultyStorage) SaveJob(ctx context.Context, job fss.Job) error {
+	if err := f.fault("SaveJob"); err != nil {
+		return err
+	}
+
+	return f.Storage.SaveJob(ctx, job)
+}
+
+func (f *FaultyStorage) Job(ctx context.Context, id string) (*fss.Job, error) {
+	if err := f.fault("Job"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Job(ctx, id)
+}
+
+func (f *FaultyStorage) Jobs(ctx context.Context, limit int) ([]fss.Job, error) {
+	if err := f.fault("Jobs"); err != nil {
+		return nil, err
+	}
+
+	return f.Storage.Jobs(ctx, limit)
+}
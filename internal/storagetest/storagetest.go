@@ -0,0 +1,538 @@
+// Package storagetest contains the conformance suite for dm.Storage implementations.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Run checks that storages produced by newStorage follow the dm.Storage contract.
+// Every subtest gets a new empty storage.
+func Run(t *testing.T, newStorage func(t *testing.T) dm.Storage) {
+	tests := []struct {
+		name string
+		test func(ctx context.Context, t *testing.T, s dm.Storage)
+	}{
+		{name: "servers are ordered and limited by last id", test: testServers},
+		{name: "duplicate server conflicts", test: testDuplicateServer},
+		{name: "server keeps labels", test: testServerLabels},
+		{name: "update server", test: testUpdateServer},
+		{name: "delete server", test: testDeleteServer},
+		{name: "file remembers last server", test: testCreateFile},
+		{name: "duplicate file conflicts", test: testDuplicateFile},
+		{name: "missing file is not found", test: testMissingFile},
+		{name: "update file", test: testUpdateFile},
+		{name: "delete file", test: testDeleteFile},
+		{name: "stale files", test: testStaleFiles},
+		{name: "files are listed by prefix", test: testFiles},
+		{name: "usage is summed by bucket", test: testUsage},
+		{name: "fragments are ordered and replaced", test: testFragments},
+		{name: "fragments of missing file", test: testMissingFileFragments},
+		{name: "delete file removes fragments", test: testDeleteFileFragments},
+		{name: "fragments of versions", test: testFragmentVersions},
+		{name: "lease is held by one holder", test: testLease},
+		{name: "expired lease is taken over", test: testExpiredLease},
+		{name: "jobs are saved and listed", test: testJobs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(context.Background(), t, newStorage(t))
+		})
+	}
+}
+
+func createServers(ctx context.Context, t *testing.T, s dm.Storage, uris ...string) []fss.Server {
+	for _, uri := range uris {
+		if err := s.CreateServer(ctx, fss.Server{URL: uri, Weight: 1, Mode: fss.ServerModeActive}); err != nil {
+			t.Fatalf("create server '%s': %v", uri, err)
+		}
+	}
+
+	servers, err := s.Servers(ctx, 1<<62)
+	if err != nil {
+		t.Fatalf("get servers: %v", err)
+	}
+
+	return servers
+}
+
+func testServers(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers, err := s.Servers(ctx, 1<<62)
+	assert.NoError(t, err)
+	assert.Empty(t, servers)
+
+	servers = createServers(ctx, t, s, "http://fs-1", "http://fs-2", "http://fs-3")
+	if !assert.Len(t, servers, 3) {
+		return
+	}
+
+	for i, uri := range []string{"http://fs-1", "http://fs-2", "http://fs-3"} {
+		assert.Equal(t, uri, servers[i].URL)
+		if i > 0 {
+			assert.Less(t, servers[i-1].ID, servers[i].ID)
+		}
+	}
+
+	limited, err := s.Servers(ctx, servers[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, servers[:2], limited)
+
+	none, err := s.Servers(ctx, servers[0].ID-1)
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testDuplicateServer(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	assert.ErrorAs(t, s.CreateServer(ctx, fss.Server{URL: "http://fs-1", Weight: 1}), &fss.ConflictError{})
+}
+
+func testServerLabels(ctx context.Context, t *testing.T, s dm.Storage) {
+	want := fss.Server{URL: "http://fs-1", Capacity: 1 << 40, Weight: 3, Zone: "rack-1", Mode: fss.ServerModeActive}
+	assert.NoError(t, s.CreateServer(ctx, want))
+
+	servers, err := s.Servers(ctx, 1<<62)
+	if assert.NoError(t, err) && assert.Len(t, servers, 1) {
+		want.ID = servers[0].ID
+		assert.Equal(t, want, servers[0])
+	}
+}
+
+func testUpdateServer(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1", "http://fs-2")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateFragments(ctx, []fss.Fragment{newFragment("file", 0, servers[0], "a")}))
+
+	updated := fss.Server{ID: servers[0].ID, URL: "http://fs-moved", Capacity: 10, Weight: 2, Zone: "rack-1", Mode: fss.ServerModeReadOnly}
+	assert.NoError(t, s.UpdateServer(ctx, updated))
+
+	server, err := s.Server(ctx, servers[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, updated, *server)
+	}
+
+	fragments, err := s.Fragments(ctx, "file")
+	if assert.NoError(t, err) && assert.Len(t, fragments, 1) {
+		assert.Equal(t, "http://fs-moved", fragments[0].ServerURL)
+		assert.Equal(t, fss.ServerModeReadOnly, fragments[0].ServerMode)
+	}
+
+	updated.URL = "http://fs-2"
+	assert.ErrorAs(t, s.UpdateServer(ctx, updated), &fss.ConflictError{})
+
+	updated.ID = servers[1].ID + 1
+	updated.URL = "http://fs-3"
+	assert.ErrorAs(t, s.UpdateServer(ctx, updated), &fss.NotFoundError{})
+
+	_, err = s.Server(ctx, updated.ID)
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+}
+
+func testDeleteServer(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1", "http://fs-2")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateFragments(ctx, []fss.Fragment{newFragment("file", 0, servers[0], "a")}))
+
+	assert.ErrorAs(t, s.DeleteServer(ctx, servers[0].ID), &fss.ConflictError{})
+	assert.NoError(t, s.DeleteServer(ctx, servers[1].ID))
+	assert.ErrorAs(t, s.DeleteServer(ctx, servers[1].ID), &fss.NotFoundError{})
+
+	left, err := s.Servers(ctx, 1<<62)
+	assert.NoError(t, err)
+	assert.Equal(t, servers[:1], left)
+}
+
+func testCreateFile(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1", "http://fs-2")
+
+	lastServerID, err := s.CreateFile(ctx, "file", dm.PlacementRendezvous)
+	assert.NoError(t, err)
+	assert.Equal(t, servers[1].ID, lastServerID)
+
+	createServers(ctx, t, s, "http://fs-3")
+
+	f, err := s.File(ctx, "file")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "file", f.Name)
+	assert.Equal(t, servers[1].ID, f.LastServerID)
+	assert.Equal(t, dm.PlacementRendezvous, f.Placement)
+	assert.Nil(t, f.Fragments)
+	if assert.NotNil(t, f.LastCommittedAt) {
+		assert.WithinDuration(t, time.Now(), *f.LastCommittedAt, time.Minute)
+	}
+}
+
+func testDuplicateFile(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	_, err = s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.ErrorAs(t, err, &fss.ConflictError{})
+}
+
+func testMissingFile(ctx context.Context, t *testing.T, s dm.Storage) {
+	_, err := s.File(ctx, "missing")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	fragments := 1
+	assert.ErrorAs(t, s.UpdateFile(ctx, &fss.File{Name: "missing", Fragments: &fragments}), &fss.NotFoundError{})
+	assert.ErrorAs(t, s.DeleteFile(ctx, "missing"), &fss.NotFoundError{})
+}
+
+func testUpdateFile(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	committedAt := time.Now().Add(time.Minute)
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "file", LastCommittedAt: &committedAt}))
+
+	f, err := s.File(ctx, "file")
+	if assert.NoError(t, err) && assert.NotNil(t, f.LastCommittedAt) {
+		assert.WithinDuration(t, committedAt, *f.LastCommittedAt, time.Second)
+		assert.Nil(t, f.Fragments)
+		assert.Nil(t, f.ETag)
+		assert.Nil(t, f.Size)
+	}
+
+	fragments, etag, size := 7, "etag", int64(42)
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "file", Fragments: &fragments, ETag: &etag, Size: &size}))
+
+	f, err = s.File(ctx, "file")
+	if assert.NoError(t, err) && assert.NotNil(t, f.Fragments) {
+		assert.Equal(t, fragments, *f.Fragments)
+		assert.Equal(t, &etag, f.ETag)
+		assert.Equal(t, &size, f.Size)
+		assert.Nil(t, f.LastCommittedAt)
+	}
+}
+
+func testStaleFiles(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	for _, name := range []string{"stale_1", "stale_2", "fresh", "committed"} {
+		_, err := s.CreateFile(ctx, name, dm.PlacementRoundRobin)
+		assert.NoError(t, err)
+	}
+
+	now := time.Now()
+	for name, committedAt := range map[string]time.Time{
+		"stale_1": now.Add(-2 * time.Hour),
+		"stale_2": now.Add(-3 * time.Hour),
+		"fresh":   now.Add(time.Hour),
+	} {
+		committedAt := committedAt
+		assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: name, LastCommittedAt: &committedAt}))
+	}
+
+	fragments := 1
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "committed", Fragments: &fragments}))
+
+	// Uploads of new versions are stale by their own batches, commits of the files don't matter.
+	version := int64(1)
+	for name, committedAt := range map[string]time.Time{
+		"replaced_stale": now.Add(-150 * time.Minute),
+		"replaced_fresh": now.Add(time.Hour),
+	} {
+		committedAt, lastCommittedAt := committedAt, now.Add(-4*time.Hour)
+		_, err := s.CreateFile(ctx, name, dm.PlacementRoundRobin)
+		assert.NoError(t, err)
+		assert.NoError(t, s.UpdateFile(ctx, &fss.File{
+			Name:              name,
+			LastCommittedAt:   &lastCommittedAt,
+			Fragments:         &fragments,
+			UploadVersion:     &version,
+			UploadCommittedAt: &committedAt,
+		}))
+	}
+
+	files, err := s.StaleFiles(ctx, now.Add(-time.Hour), 10)
+	if assert.NoError(t, err) && assert.Len(t, files, 3) {
+		assert.Equal(t, "stale_2", files[0].Name)
+		assert.Equal(t, "replaced_stale", files[1].Name)
+		assert.Equal(t, &version, files[1].UploadVersion)
+		assert.Equal(t, "stale_1", files[2].Name)
+	}
+
+	files, err = s.StaleFiles(ctx, now.Add(-time.Hour), 1)
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, "stale_2", files[0].Name)
+	}
+}
+
+func testFiles(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	for _, name := range []string{"b/2", "a/1", "b/1", "b_1", "c"} {
+		_, err := s.CreateFile(ctx, name, dm.PlacementRoundRobin)
+		assert.NoError(t, err)
+	}
+
+	names := func(files []fss.File) []string {
+		res := make([]string, 0, len(files))
+		for _, f := range files {
+			res = append(res, f.Name)
+		}
+
+		return res
+	}
+
+	files, err := s.Files(ctx, "", "", 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a/1", "b/1", "b/2", "b_1", "c"}, names(files))
+	}
+
+	files, err = s.Files(ctx, "b/", "", 10)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"b/1", "b/2"}, names(files))
+	}
+
+	files, err = s.Files(ctx, "b", "b/1", 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"b/2", "b_1"}, names(files))
+	}
+}
+
+func testUsage(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	for name, size := range map[string]int64{"a/1": 10, "a/2": 20, "b/1": 5, "c": 1, "d": -1} {
+		_, err := s.CreateFile(ctx, name, dm.PlacementRoundRobin)
+		assert.NoError(t, err)
+
+		if size >= 0 {
+			size := size
+			assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: name, Size: &size}))
+		}
+	}
+
+	// A file replaced by an upload counts with the bytes of the upload.
+	version, size, uploaded := int64(1), int64(20), int64(4)
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "a/2", Size: &size, UploadVersion: &version, UploadSize: &uploaded}))
+
+	usage, err := s.BucketUsage(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &fss.Usage{Bucket: "a", Files: 2, Bytes: 14}, usage)
+	}
+
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "a/2", Size: &size}))
+
+	usage, err = s.BucketUsage(ctx, "missing")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &fss.Usage{Bucket: "missing"}, usage)
+	}
+
+	all, err := s.Usage(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []fss.Usage{
+			{Bucket: "", Files: 2, Bytes: 1},
+			{Bucket: "a", Files: 2, Bytes: 30},
+			{Bucket: "b", Files: 1, Bytes: 5},
+		}, all)
+	}
+}
+
+func testDeleteFile(ctx context.Context, t *testing.T, s dm.Storage) {
+	createServers(ctx, t, s, "http://fs-1")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.DeleteFile(ctx, "file"))
+
+	_, err = s.File(ctx, "file")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+
+	_, err = s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+}
+
+func newFragment(filename string, idx int, server fss.Server, checksum string) fss.Fragment {
+	size := int64(len(checksum))
+
+	return fss.Fragment{
+		FileName:   filename,
+		Index:      idx,
+		ServerID:   server.ID,
+		ServerURL:  server.URL,
+		ServerMode: server.Mode,
+		Size:       &size,
+		Checksum:   &checksum,
+		State:      fss.FragmentStateStored,
+	}
+}
+
+func testFragments(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1", "http://fs-2")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	fragments, err := s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Empty(t, fragments)
+
+	want := []fss.Fragment{
+		newFragment("file", 0, servers[0], "a"),
+		newFragment("file", 1, servers[1], "b"),
+		newFragment("file", 2, servers[0], "c"),
+	}
+	assert.NoError(t, s.CreateFragments(ctx, []fss.Fragment{want[2], want[0]}))
+	assert.NoError(t, s.CreateFragments(ctx, want[1:2]))
+
+	fragments, err = s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, want, fragments)
+
+	want[2] = newFragment("file", 2, servers[1], "replaced")
+	assert.NoError(t, s.CreateFragments(ctx, want[2:]))
+
+	fragments, err = s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, want, fragments)
+}
+
+func testMissingFileFragments(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1")
+
+	fragments, err := s.Fragments(ctx, "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, fragments)
+
+	err = s.CreateFragments(ctx, []fss.Fragment{newFragment("missing", 0, servers[0], "a")})
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+}
+
+func testDeleteFileFragments(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateFragments(ctx, []fss.Fragment{newFragment("file", 0, servers[0], "a")}))
+
+	assert.NoError(t, s.DeleteFile(ctx, "file"))
+
+	_, err = s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	fragments, err := s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Empty(t, fragments)
+}
+
+func testFragmentVersions(ctx context.Context, t *testing.T, s dm.Storage) {
+	servers := createServers(ctx, t, s, "http://fs-1", "http://fs-2")
+
+	_, err := s.CreateFile(ctx, "file", dm.PlacementRoundRobin)
+	assert.NoError(t, err)
+
+	committed := []fss.Fragment{newFragment("file", 0, servers[0], "a")}
+	assert.NoError(t, s.CreateFragments(ctx, committed))
+
+	fragmentsNum, version := 1, int64(1)
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "file", Fragments: &fragmentsNum, UploadVersion: &version}))
+
+	uploaded := []fss.Fragment{newFragment("file", 0, servers[1], "b"), newFragment("file", 1, servers[0], "c")}
+	for i := range uploaded {
+		uploaded[i].Version = version
+	}
+
+	assert.NoError(t, s.CreateFragments(ctx, uploaded))
+
+	fragments, err := s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, committed, fragments, "the committed version is read while the next one is uploaded")
+
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "file", Fragments: &fragmentsNum, Version: version}))
+
+	fragments, err = s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, uploaded, fragments)
+
+	assert.NoError(t, s.UpdateFile(ctx, &fss.File{Name: "file", Fragments: &fragmentsNum}))
+
+	fragments, err = s.Fragments(ctx, "file")
+	assert.NoError(t, err)
+	assert.Empty(t, fragments, "placement of the replaced version is dropped")
+}
+
+func testLease(ctx context.Context, t *testing.T, s dm.Storage) {
+	assert.NoError(t, s.AcquireLease(ctx, "lease", "a", time.Minute))
+	assert.NoError(t, s.AcquireLease(ctx, "lease", "a", time.Minute))
+	assert.ErrorAs(t, s.AcquireLease(ctx, "lease", "b", time.Minute), &fss.ConflictError{})
+	assert.NoError(t, s.AcquireLease(ctx, "other", "b", time.Minute))
+
+	assert.NoError(t, s.ReleaseLease(ctx, "lease", "b"))
+	assert.ErrorAs(t, s.AcquireLease(ctx, "lease", "b", time.Minute), &fss.ConflictError{})
+
+	assert.NoError(t, s.ReleaseLease(ctx, "lease", "a"))
+	assert.NoError(t, s.AcquireLease(ctx, "lease", "b", time.Minute))
+}
+
+func testExpiredLease(ctx context.Context, t *testing.T, s dm.Storage) {
+	assert.NoError(t, s.AcquireLease(ctx, "lease", "a", -time.Second))
+	assert.NoError(t, s.AcquireLease(ctx, "lease", "b", time.Minute))
+	assert.ErrorAs(t, s.AcquireLease(ctx, "lease", "a", time.Minute), &fss.ConflictError{})
+}
+
+func testJobs(ctx context.Context, t *testing.T, s dm.Storage) {
+	startedAt := time.Now().Truncate(time.Second)
+	for i, id := range []string{"b", "a", "c"} {
+		job := fss.Job{ID: id, Kind: "scrub", State: "running", StartedAt: startedAt.Add(time.Duration(i) * time.Minute)}
+		assert.NoError(t, s.SaveJob(ctx, job))
+	}
+
+	finishedAt := startedAt.Add(time.Hour)
+	finished := fss.Job{
+		ID:         "a",
+		Kind:       "scrub",
+		State:      "failed",
+		StartedAt:  startedAt.Add(time.Minute),
+		FinishedAt: &finishedAt,
+		Total:      3,
+		Done:       2,
+		Failed:     1,
+		Issues:     []string{"fragment 1 is missing"},
+		Error:      "no servers",
+	}
+	assert.NoError(t, s.SaveJob(ctx, finished))
+
+	job, err := s.Job(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, finished.StartedAt, job.StartedAt, 0)
+		if assert.NotNil(t, job.FinishedAt) {
+			assert.WithinDuration(t, finishedAt, *job.FinishedAt, 0)
+		}
+
+		job.StartedAt, job.FinishedAt = finished.StartedAt, finished.FinishedAt
+		assert.Equal(t, finished, *job)
+	}
+
+	jobs, err := s.Jobs(ctx, 2)
+	if assert.NoError(t, err) && assert.Len(t, jobs, 2) {
+		assert.Equal(t, "a", jobs[0].ID)
+		assert.Equal(t, "c", jobs[1].ID)
+		assert.Nil(t, jobs[1].Issues)
+	}
+
+	_, err = s.Job(ctx, "unknown")
+	assert.ErrorAs(t, err, &fss.NotFoundError{})
+}
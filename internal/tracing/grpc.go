@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// metadataCarrier adapts grpc metadata to the propagator.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// outgoing adds trace context and request id of ctx to the outgoing metadata.
+func outgoing(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	if reqID := fss.ReqIDFromCtx(ctx); reqID != "" {
+		md.Set(fss.RequestIDHeader, reqID)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// incoming continues the trace of the caller and starts a server span of the method.
+func incoming(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	if values := md.Get(fss.RequestIDHeader); len(values) > 0 {
+		ctx = fss.WithReqID(ctx, values[0])
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, strings.TrimPrefix(method, "/"), trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// UnaryClientInterceptor propagates trace context to the file server.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor propagates trace context to the file server.
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoing(ctx), desc, cc, method, opts...)
+}
+
+// UnaryServerInterceptor runs the call in a span which continues the trace of the caller.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
+	ctx, span := incoming(ctx, info.FullMethod)
+	defer func() { End(span, err) }()
+
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor runs the stream in a span which continues the trace of the caller.
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, span := incoming(ss.Context(), info.FullMethod)
+	defer func() { End(span, err) }()
+
+	return handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	dm "github.com/Tsapen/fss/internal/download-manager"
+	"github.com/Tsapen/fss/internal/fss"
+)
+
+// Storage runs every query of the wrapped metadata storage in a client span.
+type Storage struct {
+	storage dm.Storage
+	driver  string
+}
+
+var _ dm.Storage = (*Storage)(nil)
+
+// TraceStorage wraps the storage of the driver.
+func TraceStorage(driver string, storage dm.Storage) *Storage {
+	return &Storage{
+		storage: storage,
+		driver:  driver,
+	}
+}
+
+func (s *Storage) CreateFile(ctx context.Context, filename, placement string) (_ int64, err error) {
+	ctx, span := s.start(ctx, "CreateFile")
+	defer func() { End(span, err) }()
+
+	return s.storage.CreateFile(ctx, filename, placement)
+}
+
+func (s *Storage) File(ctx context.Context, name string) (_ *fss.File, err error) {
+	ctx, span := s.start(ctx, "File")
+	defer func() { End(span, err) }()
+
+	return s.storage.File(ctx, name)
+}
+
+func (s *Storage) UpdateFile(ctx context.Context, f *fss.File) (err error) {
+	ctx, span := s.start(ctx, "UpdateFile")
+	defer func() { End(span, err) }()
+
+	return s.storage.UpdateFile(ctx, f)
+}
+
+func (s *Storage) DeleteFile(ctx context.Context, name string) (err error) {
+	ctx, span := s.start(ctx, "DeleteFile")
+	defer func() { End(span, err) }()
+
+	return s.storage.DeleteFile(ctx, name)
+}
+
+func (s *Storage) StaleFiles(ctx context.Context, committedBefore time.Time, limit int) (_ []fss.File, err error) {
+	ctx, span := s.start(ctx, "StaleFiles")
+	defer func() { End(span, err) }()
+
+	return s.storage.StaleFiles(ctx, committedBefore, limit)
+}
+
+func (s *Storage) Files(ctx context.Context, prefix, after string, limit int) (_ []fss.File, err error) {
+	ctx, span := s.start(ctx, "Files")
+	defer func() { End(span, err) }()
+
+	return s.storage.Files(ctx, prefix, after, limit)
+}
+
+func (s *Storage) BucketUsage(ctx context.Context, bucket string) (_ *fss.Usage, err error) {
+	ctx, span := s.start(ctx, "BucketUsage")
+	defer func() { End(span, err) }()
+
+	return s.storage.BucketUsage(ctx, bucket)
+}
+
+func (s *Storage) Usage(ctx context.Context) (_ []fss.Usage, err error) {
+	ctx, span := s.start(ctx, "Usage")
+	defer func() { End(span, err) }()
+
+	return s.storage.Usage(ctx)
+}
+
+func (s *Storage) Servers(ctx context.Context, last int64) (_ []fss.Server, err error) {
+	ctx, span := s.start(ctx, "Servers")
+	defer func() { End(span, err) }()
+
+	return s.storage.Servers(ctx, last)
+}
+
+func (s *Storage) CreateServer(ctx context.Context, server fss.Server) (err error) {
+	ctx, span := s.start(ctx, "CreateServer")
+	defer func() { End(span, err) }()
+
+	return s.storage.CreateServer(ctx, server)
+}
+
+func (s *Storage) Server(ctx context.Context, id int64) (_ *fss.Server, err error) {
+	ctx, span := s.start(ctx, "Server")
+	defer func() { End(span, err) }()
+
+	return s.storage.Server(ctx, id)
+}
+
+func (s *Storage) UpdateServer(ctx context.Context, server fss.Server) (err error) {
+	ctx, span := s.start(ctx, "UpdateServer")
+	defer func() { End(span, err) }()
+
+	return s.storage.UpdateServer(ctx, server)
+}
+
+func (s *Storage) DeleteServer(ctx context.Context, id int64) (err error) {
+	ctx, span := s.start(ctx, "DeleteServer")
+	defer func() { End(span, err) }()
+
+	return s.storage.DeleteServer(ctx, id)
+}
+
+func (s *Storage) CreateFragments(ctx context.Context, fragments []fss.Fragment) (err error) {
+	ctx, span := s.start(ctx, "CreateFragments")
+	defer func() { End(span, err) }()
+
+	return s.storage.CreateFragments(ctx, fragments)
+}
+
+func (s *Storage) Fragments(ctx context.Context, filename string) (_ []fss.Fragment, err error) {
+	ctx, span := s.start(ctx, "Fragments")
+	defer func() { End(span, err) }()
+
+	return s.storage.Fragments(ctx, filename)
+}
+
+func (s *Storage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (err error) {
+	ctx, span := s.start(ctx, "AcquireLease")
+	defer func() { End(span, err) }()
+
+	return s.storage.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) (err error) {
+	ctx, span := s.start(ctx, "ReleaseLease")
+	defer func() { End(span, err) }()
+
+	return s.storage.ReleaseLease(ctx, name, holder)
+}
+
+func (s *Storage) SaveJob(ctx context.Context, job fss.Job) (err error) {
+	ctx, span := s.start(ctx, "SaveJob")
+	defer func() { End(span, err) }()
+
+	return s.storage.SaveJob(ctx, job)
+}
+
+func (s *Storage) Job(ctx context.Context, id string) (_ *fss.Job, err error) {
+	ctx, span := s.start(ctx, "Job")
+	defer func() { End(span, err) }()
+
+	return s.storage.Job(ctx, id)
+}
+
+func (s *Storage) Jobs(ctx context.Context, limit int) (_ []fss.Job, err error) {
+	ctx, span := s.start(ctx, "Jobs")
+	defer func() { End(span, err) }()
+
+	return s.storage.Jobs(ctx, limit)
+}
+
+func (s *Storage) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "db "+query,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemKey.String(s.driver), semconv.DBOperation(query)),
+	)
+}
@@ -0,0 +1,108 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Tsapen/fss/internal/fss"
+	"github.com/Tsapen/fss/internal/memstore"
+	"github.com/Tsapen/fss/internal/tracing"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	return recorder
+}
+
+func TestPropagation(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var serverCtx context.Context
+	r := mux.NewRouter()
+	r.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		serverCtx = r.Context()
+	})
+	r.Use(tracing.Middleware)
+
+	ctx, span := tracing.Start(context.Background(), "upload")
+
+	req := httptest.NewRequest(http.MethodGet, "/file?filename=a", nil)
+	tracing.Inject(ctx, req.Header)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+
+	serverSpan := trace.SpanContextFromContext(serverCtx)
+	require.Equal(t, span.SpanContext().TraceID(), serverSpan.TraceID())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "GET /file", spans[0].Name())
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	require.Equal(t, span.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestStorage(t *testing.T) {
+	recorder := recordSpans(t)
+
+	storage := tracing.TraceStorage("memory", memstore.NewStorage())
+	ctx := context.Background()
+
+	require.NoError(t, storage.AcquireLease(ctx, "leader", "a", time.Minute))
+
+	_, err := storage.File(ctx, "b")
+	require.ErrorAs(t, err, &fss.NotFoundError{})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "db AcquireLease", spans[0].Name())
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, "db File", spans[1].Name())
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := tracing.Setup(context.Background(), "fss", tracing.Config{Exporter: tracing.ExporterFile, File: path})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	_, span := tracing.Start(context.Background(), "upload")
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"upload"`)
+
+	_, err = tracing.Setup(context.Background(), "fss", tracing.Config{Exporter: "zipkin"})
+	require.Error(t, err)
+}
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS fragments (
+    file_name VARCHAR(100) NOT NULL REFERENCES files (name) ON DELETE CASCADE,
+    idx INT NOT NULL,
+    server_id INT NOT NULL REFERENCES servers (id),
+    size BIGINT,
+    checksum VARCHAR(64),
+    state VARCHAR(16) NOT NULL DEFAULT 'stored',
+
+    PRIMARY KEY (file_name, idx)
+);
+
+CREATE INDEX IF NOT EXISTS index_fragments_server_id ON fragments (server_id);
+
+-- Backfill placement of committed files with the legacy algorithm: fragments go
+-- round-robin over servers with id <= last_server_id, starting from the server
+-- with position sha256(name)[0] mod number of servers. Sizes and checksums are unknown.
+INSERT INTO fragments (file_name, idx, server_id, state)
+SELECT f.name, g.idx, s.id, 'stored'
+FROM files f
+CROSS JOIN LATERAL generate_series(0, f.fragments - 1) AS g (idx)
+JOIN LATERAL (
+    SELECT id, row_number() OVER (ORDER BY id) - 1 AS pos, count(*) OVER () AS cnt
+    FROM servers
+    WHERE id <= f.last_server_id
+) s ON s.pos = (g.idx + get_byte(sha256(convert_to(f.name, 'UTF8')), 0) % s.cnt) % s.cnt
+WHERE f.fragments IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS capacity BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS weight INT NOT NULL DEFAULT 1;
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS zone VARCHAR(64) NOT NULL DEFAULT '';
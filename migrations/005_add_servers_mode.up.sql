@@ -0,0 +1 @@
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS mode VARCHAR(16) NOT NULL DEFAULT 'active';
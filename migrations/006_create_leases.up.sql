@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS leases (
+    name VARCHAR(512) PRIMARY KEY,
+    holder VARCHAR(256) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
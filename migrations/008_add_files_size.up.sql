@@ -0,0 +1,11 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS size BIGINT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS bucket VARCHAR(100) NOT NULL DEFAULT '';
+
+-- Backfill buckets, the first segment of names, and sizes of committed files from
+-- their fragments. Fragments of legacy files have no recorded sizes and count as empty.
+UPDATE files SET bucket = split_part(name, '/', 1) WHERE strpos(name, '/') > 0;
+
+UPDATE files f SET size = (SELECT COALESCE(SUM(fr.size), 0) FROM fragments fr WHERE fr.file_name = f.name)
+WHERE f.fragments IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS index_files_bucket ON files (bucket);
@@ -0,0 +1,10 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS upload_version BIGINT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS upload_size BIGINT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS upload_committed_at TIMESTAMP;
+
+-- Fragments of a file replaced by a conditional upload are kept until the new
+-- version is committed, so both versions are stored at the same time.
+ALTER TABLE fragments ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE fragments DROP CONSTRAINT IF EXISTS fragments_pkey;
+ALTER TABLE fragments ADD PRIMARY KEY (file_name, version, idx);
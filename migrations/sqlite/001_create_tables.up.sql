@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS files (
+    name TEXT NOT NULL,
+    last_server_id INTEGER NOT NULL,
+    last_committed_at TIMESTAMP,
+    fragments INTEGER,
+
+    CONSTRAINT unique_files_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS servers (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+
+    CONSTRAINT unique_servers_url UNIQUE (url)
+);
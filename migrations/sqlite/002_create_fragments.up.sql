@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS fragments (
+    file_name TEXT NOT NULL REFERENCES files (name) ON DELETE CASCADE,
+    idx INTEGER NOT NULL,
+    server_id INTEGER NOT NULL REFERENCES servers (id),
+    size INTEGER,
+    checksum TEXT,
+    state TEXT NOT NULL DEFAULT 'stored',
+
+    PRIMARY KEY (file_name, idx)
+);
+
+CREATE INDEX IF NOT EXISTS index_fragments_server_id ON fragments (server_id);
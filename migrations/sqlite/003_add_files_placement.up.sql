@@ -0,0 +1 @@
+ALTER TABLE files ADD COLUMN placement TEXT NOT NULL DEFAULT 'round_robin';
@@ -0,0 +1,5 @@
+ALTER TABLE servers ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE servers ADD COLUMN weight INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE servers ADD COLUMN zone TEXT NOT NULL DEFAULT '';
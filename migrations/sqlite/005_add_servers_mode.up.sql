@@ -0,0 +1 @@
+ALTER TABLE servers ADD COLUMN mode TEXT NOT NULL DEFAULT 'active';
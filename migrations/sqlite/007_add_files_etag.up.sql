@@ -0,0 +1 @@
+ALTER TABLE files ADD COLUMN etag TEXT;
@@ -0,0 +1,9 @@
+ALTER TABLE files ADD COLUMN size INTEGER;
+ALTER TABLE files ADD COLUMN bucket TEXT NOT NULL DEFAULT '';
+
+UPDATE files SET bucket = substr(name, 1, instr(name, '/') - 1) WHERE instr(name, '/') > 0;
+
+UPDATE files SET size = (SELECT COALESCE(SUM(fr.size), 0) FROM fragments fr WHERE fr.file_name = files.name)
+WHERE fragments IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS index_files_bucket ON files (bucket);
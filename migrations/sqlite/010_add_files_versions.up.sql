@@ -0,0 +1,26 @@
+ALTER TABLE files ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE files ADD COLUMN upload_version INTEGER;
+ALTER TABLE files ADD COLUMN upload_size INTEGER;
+ALTER TABLE files ADD COLUMN upload_committed_at TIMESTAMP;
+
+-- SQLite can't change a primary key, so the table is rebuilt with the version in the key.
+CREATE TABLE fragments_versioned (
+    file_name TEXT NOT NULL REFERENCES files (name) ON DELETE CASCADE,
+    version INTEGER NOT NULL DEFAULT 0,
+    idx INTEGER NOT NULL,
+    server_id INTEGER NOT NULL REFERENCES servers (id),
+    size INTEGER,
+    checksum TEXT,
+    state TEXT NOT NULL DEFAULT 'stored',
+
+    PRIMARY KEY (file_name, version, idx)
+);
+
+INSERT INTO fragments_versioned (file_name, idx, server_id, size, checksum, state)
+SELECT file_name, idx, server_id, size, checksum, state FROM fragments;
+
+DROP TABLE fragments;
+
+ALTER TABLE fragments_versioned RENAME TO fragments;
+
+CREATE INDEX IF NOT EXISTS index_fragments_server_id ON fragments (server_id);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS fragments;
+
+CREATE TABLE IF NOT EXISTS fragments (
+    file_name VARCHAR(100) NOT NULL REFERENCES files (name) ON DELETE CASCADE,
+    idx INT NOT NULL,
+    server_id INT NOT NULL REFERENCES servers (id),
+    size BIGINT,
+    checksum VARCHAR(64),
+    state VARCHAR(16) NOT NULL DEFAULT 'stored',
+
+    PRIMARY KEY (file_name, idx)
+);
+
+CREATE INDEX IF NOT EXISTS index_fragments_server_id ON fragments (server_id);
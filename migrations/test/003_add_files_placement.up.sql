@@ -0,0 +1 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS placement VARCHAR(32) NOT NULL DEFAULT 'round_robin';
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Server modes.
+const (
+	ServerModeActive   = "active"
+	ServerModeReadOnly = "read_only"
+	ServerModeDisabled = "disabled"
+)
+
+// Job kinds.
+const (
+	JobGC        = "gc"
+	JobScrub     = "scrub"
+	JobRebalance = "rebalance"
+)
+
+// Job states.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Server is a file server registered in the FSS.
+type Server struct {
+	ID       int64        `json:"id"`
+	URL      string       `json:"url"`
+	Capacity int64        `json:"capacity"`
+	Weight   int          `json:"weight"`
+	Zone     string       `json:"zone"`
+	Mode     string       `json:"mode"`
+	Status   string       `json:"status,omitempty"`
+	Usage    *ServerUsage `json:"usage,omitempty"`
+}
+
+// ServerUsage describes usage of a file server storage in bytes.
+type ServerUsage struct {
+	Capacity  int64 `json:"capacity"`
+	Used      int64 `json:"used"`
+	Free      int64 `json:"free"`
+	Fragments int64 `json:"fragments"`
+}
+
+// NewServer contains fields of a registered server.
+type NewServer struct {
+	URL      string `json:"server_url"`
+	Capacity int64  `json:"capacity,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+}
+
+// ServerUpdate contains fields of a server to change, nil fields are kept.
+type ServerUpdate struct {
+	URL      *string `json:"url,omitempty"`
+	Capacity *int64  `json:"capacity,omitempty"`
+	Weight   *int    `json:"weight,omitempty"`
+	Zone     *string `json:"zone,omitempty"`
+	Mode     *string `json:"mode,omitempty"`
+}
+
+// File is metadata of a stored or uploading file.
+type File struct {
+	Name            string     `json:"name"`
+	Committed       bool       `json:"committed"`
+	Fragments       *int       `json:"fragments,omitempty"`
+	ETag            string     `json:"etag,omitempty"`
+	Placement       string     `json:"placement"`
+	LastCommittedAt *time.Time `json:"last_committed_at,omitempty"`
+}
+
+// ListFiles selects a page of files.
+type ListFiles struct {
+	Prefix string
+	// After is the name of the last file of the previous page.
+	After string
+	Limit int
+}
+
+// Fragment is placement of a file fragment with its status on the file server.
+type Fragment struct {
+	Index      int     `json:"index"`
+	ServerID   int64   `json:"server_id"`
+	ServerURL  string  `json:"server_url"`
+	ServerMode string  `json:"server_mode"`
+	Size       *int64  `json:"size,omitempty"`
+	Checksum   *string `json:"checksum,omitempty"`
+	State      string  `json:"state"`
+	Status     string  `json:"status"`
+}
+
+// Job is a maintenance job run by the leader FSS replica.
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	Failed     int64      `json:"failed"`
+	Issues     []string   `json:"issues,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// BucketUsage is the storage taken by files of a bucket with its quotas, 0 means no limit.
+// Files without a bucket in their names are counted in the bucket "".
+type BucketUsage struct {
+	Bucket       string `json:"bucket"`
+	Files        int64  `json:"files"`
+	Bytes        int64  `json:"bytes"`
+	SoftQuota    int64  `json:"soft_quota,omitempty"`
+	HardQuota    int64  `json:"hard_quota,omitempty"`
+	SoftExceeded bool   `json:"soft_exceeded"`
+	HardExceeded bool   `json:"hard_exceeded"`
+}
+
+// Servers returns registered file servers with their status.
+func (c *Client) Servers(ctx context.Context) ([]Server, error) {
+	var servers []Server
+	err := c.doJSON(ctx, http.MethodGet, "/fs-servers", nil, nil, &servers)
+
+	return servers, err
+}
+
+// AddServer registers a file server.
+func (c *Client) AddServer(ctx context.Context, server NewServer) error {
+	return c.doJSON(ctx, http.MethodPost, "/fs-servers", nil, server, nil)
+}
+
+// UpdateServer changes the file server.
+func (c *Client) UpdateServer(ctx context.Context, id int64, upd ServerUpdate) (*Server, error) {
+	server := new(Server)
+	if err := c.doJSON(ctx, http.MethodPatch, "/fs-servers/"+strconv.FormatInt(id, 10), nil, upd, server); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// DisableServer stops reads and writes of the file server.
+func (c *Client) DisableServer(ctx context.Context, id int64) (*Server, error) {
+	mode := ServerModeDisabled
+
+	return c.UpdateServer(ctx, id, ServerUpdate{Mode: &mode})
+}
+
+// Files returns a page of files ordered by name.
+func (c *Client) Files(ctx context.Context, list ListFiles) ([]File, error) {
+	q := url.Values{}
+	if list.Prefix != "" {
+		q.Set("prefix", list.Prefix)
+	}
+
+	if list.After != "" {
+		q.Set("after", list.After)
+	}
+
+	if list.Limit != 0 {
+		q.Set("limit", strconv.Itoa(list.Limit))
+	}
+
+	var files []File
+	err := c.doJSON(ctx, http.MethodGet, "/files", q, nil, &files)
+
+	return files, err
+}
+
+// StatFile returns metadata of the file.
+func (c *Client) StatFile(ctx context.Context, fileName string) (*File, error) {
+	f := new(File)
+	if err := c.doJSON(ctx, http.MethodGet, "/file/stat", url.Values{"filename": {fileName}}, nil, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// FileFragments returns placement of the file fragments and their status.
+func (c *Client) FileFragments(ctx context.Context, fileName string) ([]Fragment, error) {
+	var fragments []Fragment
+	err := c.doJSON(ctx, http.MethodGet, "/file/fragments", url.Values{"filename": {fileName}}, nil, &fragments)
+
+	return fragments, err
+}
+
+// DeleteFile deletes the file.
+func (c *Client) DeleteFile(ctx context.Context, fileName string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/file", url.Values{"filename": {fileName}}, nil, nil)
+}
+
+// StartJob starts a maintenance job of the kind. Replicas which don't lead return the job
+// pending until the leader claims it. A pending or running job of the kind gives ErrConflict.
+func (c *Client) StartJob(ctx context.Context, kind string) (*Job, error) {
+	job := new(Job)
+	if err := c.doJSON(ctx, http.MethodPost, "/jobs", nil, map[string]string{"kind": kind}, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Job returns the job by id.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	job := new(Job)
+	if err := c.doJSON(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Jobs returns jobs of the replica ordered by start time.
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	err := c.doJSON(ctx, http.MethodGet, "/jobs", nil, nil, &jobs)
+
+	return jobs, err
+}
+
+// WatchJob polls the job every interval and calls fn with its progress until the job finishes.
+func (c *Client) WatchJob(ctx context.Context, id string, interval time.Duration, fn func(*Job)) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		fn(job)
+		if job.State != JobPending && job.State != JobRunning {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// Usage returns usage of buckets ordered by bucket.
+func (c *Client) Usage(ctx context.Context) ([]BucketUsage, error) {
+	var usage []BucketUsage
+	err := c.doJSON(ctx, http.MethodGet, "/usage", nil, nil, &usage)
+
+	return usage, err
+}
+
+// doJSON sends req as JSON body and decodes the response into resp if it is not nil.
+func (c *Client) doJSON(ctx context.Context, method, apiPath string, query url.Values, req, resp any) error {
+	uri := c.api + apiPath
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	res, err := c.doRequest(ctx, method, uri, body)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		return decodeError(res)
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
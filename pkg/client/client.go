@@ -8,16 +8,39 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"time"
+)
+
+// Retry defaults of transfers.
+const (
+	defaultRetries      = 3
+	defaultRetryBackoff = 500 * time.Millisecond
 )
 
 // Config contains data for constructing client.
 type Config struct {
 	Address string
+	// Token is sent as a bearer token, FSS requires it to register file servers if its join token is set.
+	Token string
+	// Auth sets credentials of every request, it is used instead of Token if set.
+	Auth func(*http.Request) error
+	// HTTPClient sends requests, a default client is used if it is nil.
+	HTTPClient *http.Client
+	// Retries limits retries of failed transfers, 0 means 3 and a negative value disables retries.
+	Retries int
+	// RetryBackoff is the delay before the first retry, it doubles with every next one.
+	RetryBackoff time.Duration
 }
 
 // Clients communicates with FSS http-server.
 type Client struct {
 	address string
+	api     string
+	auth    func(*http.Request) error
+
+	retries      int
+	retryBackoff time.Duration
 
 	httpClient *http.Client
 }
@@ -29,13 +52,52 @@ func New(cfg Config) (*Client, error) {
 		return nil, err
 	}
 
-	uri.Path = path.Join(uri.Path, "/api/v1/file")
-	return &Client{
-		address:    uri.String(),
-		httpClient: &http.Client{},
-	}, nil
+	uri.Path = path.Join(uri.Path, "/api/v1")
+	api := uri.String()
+
+	uri.Path = path.Join(uri.Path, "file")
+	c := &Client{
+		address:      uri.String(),
+		api:          api,
+		auth:         cfg.Auth,
+		retries:      cfg.Retries,
+		retryBackoff: cfg.RetryBackoff,
+		httpClient:   cfg.HTTPClient,
+	}
+
+	if c.auth == nil && cfg.Token != "" {
+		c.auth = BearerToken(cfg.Token)
+	}
+
+	switch {
+	case c.retries == 0:
+		c.retries = defaultRetries
+
+	case c.retries < 0:
+		c.retries = 0
+	}
+
+	if c.retryBackoff <= 0 {
+		c.retryBackoff = defaultRetryBackoff
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{}
+	}
+
+	return c, nil
+}
+
+// BearerToken returns Config.Auth which sends the token in the Authorization header.
+func BearerToken(token string) func(*http.Request) error {
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return nil
+	}
 }
 
+// SaveFile uploads the local file, see Put.
 func (c *Client) SaveFile(ctx context.Context, savingFileName, filePath string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -44,51 +106,51 @@ func (c *Client) SaveFile(ctx context.Context, savingFileName, filePath string)
 
 	defer file.Close()
 
-	uri, err := withFileName(c.address, savingFileName)
-	if err != nil {
-		return fmt.Errorf("add filename into url: %w", err)
-	}
-
-	resp, err := c.doRequest(ctx, http.MethodPost, uri, file)
+	stat, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		return fmt.Errorf("stat local file: %w", err)
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("get error http status: %d", resp.StatusCode)
+	if _, err = c.Put(ctx, savingFileName, file, PutOptions{Size: stat.Size()}); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// GetFile downloads the file into a temporary file next to savingFilePath and renames it,
+// so the local file is either complete or untouched.
 func (c *Client) GetFile(ctx context.Context, fileName, savingFilePath string) (err error) {
-	file, err := os.Create(savingFilePath)
+	file, err := os.CreateTemp(filepath.Dir(savingFilePath), "."+filepath.Base(savingFilePath)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("failed to create local file: %v", err)
+		return fmt.Errorf("failed to create local file: %w", err)
 	}
 
-	defer file.Close()
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
 
-	uri, err := withFileName(c.address, fileName)
-	if err != nil {
-		return fmt.Errorf("add filename into url: %w", err)
+	if _, err = c.Download(ctx, fileName, file, GetOptions{}); err != nil {
+		return err
 	}
 
-	resp, err := c.doRequest(ctx, http.MethodGet, uri, nil)
-	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+	if err = file.Chmod(0o644); err != nil {
+		return fmt.Errorf("chmod local file: %w", err)
 	}
 
-	defer resp.Body.Close()
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("sync local file: %w", err)
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("get error http status: %d", resp.StatusCode)
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("close local file: %w", err)
 	}
 
-	if _, err = io.Copy(file, resp.Body); err != nil {
-		return fmt.Errorf("write file content: %w", err)
+	if err = os.Rename(file.Name(), savingFilePath); err != nil {
+		return fmt.Errorf("rename local file: %w", err)
 	}
 
 	return nil
@@ -113,6 +175,17 @@ func (c *Client) doRequest(ctx context.Context, method, urlPath string, reqData
 		return nil, fmt.Errorf("construct request: %w", err)
 	}
 
+	return c.send(req)
+}
+
+// send authorizes and sends the request.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.auth != nil {
+		if err := c.auth(req); err != nil {
+			return nil, permanent(fmt.Errorf("authorize request: %w", err))
+		}
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
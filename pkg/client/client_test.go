@@ -0,0 +1,286 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsapen/fss/pkg/client"
+)
+
+const testToken = "secret"
+
+// fakeFSS serves the file API from memory and breaks responses on demand.
+type fakeFSS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	// unavailable is the number of next requests answered with 503.
+	unavailable int
+	// broken is the number of next downloads cut after half of the body.
+	broken int
+}
+
+func newFakeFSS(t *testing.T) (*fakeFSS, *client.Client) {
+	f := &fakeFSS{files: make(map[string][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(client.Config{Address: srv.URL, Token: testToken, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	return f, c
+}
+
+func (f *fakeFSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if f.unavailable > 0 {
+		f.unavailable--
+		writeError(w, http.StatusServiceUnavailable, "unavailable")
+
+		return
+	}
+
+	name := r.URL.Query().Get("filename")
+	switch r.Method {
+	case http.MethodPost:
+		if _, ok := f.files[name]; ok && r.Header.Get("If-Match") == "" {
+			writeError(w, http.StatusConflict, "conflict")
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal")
+			return
+		}
+
+		f.files[name] = data
+		w.Header().Set("ETag", etag(data))
+
+	case http.MethodGet:
+		data, ok := f.files[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "not_found")
+			return
+		}
+
+		w.Header().Set("ETag", etag(data))
+
+		var out http.ResponseWriter = w
+		if f.broken > 0 {
+			f.broken--
+			out = &breakingWriter{ResponseWriter: w, left: len(data) / 2}
+		}
+
+		http.ServeContent(out, r, "", time.Time{}, bytes.NewReader(data))
+	}
+}
+
+// set replaces the file content.
+func (f *fakeFSS) set(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files[name] = data
+}
+
+// breakingWriter aborts the response after left bytes.
+type breakingWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *breakingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n, _ := w.ResponseWriter.Write(p[:w.left])
+		w.left -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.left -= n
+
+	return n, err
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, `{"error": {"code": "`+code+`", "message": "`+code+`"}}`)
+}
+
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.Read(content)
+
+	return content
+}
+
+func TestPutGet(t *testing.T) {
+	f, c := newFakeFSS(t)
+	ctx := context.Background()
+	content := randomContent(1000)
+
+	var done, total int64
+	tag, err := c.Put(ctx, "file", bytes.NewReader(content), client.PutOptions{Progress: func(d, t int64) { done, total = d, t }})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Trim(etag(content), `"`), tag)
+	assert.Equal(t, int64(1000), done)
+	assert.Equal(t, int64(1000), total)
+
+	_, err = c.Put(ctx, "file", bytes.NewReader(content), client.PutOptions{})
+	assert.ErrorIs(t, err, client.ErrConflict)
+
+	body, info, err := c.Get(ctx, "file")
+	require.NoError(t, err)
+	assert.Equal(t, client.Info{Size: 1000, ETag: tag}, info)
+
+	got, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.NoError(t, body.Close())
+
+	_, _, err = c.Get(ctx, "missing")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	f.unavailable = 2
+	_, err = c.Put(ctx, "retried", bytes.NewReader(content), client.PutOptions{})
+	assert.NoError(t, err)
+
+	f.unavailable = 1
+	_, err = c.Put(ctx, "not seekable", io.MultiReader(bytes.NewReader(content)), client.PutOptions{})
+	assert.ErrorIs(t, err, client.ErrUnavailable)
+}
+
+func TestDownloadResume(t *testing.T) {
+	f, c := newFakeFSS(t)
+	ctx := context.Background()
+	content := randomContent(64 << 10)
+	f.set("file", content)
+
+	f.broken = 2
+
+	var buf bytes.Buffer
+	var done int64
+	info, err := c.Download(ctx, "file", &buf, client.GetOptions{Progress: func(d, _ int64) { done = d }})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, content, buf.Bytes())
+	assert.Equal(t, int64(len(content)), done)
+
+	f.broken = 1
+	body, _, err := c.Get(ctx, "file")
+	require.NoError(t, err)
+
+	f.mu.Lock()
+	f.unavailable = 10
+	f.mu.Unlock()
+
+	_, err = io.Copy(io.Discard, body)
+	assert.ErrorIs(t, err, client.ErrUnavailable)
+	assert.NoError(t, body.Close())
+}
+
+func TestReadAt(t *testing.T) {
+	f, c := newFakeFSS(t)
+	ctx := context.Background()
+	content := randomContent(100)
+	f.set("file", content)
+
+	r, err := c.Open(ctx, "file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), r.Info().Size)
+
+	tests := []struct {
+		name string
+		off  int64
+		size int
+		want []byte
+		err  error
+	}{
+		{name: "start", off: 0, size: 10, want: content[:10]},
+		{name: "middle", off: 40, size: 20, want: content[40:60]},
+		{name: "end", off: 90, size: 10, want: content[90:]},
+		{name: "after the end", off: 95, size: 10, want: content[95:], err: io.EOF},
+		{name: "outside", off: 100, size: 10, want: []byte{}, err: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.size)
+			n, err := r.ReadAt(p, tt.off)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, p[:n])
+
+			n, err = c.ReadAt(ctx, "file", p, tt.off)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, p[:n])
+		})
+	}
+
+	f.set("file", randomContent(100))
+	_, err = r.ReadAt(make([]byte, 10), 0)
+	assert.ErrorIs(t, err, client.ErrChanged)
+
+	f.set("empty", nil)
+	r, err = c.Open(ctx, "empty")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), r.Info().Size)
+}
+
+func TestGetFile(t *testing.T) {
+	f, c := newFakeFSS(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+
+	assert.ErrorIs(t, c.GetFile(ctx, "missing", path), client.ErrNotFound)
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), got)
+
+	f.set("file", []byte("new content"))
+	f.broken = 1
+	require.NoError(t, c.GetFile(ctx, "file", path))
+
+	got, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new content"), got)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, c.SaveFile(ctx, "copy", path))
+	assert.Equal(t, []byte("new content"), f.files["copy"])
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error codes of FSS error responses.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeLocked              = "locked"
+	CodeRangeNotSatisfiable = "range_not_satisfiable"
+	CodeTooLarge            = "too_large"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeUnavailable         = "unavailable"
+	CodeInternal            = "internal"
+)
+
+// maxErrorSize limits error bodies read from responses.
+const maxErrorSize = 64 << 10
+
+// Sentinel errors to match with errors.Is by code.
+var (
+	ErrBadRequest          = &Error{Code: CodeBadRequest}
+	ErrUnauthorized        = &Error{Code: CodeUnauthorized}
+	ErrNotFound            = &Error{Code: CodeNotFound}
+	ErrConflict            = &Error{Code: CodeConflict}
+	ErrPreconditionFailed  = &Error{Code: CodePreconditionFailed}
+	ErrLocked              = &Error{Code: CodeLocked}
+	ErrRangeNotSatisfiable = &Error{Code: CodeRangeNotSatisfiable}
+	ErrTooLarge            = &Error{Code: CodeTooLarge}
+	ErrQuotaExceeded       = &Error{Code: CodeQuotaExceeded}
+	ErrUnavailable         = &Error{Code: CodeUnavailable}
+	ErrInternal            = &Error{Code: CodeInternal}
+)
+
+// Error is an error response of the FSS.
+type Error struct {
+	StatusCode int            `json:"-"`
+	Code       string         `json:"code"`
+	Message    string         `json:"message"`
+	RequestID  string         `json:"request_id"`
+	Details    map[string]any `json:"details"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("%s (%d): %s, request id %s", e.Code, e.StatusCode, e.Message, e.RequestID)
+}
+
+// Is reports whether target is an error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+
+	return ok && t.Code == e.Code
+}
+
+// decodeError builds error of the failed response. Responses without error body,
+// for example from proxies, get the code by status.
+func decodeError(resp *http.Response) error {
+	var body struct {
+		Error *Error `json:"error"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorSize)).Decode(&body); err != nil || body.Error == nil || body.Error.Code == "" {
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Code:       statusCode(resp.StatusCode),
+			Message:    http.StatusText(resp.StatusCode),
+		}
+	}
+
+	body.Error.StatusCode = resp.StatusCode
+
+	return body.Error
+}
+
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+
+	case http.StatusNotFound:
+		return CodeNotFound
+
+	case http.StatusConflict:
+		return CodeConflict
+
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+
+	case http.StatusLocked:
+		return CodeLocked
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		return CodeRangeNotSatisfiable
+
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+
+	case http.StatusInsufficientStorage:
+		return CodeQuotaExceeded
+
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+
+	default:
+		return CodeInternal
+	}
+}
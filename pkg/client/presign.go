@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Presigned is a URL which allows one method on one file without credentials until it expires.
+// A download URL is used with GET, an upload URL with PUT and the file content as the body.
+type Presigned struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type presignRequest struct {
+	Method    string `json:"method"`
+	Filename  string `json:"filename"`
+	ExpiresIn int64  `json:"expires_in"`
+	MaxSize   int64  `json:"max_size,omitempty"`
+}
+
+// PresignGet returns a URL to download the file during ttl, the FSS rounds it to seconds.
+func (c *Client) PresignGet(ctx context.Context, filename string, ttl time.Duration) (*Presigned, error) {
+	return c.presign(ctx, presignRequest{Method: http.MethodGet, Filename: filename, ExpiresIn: ttlSeconds(ttl)})
+}
+
+// PresignPut returns a URL to upload the file during ttl. Uploads larger than maxSize are
+// rejected with ErrTooLarge, 0 means no limit.
+func (c *Client) PresignPut(ctx context.Context, filename string, ttl time.Duration, maxSize int64) (*Presigned, error) {
+	return c.presign(ctx, presignRequest{Method: http.MethodPut, Filename: filename, ExpiresIn: ttlSeconds(ttl), MaxSize: maxSize})
+}
+
+func (c *Client) presign(ctx context.Context, req presignRequest) (*Presigned, error) {
+	p := new(Presigned)
+	if err := c.doJSON(ctx, http.MethodPost, "/presign", nil, req, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func ttlSeconds(ttl time.Duration) int64 {
+	return int64((ttl + time.Second - 1) / time.Second)
+}
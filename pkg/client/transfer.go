@@ -0,0 +1,506 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrChanged is returned when the file is overwritten while it is read.
+	ErrChanged = errors.New("file changed")
+	// ErrRangesUnsupported is returned for ranged reads of files uploaded before the FSS recorded fragment sizes.
+	ErrRangesUnsupported = errors.New("file does not support ranged reads")
+)
+
+// ProgressFunc is called with transferred bytes, total is -1 if the size is unknown.
+type ProgressFunc func(done, total int64)
+
+// Info describes a stored file.
+type Info struct {
+	// Size is the file size in bytes, -1 if it is unknown.
+	Size int64
+	// ETag identifies the content, it is empty for files uploaded before etags.
+	ETag string
+}
+
+// PutOptions controls an upload.
+type PutOptions struct {
+	// Size is the content length if it is known, it is also the progress total.
+	Size int64
+	// IfMatch overwrites the file only if it has the etag, "*" matches any committed file.
+	IfMatch string
+	// IfNoneMatch creates the file only if it does not exist.
+	IfNoneMatch bool
+	Progress    ProgressFunc
+}
+
+// GetOptions controls a download.
+type GetOptions struct {
+	Progress ProgressFunc
+}
+
+// Put uploads the content of r as the file and returns its etag. Without preconditions
+// an existing file gives ErrConflict. A failed upload is retried from the start if r is
+// an io.Seeker and IfMatch is empty, since the FSS drops the old content of an overwritten
+// file when the upload starts.
+func (c *Client) Put(ctx context.Context, fileName string, r io.Reader, opts PutOptions) (string, error) {
+	uri, err := withFileName(c.address, fileName)
+	if err != nil {
+		return "", fmt.Errorf("add filename into url: %w", err)
+	}
+
+	total := int64(-1)
+	if opts.Size > 0 {
+		total = opts.Size
+	} else if l, ok := r.(interface{ Len() int }); ok {
+		total = int64(l.Len())
+	}
+
+	var etag string
+	put := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, &progressReader{r: r, total: total, fn: opts.Progress})
+		if err != nil {
+			return permanent(fmt.Errorf("construct request: %w", err))
+		}
+
+		if total > 0 {
+			req.ContentLength = total
+		}
+
+		if opts.IfNoneMatch {
+			req.Header.Set("If-None-Match", "*")
+		}
+
+		if opts.IfMatch != "" {
+			req.Header.Set("If-Match", quoteETag(opts.IfMatch))
+		}
+
+		resp, err := c.send(req)
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return decodeError(resp)
+		}
+
+		etag = unquoteETag(resp.Header.Get("ETag"))
+
+		return nil
+	}
+
+	// The content is sent again from the start position, -1 means it can not be.
+	start := int64(-1)
+	if seeker, ok := r.(io.Seeker); ok && opts.IfMatch == "" {
+		if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			start = pos
+		}
+	}
+
+	attempt := 0
+	err = c.retry(ctx, func() error {
+		attempt++
+		if attempt > 1 {
+			if _, err := r.(io.Seeker).Seek(start, io.SeekStart); err != nil {
+				return permanent(fmt.Errorf("rewind content: %w", err))
+			}
+		}
+
+		err := put()
+		if err != nil && start < 0 {
+			return permanent(err)
+		}
+
+		return err
+	})
+
+	return etag, err
+}
+
+// Get starts the download of the file. A broken download is resumed from the read offset
+// if the file has an etag and a known size; ErrChanged is returned if the file is overwritten.
+func (c *Client) Get(ctx context.Context, fileName string) (io.ReadCloser, Info, error) {
+	var resp *http.Response
+	err := c.retry(ctx, func() (err error) {
+		resp, err = c.open(ctx, fileName, 0, -1, "")
+
+		return err
+	})
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	info := responseInfo(resp)
+
+	return &resumeReader{c: c, ctx: ctx, name: fileName, info: info, body: resp.Body}, info, nil
+}
+
+// Download writes the file into w.
+func (c *Client) Download(ctx context.Context, fileName string, w io.Writer, opts GetOptions) (_ Info, err error) {
+	body, info, err := c.Get(ctx, fileName)
+	if err != nil {
+		return Info{}, err
+	}
+
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close response: %w", closeErr)
+		}
+	}()
+
+	if _, err = io.Copy(w, &progressReader{r: body, total: info.Size, fn: opts.Progress}); err != nil {
+		return Info{}, fmt.Errorf("write file content: %w", err)
+	}
+
+	return info, nil
+}
+
+// ReadAt reads len(p) bytes of the file from off. Like io.ReaderAt, it returns io.EOF
+// if the file ends before p is filled.
+func (c *Client) ReadAt(ctx context.Context, fileName string, p []byte, off int64) (int, error) {
+	return c.readAt(ctx, fileName, "", p, off)
+}
+
+// Open returns a reader of the current version of the file for ranged reads.
+func (c *Client) Open(ctx context.Context, fileName string) (*RangeReader, error) {
+	var info Info
+	err := c.retry(ctx, func() error {
+		resp, err := c.open(ctx, fileName, 0, 1, "")
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		// Only empty files can not satisfy the first byte, they may also be sent whole.
+		if resp.StatusCode == http.StatusOK && resp.ContentLength != 0 {
+			return permanent(ErrRangesUnsupported)
+		}
+
+		info = responseInfo(resp)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RangeReader{c: c, ctx: ctx, name: fileName, info: info}, nil
+}
+
+// RangeReader reads ranges of one version of the file, it fails with ErrChanged once the file is overwritten.
+type RangeReader struct {
+	c    *Client
+	ctx  context.Context
+	name string
+	info Info
+}
+
+// Info returns the size and the etag of the read version.
+func (r *RangeReader) Info() Info {
+	return r.info
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.info.Size {
+		return 0, io.EOF
+	}
+
+	return r.c.readAt(r.ctx, r.name, r.info.ETag, p, off)
+}
+
+func (c *Client) readAt(ctx context.Context, fileName, etag string, p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	err = c.retry(ctx, func() error {
+		n = 0
+		resp, err := c.open(ctx, fileName, off, int64(len(p)), etag)
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusRequestedRangeNotSatisfiable:
+			return permanent(io.EOF)
+
+		case http.StatusOK:
+			if etag != "" && unquoteETag(resp.Header.Get("ETag")) != etag {
+				return permanent(ErrChanged)
+			}
+
+			return permanent(ErrRangesUnsupported)
+		}
+
+		n, err = io.ReadFull(resp.Body, p)
+		if (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) && resp.ContentLength == int64(n) {
+			return permanent(io.EOF)
+		}
+
+		return err
+	})
+
+	return n, err
+}
+
+// open requests length bytes of the file from off, a negative length means the rest of the file.
+// The range is ignored by the FSS, so the whole file is sent, if etag does not match. A range
+// after the end of the file gives a response with the status 416.
+func (c *Client) open(ctx context.Context, fileName string, off, length int64, etag string) (*http.Response, error) {
+	uri, err := withFileName(c.address, fileName)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("add filename into url: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("construct request: %w", err))
+	}
+
+	switch {
+	case length >= 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+
+	case off > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	if etag != "" {
+		req.Header.Set("If-Range", quoteETag(etag))
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		return resp, nil
+
+	default:
+		defer resp.Body.Close()
+
+		return nil, decodeError(resp)
+	}
+}
+
+// resumeReader reads the response body and requests the rest of the file if the body breaks.
+type resumeReader struct {
+	c    *Client
+	ctx  context.Context
+	name string
+	info Info
+	body io.ReadCloser
+
+	offset   int64
+	failures int
+}
+
+func (r *resumeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+
+		if err == nil || errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		if resumeErr := r.resume(err); resumeErr != nil {
+			return n, resumeErr
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume replaces the broken body with the rest of the same file version.
+func (r *resumeReader) resume(cause error) error {
+	if r.info.ETag == "" || r.info.Size < 0 {
+		return cause
+	}
+
+	_ = r.body.Close()
+	r.body = io.NopCloser(strings.NewReader(""))
+
+	for {
+		if r.failures >= r.c.retries || r.ctx.Err() != nil {
+			return cause
+		}
+
+		r.failures++
+		if err := sleep(r.ctx, r.c.backoff(r.failures-1)); err != nil {
+			return cause
+		}
+
+		resp, err := r.c.open(r.ctx, r.name, r.offset, -1, r.info.ETag)
+		if err != nil {
+			if !retryable(r.ctx, err) {
+				return fmt.Errorf("resume after %v: %w", cause, err)
+			}
+
+			cause = err
+
+			continue
+		}
+
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			r.body = resp.Body
+
+		case http.StatusRequestedRangeNotSatisfiable:
+			// The body broke right at the end of the file.
+			resp.Body.Close()
+
+		default:
+			resp.Body.Close()
+
+			return ErrChanged
+		}
+
+		return nil
+	}
+}
+
+func (r *resumeReader) Close() error {
+	return r.body.Close()
+}
+
+// progressReader reports read bytes.
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 && r.fn != nil {
+		r.done += int64(n)
+		r.fn(r.done, r.total)
+	}
+
+	return n, err
+}
+
+// permanentError is not retried.
+type permanentError struct {
+	err error
+}
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// retry calls op until it succeeds, fails with an error which is not retryable or runs out of retries.
+func (c *Client) retry(ctx context.Context, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= c.retries || !retryable(ctx, err) {
+			var p permanentError
+			if errors.As(err, &p) {
+				return p.err
+			}
+
+			return err
+		}
+
+		if sleepErr := sleep(ctx, c.backoff(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	return c.retryBackoff << attempt
+}
+
+// retryable reports whether the error is a network failure or an unavailable FSS.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.As(err, &permanentError{}) {
+		return false
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-t.C:
+		return nil
+	}
+}
+
+// responseInfo reads the file size and the etag of the download response.
+func responseInfo(resp *http.Response) Info {
+	info := Info{Size: resp.ContentLength, ETag: unquoteETag(resp.Header.Get("ETag"))}
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		info.Size = -1
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				info.Size = size
+			}
+		}
+	}
+
+	return info
+}
+
+func quoteETag(etag string) string {
+	if etag == "*" || strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+func unquoteETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}